@@ -0,0 +1,62 @@
+package testenv
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/saturn4er/go-testenv/docker"
+)
+
+// Backend is a container engine used by ProjectEnv. docker.Client is the
+// default implementation, package fake provides an in-memory one.
+type Backend interface {
+	CreateNetwork(ctx context.Context, params docker.CreateNetworkParams) (*docker.Network, error)
+	RemoveNetwork(ctx context.Context, id string) error
+	FindNetworks(ctx context.Context, labels map[string]string) ([]*docker.Network, error)
+
+	CreateVolume(ctx context.Context, params docker.CreateVolumeParams) (*docker.Volume, error)
+	RemoveVolume(ctx context.Context, name string) error
+	FindVolumes(ctx context.Context, labels map[string]string) ([]*docker.Volume, error)
+
+	RunContainer(ctx context.Context, params docker.RunContainerParams) (*docker.Container, error)
+	InspectContainer(ctx context.Context, id string) (*docker.Container, error)
+	// FindContainers returns running and stopped containers having labels.
+	FindContainers(ctx context.Context, labels map[string]string) ([]*docker.Container, error)
+	WaitContainer(ctx context.Context, id string) (int, error)
+	// Logs writes container output to params writers. With params.Follow it
+	// blocks until the container stops or ctx is done.
+	Logs(ctx context.Context, id string, params docker.LogsParams) error
+	Exec(ctx context.Context, id string, params docker.ExecParams) (*docker.ExecResult, error)
+	// CopyToContainer extracts tar archive to path inside the container.
+	CopyToContainer(ctx context.Context, id string, path string, archive io.Reader) error
+	// CopyFromContainer writes tar archive of path inside the container to w.
+	CopyFromContainer(ctx context.Context, id string, path string, w io.Writer) error
+	RemoveContainer(ctx context.Context, id string) error
+
+	ImageExists(ctx context.Context, image string) (bool, error)
+	PullImage(ctx context.Context, params docker.PullImageParams) error
+	BuildImage(ctx context.Context, params docker.BuildImageParams) (string, error)
+	RemoveImage(ctx context.Context, id string) error
+	// UntagImage removes the image tag. Images used by containers, e.g. of
+	// other sessions, are left intact.
+	UntagImage(ctx context.Context, image string) error
+	// SaveImages writes images to w as a tar archive, LoadImages loads such
+	// archive and returns names of loaded images.
+	SaveImages(ctx context.Context, images []string, w io.Writer) error
+	LoadImages(ctx context.Context, r io.Reader) ([]string, error)
+	// HelperImages returns images the backend runs for itself, e.g. of the
+	// reaper. They must be present in offline mode.
+	HelperImages() []string
+
+	// Host returns the address on which published container ports are reachable.
+	Host() string
+	// Cleanup removes every resource created by the backend, except persistent
+	// ones.
+	Cleanup(ctx context.Context) error
+	// Prune removes resources of other sessions created more than olderThan
+	// ago.
+	Prune(ctx context.Context, olderThan time.Duration) error
+}
+
+var _ Backend = (*docker.Client)(nil)
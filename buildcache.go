@@ -0,0 +1,161 @@
+package testenv
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ory/dockertest/docker/pkg/fileutils"
+	"github.com/pkg/errors"
+	"github.com/saturn4er/go-testenv/docker"
+)
+
+const (
+	builtImageRepository = "testenv/"
+	builtImageTagLength  = 20
+)
+
+// contentTag returns a tag of the image which changes whenever the
+// Dockerfile, the build context or build parameters change.
+func (i ImageDesc) contentTag(labels, buildArgs map[string]string) (string, error) {
+	h := sha256.New()
+
+	var contextDir string
+	if i.ContextDir != "" {
+		var err error
+		if contextDir, err = filepath.Abs(i.ContextDir); err != nil {
+			return "", errors.WithStack(err)
+		}
+	}
+
+	switch {
+	case i.DockerfileContent != "":
+		fmt.Fprintf(h, "inline dockerfile\n%s\n", i.DockerfileContent)
+	case i.ContextArchive != nil:
+		fmt.Fprintf(h, "dockerfile %s\n", filepath.ToSlash(i.dockerfile()))
+	default:
+		fmt.Fprintf(h, "dockerfile %s\n", filepath.ToSlash(i.dockerfile()))
+		if err := hashFile(h, filepath.Join(contextDir, i.dockerfile())); err != nil {
+			return "", errors.Wrap(err, "failed to read Dockerfile")
+		}
+	}
+
+	switch {
+	case i.ContextArchive != nil:
+		fmt.Fprintf(h, "context archive\n")
+		h.Write(i.ContextArchive)
+	case contextDir != "":
+		if err := hashBuildContext(h, contextDir); err != nil {
+			return "", err
+		}
+	}
+
+	fmt.Fprintf(h, "target %s\nplatform %s\n", i.Target, i.Platform)
+	for _, value := range []map[string]string{buildArgs, labels} {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		fmt.Fprintf(h, "%s\n", encoded)
+	}
+
+	name := "image"
+	if contextDir != "" {
+		name = imageRepositoryName(filepath.Base(contextDir))
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	return builtImageRepository + name + ":" + sum[:builtImageTagLength], nil
+}
+
+func (i ImageDesc) dockerfile() string {
+	if i.Dockerfile == "" {
+		return "Dockerfile"
+	}
+	return i.Dockerfile
+}
+
+// hashBuildContext writes paths, modes and contents of files sent to the
+// engine as the build context to h.
+func hashBuildContext(h hash.Hash, contextDir string) error {
+	patterns, err := docker.ReadDockerignore(contextDir)
+	if err != nil {
+		return err
+	}
+	matcher, err := fileutils.NewPatternMatcher(patterns)
+	if err != nil {
+		return errors.Wrap(err, "invalid .dockerignore")
+	}
+
+	return filepath.Walk(contextDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		rel, err := filepath.Rel(contextDir, path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if rel == "." {
+			return nil
+		}
+
+		excluded, err := matcher.Matches(rel)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if excluded {
+			if info.IsDir() && !matcher.Exclusions() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		fmt.Fprintf(h, "%s %o\n", filepath.ToSlash(rel), info.Mode())
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			fmt.Fprintf(h, "%s\n", target)
+		case info.Mode().IsRegular():
+			return hashFile(h, path)
+		}
+		return nil
+	})
+}
+
+func hashFile(h hash.Hash, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer file.Close()
+
+	_, err = io.Copy(h, file)
+	return errors.WithStack(err)
+}
+
+// imageRepositoryName converts name to a valid lowercase repository name.
+func imageRepositoryName(name string) string {
+	result := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, name)
+	result = strings.Trim(result, ".-_")
+	if result == "" {
+		return "image"
+	}
+	return result
+}
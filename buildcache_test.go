@@ -0,0 +1,227 @@
+package testenv_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/saturn4er/go-testenv"
+	"github.com/saturn4er/go-testenv/docker"
+	"github.com/saturn4er/go-testenv/fake"
+	"github.com/stretchr/testify/require"
+)
+
+func copyBuildContext(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "testenv-build")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	for _, name := range []string{"Dockerfile", "app.txt", ".dockerignore"} {
+		content, err := ioutil.ReadFile(filepath.Join("testdata", "build", name))
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), content, 0644))
+	}
+	return dir
+}
+
+func buildImage(t *testing.T, backend *fake.Backend, desc testenv.ImageDesc) string {
+	projectEnv := testenv.NewProjectEnvWithBackend(testenv.ProjectEnvDesc{
+		Containers: map[string]testenv.ContainerDesc{
+			"app": {Image: testenv.BuildImage(desc)},
+		},
+		Logger: testenv.NopLogger(),
+	}, backend)
+	require.NoError(t, projectEnv.Run())
+
+	params, ok := backend.ContainerParams(projectEnv.MustContainer("app").ID())
+	require.True(t, ok)
+	require.NoError(t, projectEnv.Close())
+	return params.Image
+}
+
+func TestBuildImageCache(t *testing.T) {
+	backend := fake.NewBackend()
+	dir := copyBuildContext(t)
+	desc := testenv.ImageDesc{
+		ContextDir: dir,
+		BuildArgs:  testenv.StringsMap{"VERSION": testenv.StringValue("1")},
+		Retention:  testenv.ImageRetentionKeep,
+	}
+
+	image := buildImage(t, backend, desc)
+	require.True(t, strings.HasPrefix(image, "testenv/"+strings.ToLower(filepath.Base(dir))+":"), image)
+	require.Contains(t, backend.Images(), image)
+	require.Equal(t, image, buildImage(t, backend, desc))
+	require.Equal(t, 1, backend.Builds())
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "build.log"), []byte("ignored"), 0644))
+	require.Equal(t, image, buildImage(t, backend, desc))
+
+	desc.BuildArgs = testenv.StringsMap{"VERSION": testenv.StringValue("2")}
+	argsImage := buildImage(t, backend, desc)
+	require.NotEqual(t, image, argsImage)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "app.txt"), []byte("changed"), 0644))
+	contentImage := buildImage(t, backend, desc)
+	require.NotEqual(t, argsImage, contentImage)
+	require.Equal(t, 3, backend.Builds())
+
+	os.Setenv("TESTENV_FRESH", "1")
+	defer os.Unsetenv("TESTENV_FRESH")
+	require.Equal(t, contentImage, buildImage(t, backend, desc))
+	require.Equal(t, 4, backend.Builds())
+}
+
+func TestBuildImageRemovedOnClose(t *testing.T) {
+	backend := fake.NewBackend()
+
+	image := buildImage(t, backend, testenv.ImageDesc{ContextDir: copyBuildContext(t)})
+	require.NotContains(t, backend.Images(), image)
+}
+
+func TestBuildImageSharedBetweenSessions(t *testing.T) {
+	first := fake.NewBackend()
+	second := first.NewSession()
+	dir := copyBuildContext(t)
+	newProjectEnv := func(backend *fake.Backend) *testenv.ProjectEnv {
+		return testenv.NewProjectEnvWithBackend(testenv.ProjectEnvDesc{
+			Containers: map[string]testenv.ContainerDesc{
+				"app": {Image: testenv.BuildImage(testenv.ImageDesc{ContextDir: dir})},
+			},
+			Logger: testenv.NopLogger(),
+		}, backend)
+	}
+
+	firstEnv := newProjectEnv(first)
+	require.NoError(t, firstEnv.Run())
+	secondEnv := newProjectEnv(second)
+	require.NoError(t, secondEnv.Run())
+	require.Equal(t, 1, first.Builds())
+
+	containerImage := func(backend *fake.Backend, projectEnv *testenv.ProjectEnv) string {
+		params, ok := backend.ContainerParams(projectEnv.MustContainer("app").ID())
+		require.True(t, ok)
+		return params.Image
+	}
+	image := containerImage(first, firstEnv)
+	require.Equal(t, image, containerImage(second, secondEnv))
+
+	require.NoError(t, firstEnv.Close())
+	require.Contains(t, second.Images(), image)
+	require.Len(t, second.Containers(), 1)
+
+	testCase := secondEnv.NewTestCaseEnv()
+	require.NoError(t, testCase.Run())
+	require.NoError(t, testCase.Close())
+	require.NoError(t, secondEnv.Close())
+}
+
+func TestBuildImageSharedBetweenProjects(t *testing.T) {
+	backend := fake.NewBackend()
+	builds := 0
+	backend.BuildImageHook = func(params docker.BuildImageParams) error {
+		builds++
+		if builds == 1 {
+			return errors.New("build failed")
+		}
+		return nil
+	}
+	desc := testenv.ProjectEnvDesc{
+		Containers: map[string]testenv.ContainerDesc{
+			"app": {Image: testenv.BuildImage(testenv.ImageDesc{ContextDir: copyBuildContext(t)})},
+		},
+		Logger: testenv.NopLogger(),
+	}
+
+	run := func() string {
+		projectEnv := testenv.NewProjectEnvWithBackend(desc, backend)
+		require.NoError(t, projectEnv.Run())
+		params, ok := backend.ContainerParams(projectEnv.MustContainer("app").ID())
+		require.True(t, ok)
+		require.Contains(t, backend.Images(), params.Image)
+		require.NoError(t, projectEnv.Close())
+		require.NotContains(t, backend.Images(), params.Image)
+		return params.Image
+	}
+
+	failedEnv := testenv.NewProjectEnvWithBackend(desc, backend)
+	require.Error(t, failedEnv.Run())
+	require.NoError(t, failedEnv.Close())
+
+	image := run()
+	require.Equal(t, image, run())
+	require.Equal(t, 3, builds)
+}
+
+func TestBuildImageOptions(t *testing.T) {
+	backend := fake.NewBackend()
+	var params docker.BuildImageParams
+	backend.BuildImageHook = func(p docker.BuildImageParams) error {
+		params = p
+		return nil
+	}
+
+	var messages []string
+	output := &bytes.Buffer{}
+	projectEnv := testenv.NewProjectEnvWithBackend(testenv.ProjectEnvDesc{
+		Containers: map[string]testenv.ContainerDesc{
+			"app": {Image: testenv.BuildImage(testenv.ImageDesc{
+				DockerfileContent: "FROM alpine AS base\nFROM base AS test\n",
+				Target:            "test",
+				Platform:          "linux/arm64",
+				NoCache:           true,
+				Output:            output,
+				LogOutput:         true,
+			})},
+		},
+		Logger: testenv.PrintfLogger(func(format string, args ...interface{}) {
+			messages = append(messages, fmt.Sprintf(format, args...))
+		}),
+	}, backend)
+	require.NoError(t, projectEnv.Run())
+	defer projectEnv.Close()
+
+	require.Equal(t, []byte("FROM alpine AS base\nFROM base AS test\n"), params.DockerfileContent)
+	require.Empty(t, params.ContextDir)
+	require.Equal(t, "test", params.Target)
+	require.Equal(t, "linux/arm64", params.Platform)
+	require.True(t, params.NoCache)
+	require.False(t, params.Pull)
+	require.Equal(t, "Successfully tagged "+params.Name+"\n", output.String())
+	require.Contains(t, messages, "INFO Build output image="+params.Name+" line=Successfully tagged "+params.Name)
+}
+
+func TestBuildImageNoCacheBypassesReuse(t *testing.T) {
+	backend := fake.NewBackend()
+	desc := testenv.ImageDesc{ContextDir: copyBuildContext(t), Retention: testenv.ImageRetentionKeep}
+
+	image := buildImage(t, backend, desc)
+	desc.NoCache = true
+	require.Equal(t, image, buildImage(t, backend, desc))
+	require.Equal(t, 2, backend.Builds())
+}
+
+func TestBuildImageFailure(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.BuildImageHook = func(p docker.BuildImageParams) error {
+		return errors.New("failed to build image: exit status 1\nlast 1 lines of build output:\nRUN false")
+	}
+
+	projectEnv := testenv.NewProjectEnvWithBackend(testenv.ProjectEnvDesc{
+		Containers: map[string]testenv.ContainerDesc{
+			"app": {Image: testenv.BuildImage(testenv.ImageDesc{DockerfileContent: "FROM alpine\nRUN false\n"})},
+		},
+		Logger: testenv.NopLogger(),
+	}, backend)
+	err := projectEnv.Run()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "RUN false")
+	require.NoError(t, projectEnv.Close())
+}
@@ -0,0 +1,103 @@
+package testenv
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/saturn4er/go-testenv/docker"
+	"go.uber.org/multierr"
+)
+
+func (p *ProjectEnv) offline() bool {
+	return p.desc.Offline || docker.Offline()
+}
+
+// checkHelperImages fails if images the backend runs for itself, e.g. the
+// reaper, can't be started in offline mode.
+func (p *ProjectEnv) checkHelperImages(ctx context.Context) error {
+	for _, image := range p.client.HelperImages() {
+		exists, err := p.client.ImageExists(ctx, image)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if !exists {
+			return errors.Errorf("helper image %s is not present and pulling is disabled in offline mode, "+
+				"load it with an image bundle or disable the reaper with $TESTENV_REAPER=off", image)
+		}
+	}
+	return nil
+}
+
+// SaveImageBundle pulls and builds images of all project and test case
+// containers like Preflight and writes them to w as a single tar archive,
+// which LoadImageBundle loads on hosts without registry access. It returns
+// the saved images. Built images are saved without session labels, so Prune
+// doesn't remove them after loading.
+func (p *ProjectEnv) SaveImageBundle(ctx context.Context, w io.Writer) (_ []string, err error) {
+	ctx, span := startSpan(ctx, p, nil, "testenv.ProjectEnv.SaveImageBundle")
+	defer func() { endSpan(span, err) }()
+
+	images, err := p.preflight(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.client.SaveImages(ctx, images, w); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	p.logger.Info("Image bundle saved", "images", len(images))
+	return images, nil
+}
+
+// SaveImageBundleFile is SaveImageBundle writing to the file at path. The
+// file is replaced only if the bundle is saved successfully.
+func (p *ProjectEnv) SaveImageBundleFile(ctx context.Context, path string) (_ []string, err error) {
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(file.Name())
+		}
+	}()
+
+	images, err := p.SaveImageBundle(ctx, file)
+	if closeErr := file.Close(); closeErr != nil {
+		err = multierr.Append(err, errors.WithStack(closeErr))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return images, errors.WithStack(os.Rename(file.Name(), path))
+}
+
+// LoadImageBundle loads images saved by SaveImageBundle into the backend and
+// returns them.
+func (p *ProjectEnv) LoadImageBundle(ctx context.Context, r io.Reader) (_ []string, err error) {
+	ctx, span := startSpan(ctx, p, nil, "testenv.ProjectEnv.LoadImageBundle")
+	defer func() { endSpan(span, err) }()
+
+	images, err := p.client.LoadImages(ctx, r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	p.logger.Info("Image bundle loaded", "images", len(images))
+	return images, nil
+}
+
+// LoadImageBundleFile is LoadImageBundle reading the file at path.
+func (p *ProjectEnv) LoadImageBundleFile(ctx context.Context, path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer file.Close()
+
+	return p.LoadImageBundle(ctx, file)
+}
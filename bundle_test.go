@@ -0,0 +1,161 @@
+package testenv_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/saturn4er/go-testenv"
+	"github.com/saturn4er/go-testenv/docker"
+	"github.com/saturn4er/go-testenv/fake"
+	"github.com/stretchr/testify/require"
+)
+
+func bundlePath(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "testenv-bundle")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+	return filepath.Join(dir, "images.tar")
+}
+
+func bundleEnvDesc(offline bool) testenv.ProjectEnvDesc {
+	return testenv.ProjectEnvDesc{
+		Containers: map[string]testenv.ContainerDesc{
+			"postgres": {Image: testenv.ExternalImage("postgres:12")},
+			"app": {Image: testenv.BuildImage(testenv.ImageDesc{
+				ContextDir: "testdata/build",
+				Pull:       true,
+				Retention:  testenv.ImageRetentionKeep,
+			})},
+		},
+		TestCaseEnv: testenv.TestCaseEnvDesc{
+			Containers: map[string]*testenv.ContainerDesc{
+				"redis": {Image: testenv.ExternalImage("redis:5"), PullPolicy: testenv.PullAlways},
+			},
+		},
+		Offline: offline,
+		Logger:  testenv.NopLogger(),
+	}
+}
+
+func TestImageBundle(t *testing.T) {
+	ctx := context.Background()
+	path := bundlePath(t)
+
+	online := fake.NewBackend()
+	online.BuildImageHook = func(params docker.BuildImageParams) error {
+		require.True(t, params.Persistent)
+		return nil
+	}
+	projectEnv := testenv.NewProjectEnvWithBackend(bundleEnvDesc(false), online)
+	saved, err := projectEnv.SaveImageBundleFile(ctx, path)
+	require.NoError(t, err)
+	require.NoError(t, projectEnv.Close())
+	require.Len(t, saved, 3)
+	require.Contains(t, saved, "postgres:12")
+	require.Contains(t, saved, "redis:5")
+
+	offline := fake.NewBackend()
+	offline.BuildImageHook = func(params docker.BuildImageParams) error {
+		require.False(t, params.Pull)
+		return nil
+	}
+	projectEnv = testenv.NewProjectEnvWithBackend(bundleEnvDesc(true), offline)
+	loaded, err := projectEnv.LoadImageBundleFile(ctx, path)
+	require.NoError(t, err)
+	require.Equal(t, saved, loaded)
+
+	require.NoError(t, projectEnv.Run())
+	testCase := projectEnv.NewTestCaseEnv()
+	require.NoError(t, testCase.Run())
+	require.NoError(t, testCase.Close())
+	require.NoError(t, projectEnv.Close())
+	require.Equal(t, 0, offline.Pulls())
+	require.Equal(t, 0, offline.Builds())
+}
+
+func TestSaveImageBundleFailureKeepsFile(t *testing.T) {
+	path := bundlePath(t)
+	require.NoError(t, ioutil.WriteFile(path, []byte("previous"), 0644))
+
+	backend := fake.NewBackend()
+	desc := bundleEnvDesc(true)
+	desc.Containers = map[string]testenv.ContainerDesc{
+		"postgres": {Image: testenv.ExternalImage("postgres:12")},
+	}
+	desc.TestCaseEnv = testenv.TestCaseEnvDesc{}
+	projectEnv := testenv.NewProjectEnvWithBackend(desc, backend)
+	_, err := projectEnv.SaveImageBundleFile(context.Background(), path)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "image postgres:12 is not present and pulling is disabled in offline mode")
+	require.NoError(t, projectEnv.Close())
+
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "previous", string(content))
+	files, err := filepath.Glob(filepath.Join(filepath.Dir(path), ".images.tar*"))
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
+
+func TestOfflineProjectKeepsSharedBackendOnline(t *testing.T) {
+	backend := fake.NewBackend()
+	desc := bundleEnvDesc(true)
+	desc.Containers = map[string]testenv.ContainerDesc{
+		"postgres": {Image: testenv.ExternalImage("postgres:12")},
+	}
+	desc.TestCaseEnv = testenv.TestCaseEnvDesc{}
+	offline := testenv.NewProjectEnvWithBackend(desc, backend)
+	err := offline.Run()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "image postgres:12 is not present and pulling is disabled in offline mode")
+	require.NoError(t, offline.Close())
+
+	desc.Offline = false
+	online := testenv.NewProjectEnvWithBackend(desc, backend)
+	require.NoError(t, online.Run())
+	require.NoError(t, online.Close())
+	require.Equal(t, 1, backend.Pulls())
+
+	_, err = backend.RunContainer(context.Background(), docker.RunContainerParams{Image: "redis:5", Offline: true})
+	require.EqualError(t, err, "image redis:5 is not present and pulling is disabled in offline mode")
+}
+
+func TestOfflineRequiresHelperImages(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.Helpers = []string{"testcontainers/ryuk:0.3.4"}
+	backend.AddImage("postgres:12")
+	desc := bundleEnvDesc(true)
+	desc.Containers = map[string]testenv.ContainerDesc{
+		"postgres": {Image: testenv.ExternalImage("postgres:12")},
+	}
+	desc.TestCaseEnv = testenv.TestCaseEnvDesc{}
+
+	projectEnv := testenv.NewProjectEnvWithBackend(desc, backend)
+	err := projectEnv.Run()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "helper image testcontainers/ryuk:0.3.4 is not present and pulling is disabled in offline mode")
+	require.Empty(t, backend.Containers())
+	require.NoError(t, projectEnv.Close())
+
+	backend.AddImage("testcontainers/ryuk:0.3.4")
+	projectEnv = testenv.NewProjectEnvWithBackend(desc, backend)
+	require.NoError(t, projectEnv.Run())
+	require.NoError(t, projectEnv.Close())
+	require.Equal(t, 0, backend.Pulls())
+}
+
+func TestOfflineEnv(t *testing.T) {
+	os.Setenv("TESTENV_OFFLINE", "1")
+	defer os.Unsetenv("TESTENV_OFFLINE")
+
+	backend := fake.NewBackend()
+	err := runWithPullPolicy(backend, testenv.ExternalImage("alpine"), testenv.PullAlways)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "pulling is disabled in offline mode")
+	require.Equal(t, 0, backend.Pulls())
+}
@@ -0,0 +1,128 @@
+// Command testenv manages images of test environments.
+//
+//	testenv bundle save -env env.yaml -o images.tar
+//	testenv bundle save -compose docker-compose.yml -o images.tar
+//	testenv bundle load images.tar
+//
+// "bundle save" pulls and builds images of all containers of the environment
+// and saves them into a single tar archive. "bundle load" loads the archive
+// into the local docker daemon, so tests can run with $TESTENV_OFFLINE set on
+// hosts without registry access. Environment files referencing Go hooks
+// can't be bundled, as hooks are registered by test code.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/pkg/errors"
+	"github.com/saturn4er/go-testenv"
+	"go.uber.org/multierr"
+)
+
+const usage = `Usage:
+  testenv bundle save (-env FILE | -compose FILE) [-o FILE]
+  testenv bundle load FILE
+`
+
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	if err := run(ctx, os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "testenv:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, stdout io.Writer) error {
+	if len(args) < 2 || args[0] != "bundle" {
+		return errors.New("unknown command\n" + usage)
+	}
+
+	switch args[1] {
+	case "save":
+		return saveBundle(ctx, args[2:], stdout)
+	case "load":
+		return loadBundle(ctx, args[2:], stdout)
+	}
+	return errors.Errorf("unknown bundle command %q\n%s", args[1], usage)
+}
+
+func saveBundle(ctx context.Context, args []string, stdout io.Writer) (err error) {
+	flags := flag.NewFlagSet("bundle save", flag.ContinueOnError)
+	envFile := flags.String("env", "", "environment file")
+	composeFile := flags.String("compose", "", "docker-compose file")
+	output := flags.String("o", "testenv-images.tar", "bundle file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var desc testenv.ProjectEnvDesc
+	switch {
+	case *envFile != "" && *composeFile != "":
+		return errors.New("-env and -compose are mutually exclusive")
+	case *envFile != "":
+		desc, err = testenv.LoadProjectEnvDesc(*envFile, nil)
+	case *composeFile != "":
+		desc, err = testenv.FromCompose(*composeFile, testenv.ComposeOptions{})
+	default:
+		return errors.New("either -env or -compose must be set")
+	}
+	if err != nil {
+		return err
+	}
+
+	projectEnv, err := testenv.NewProjectEnv(desc)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = multierr.Append(err, projectEnv.Close())
+	}()
+
+	images, err := projectEnv.SaveImageBundleFile(ctx, *output)
+	if err != nil {
+		return err
+	}
+	for _, image := range images {
+		fmt.Fprintln(stdout, "Saved", image)
+	}
+	return nil
+}
+
+func loadBundle(ctx context.Context, args []string, stdout io.Writer) (err error) {
+	flags := flag.NewFlagSet("bundle load", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("bundle file must be set\n" + usage)
+	}
+
+	projectEnv, err := testenv.NewProjectEnv(testenv.ProjectEnvDesc{})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = multierr.Append(err, projectEnv.Close())
+	}()
+
+	images, err := projectEnv.LoadImageBundleFile(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	for _, image := range images {
+		fmt.Fprintln(stdout, "Loaded", image)
+	}
+	return nil
+}
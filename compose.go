@@ -0,0 +1,875 @@
+package testenv
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/saturn4er/go-testenv/docker"
+	"go.uber.org/multierr"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	composeDefaultNetwork = "default"
+	// defaults of docker healthchecks
+	composeDefaultHealthcheckDuration = 30 * time.Second
+	composeDefaultHealthcheckRetries  = 3
+)
+
+// ComposeOptions configures FromCompose. Services, networks and volumes not
+// listed in the TestCase fields go to the project scope.
+type ComposeOptions struct {
+	TestCaseServices []string
+	TestCaseNetworks []string
+	TestCaseVolumes  []string
+}
+
+// FromCompose translates services, networks and volumes of a docker-compose
+// file into a ProjectEnvDesc. ${VAR} and ${VAR:-default} in values are
+// expanded from the environment, relative paths are resolved against the file
+// directory. Service keys FromCompose doesn't support are rejected, except
+// for x- extensions.
+// Services without networks join the "default" network, and every service is
+// reachable by its name on its networks.
+func FromCompose(path string, opts ComposeOptions) (ProjectEnvDesc, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ProjectEnvDesc{}, errors.WithStack(err)
+	}
+
+	desc, err := parseCompose(data, filepath.Dir(path), opts)
+	return desc, errors.Wrapf(err, "failed to import %s", path)
+}
+
+type composeFile struct {
+	Services map[string]composeService  `yaml:"services"`
+	Networks map[string]*composeNetwork `yaml:"networks"`
+	Volumes  map[string]*composeVolume  `yaml:"volumes"`
+}
+
+type composeService struct {
+	Image       string                 `yaml:"image"`
+	PullPolicy  string                 `yaml:"pull_policy"`
+	Build       *composeBuild          `yaml:"build"`
+	Command     composeCommand         `yaml:"command"`
+	Environment composeMapping         `yaml:"environment"`
+	Labels      composeMapping         `yaml:"labels"`
+	Ports       []composePort          `yaml:"ports"`
+	Expose      []string               `yaml:"expose"`
+	Networks    composeServiceNetworks `yaml:"networks"`
+	Volumes     []composeServiceVolume `yaml:"volumes"`
+	Tmpfs       composeCommand         `yaml:"tmpfs"`
+	DependsOn   composeDependsOn       `yaml:"depends_on"`
+	Healthcheck *composeHealthcheck    `yaml:"healthcheck"`
+
+	unsupported []string
+}
+
+// composeServiceKeys are keys of composeService fields.
+var composeServiceKeys = func() map[string]bool {
+	keys := map[string]bool{}
+	serviceType := reflect.TypeOf(composeService{})
+	for i := 0; i < serviceType.NumField(); i++ {
+		if key := serviceType.Field(i).Tag.Get("yaml"); key != "" {
+			keys[key] = true
+		}
+	}
+	return keys
+}()
+
+func (s *composeService) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain composeService
+	if err := unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+
+	var keys map[string]interface{}
+	if err := unmarshal(&keys); err != nil {
+		return err
+	}
+	for key := range keys {
+		// x- keys are compose extensions
+		if !composeServiceKeys[key] && !strings.HasPrefix(key, "x-") {
+			s.unsupported = append(s.unsupported, key)
+		}
+	}
+	sort.Strings(s.unsupported)
+	return nil
+}
+
+type composeBuild struct {
+	Context          string         `yaml:"context"`
+	Dockerfile       string         `yaml:"dockerfile"`
+	DockerfileInline string         `yaml:"dockerfile_inline"`
+	Args             composeMapping `yaml:"args"`
+	Labels           composeMapping `yaml:"labels"`
+	Target           string         `yaml:"target"`
+	Platform         string         `yaml:"platform"`
+	NoCache          bool           `yaml:"no_cache"`
+	Pull             bool           `yaml:"pull"`
+}
+
+func (b *composeBuild) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&b.Context); err == nil {
+		return nil
+	}
+	type plain composeBuild
+	return unmarshal((*plain)(b))
+}
+
+type composeNetwork struct {
+	Labels   composeMapping `yaml:"labels"`
+	External bool           `yaml:"external"`
+}
+
+type composeVolume struct {
+	Driver     string            `yaml:"driver"`
+	DriverOpts map[string]string `yaml:"driver_opts"`
+	Labels     composeMapping    `yaml:"labels"`
+	External   bool              `yaml:"external"`
+}
+
+// composeCommand is either a string split like a shell does or a list.
+type composeCommand []string
+
+func (c *composeCommand) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var command string
+	if err := unmarshal(&command); err == nil {
+		words, err := splitShellWords(command)
+		*c = words
+		return err
+	}
+	return unmarshal((*[]string)(c))
+}
+
+// composeMapping is either a map or a list of KEY=VALUE items.
+type composeMapping map[string]string
+
+func (m *composeMapping) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var items []string
+	if err := unmarshal(&items); err == nil {
+		*m = make(composeMapping, len(items))
+		for _, item := range items {
+			idx := strings.IndexByte(item, '=')
+			if idx == -1 {
+				(*m)[item] = os.Getenv(item)
+				continue
+			}
+			(*m)[item[:idx]] = item[idx+1:]
+		}
+		return nil
+	}
+
+	var values map[string]*string
+	if err := unmarshal(&values); err != nil {
+		return err
+	}
+	*m = make(composeMapping, len(values))
+	for key, value := range values {
+		if value == nil {
+			(*m)[key] = os.Getenv(key)
+			continue
+		}
+		(*m)[key] = *value
+	}
+	return nil
+}
+
+type composePort struct {
+	HostIP    string
+	Published string
+	Target    string
+	Protocol  string
+}
+
+func (p *composePort) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var short string
+	if err := unmarshal(&short); err == nil {
+		return p.parse(short)
+	}
+
+	var long struct {
+		Target    string `yaml:"target"`
+		Published string `yaml:"published"`
+		HostIP    string `yaml:"host_ip"`
+		Protocol  string `yaml:"protocol"`
+	}
+	if err := unmarshal(&long); err != nil {
+		return err
+	}
+	*p = composePort{HostIP: long.HostIP, Published: long.Published, Target: long.Target, Protocol: long.Protocol}
+	return nil
+}
+
+// parse parses [[HOST_IP:]PUBLISHED:]TARGET[/PROTOCOL].
+func (p *composePort) parse(value string) error {
+	spec := value
+	if idx := strings.LastIndexByte(spec, '/'); idx != -1 {
+		p.Protocol = spec[idx+1:]
+		spec = spec[:idx]
+	}
+
+	parts := strings.Split(spec, ":")
+	switch len(parts) {
+	case 1:
+		p.Target = parts[0]
+	case 2:
+		p.Published, p.Target = parts[0], parts[1]
+	case 3:
+		p.HostIP, p.Published, p.Target = parts[0], parts[1], parts[2]
+	default:
+		return errors.Errorf("invalid port %q", value)
+	}
+	if strings.Contains(spec, "-") {
+		return errors.Errorf("port ranges are not supported: %q", value)
+	}
+	return nil
+}
+
+func (p composePort) containerPort() string {
+	if p.Protocol == "" || p.Protocol == "tcp" {
+		return p.Target
+	}
+	return p.Target + "/" + p.Protocol
+}
+
+// composeServiceNetworks is either a list of names or a map with aliases.
+type composeServiceNetworks map[string]*struct {
+	Aliases []string `yaml:"aliases"`
+}
+
+func (n *composeServiceNetworks) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var names []string
+	if err := unmarshal(&names); err == nil {
+		*n = make(composeServiceNetworks, len(names))
+		for _, name := range names {
+			(*n)[name] = nil
+		}
+		return nil
+	}
+	type plain composeServiceNetworks
+	return unmarshal((*plain)(n))
+}
+
+type composeServiceVolume struct {
+	Type      string
+	Source    string
+	Target    string
+	ReadOnly  bool
+	TmpfsSize int64
+}
+
+func (v *composeServiceVolume) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var short string
+	if err := unmarshal(&short); err == nil {
+		return v.parse(short)
+	}
+
+	var long struct {
+		Type     string `yaml:"type"`
+		Source   string `yaml:"source"`
+		Target   string `yaml:"target"`
+		ReadOnly bool   `yaml:"read_only"`
+		Tmpfs    struct {
+			Size int64 `yaml:"size"`
+		} `yaml:"tmpfs"`
+	}
+	if err := unmarshal(&long); err != nil {
+		return err
+	}
+	*v = composeServiceVolume{
+		Type:      long.Type,
+		Source:    long.Source,
+		Target:    long.Target,
+		ReadOnly:  long.ReadOnly,
+		TmpfsSize: long.Tmpfs.Size,
+	}
+	return nil
+}
+
+// parse parses [SOURCE:]TARGET[:MODE].
+func (v *composeServiceVolume) parse(value string) error {
+	parts := strings.Split(value, ":")
+	switch len(parts) {
+	case 1:
+		v.Target = parts[0]
+	case 2:
+		v.Source, v.Target = parts[0], parts[1]
+	case 3:
+		v.Source, v.Target = parts[0], parts[1]
+		for _, mode := range strings.Split(parts[2], ",") {
+			if mode == "ro" {
+				v.ReadOnly = true
+			}
+		}
+	default:
+		return errors.Errorf("invalid volume %q", value)
+	}
+
+	v.Type = string(docker.MountTypeVolume)
+	if strings.HasPrefix(v.Source, "/") || strings.HasPrefix(v.Source, ".") || strings.HasPrefix(v.Source, "~") {
+		v.Type = string(docker.MountTypeBind)
+	}
+	return nil
+}
+
+// composeDependsOn is either a list of services or a map with conditions.
+type composeDependsOn map[string]string
+
+func (d *composeDependsOn) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var names []string
+	if err := unmarshal(&names); err == nil {
+		*d = make(composeDependsOn, len(names))
+		for _, name := range names {
+			(*d)[name] = "service_started"
+		}
+		return nil
+	}
+
+	var conditions map[string]struct {
+		Condition string `yaml:"condition"`
+	}
+	if err := unmarshal(&conditions); err != nil {
+		return err
+	}
+	*d = make(composeDependsOn, len(conditions))
+	for name, condition := range conditions {
+		(*d)[name] = condition.Condition
+	}
+	return nil
+}
+
+type composeHealthcheck struct {
+	Test        composeHealthcheckTest `yaml:"test"`
+	Interval    string                 `yaml:"interval"`
+	Timeout     string                 `yaml:"timeout"`
+	Retries     int                    `yaml:"retries"`
+	StartPeriod string                 `yaml:"start_period"`
+	Disable     bool                   `yaml:"disable"`
+}
+
+// composeHealthcheckTest is either a list or a string, which is run by the
+// shell as is, like CMD-SHELL.
+type composeHealthcheckTest []string
+
+func (c *composeHealthcheckTest) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var command string
+	if err := unmarshal(&command); err == nil {
+		*c = composeHealthcheckTest{"CMD-SHELL", command}
+		return nil
+	}
+	return unmarshal((*[]string)(c))
+}
+
+func parseCompose(data []byte, dir string, opts ComposeOptions) (ProjectEnvDesc, error) {
+	var file composeFile
+	if err := unmarshalCompose(data, &file); err != nil {
+		return ProjectEnvDesc{}, errors.Wrap(err, "failed to parse compose file")
+	}
+
+	desc := ProjectEnvDesc{
+		Networks:   map[string]NetworkDesc{},
+		Volumes:    map[string]VolumeDesc{},
+		Containers: map[string]ContainerDesc{},
+		TestCaseEnv: TestCaseEnvDesc{
+			Networks:   map[string]NetworkDesc{},
+			Volumes:    map[string]VolumeDesc{},
+			Containers: map[string]*ContainerDesc{},
+		},
+	}
+
+	var err error
+	for _, name := range sortedComposeKeys(file.Networks) {
+		network := file.Networks[name]
+		if network == nil {
+			network = &composeNetwork{}
+		}
+		if network.External {
+			err = multierr.Append(err, errors.Errorf("external network %s is not supported", name))
+			continue
+		}
+
+		networkDesc := NetworkDesc{Labels: staticComposeStrings(network.Labels)}
+		if containsString(opts.TestCaseNetworks, name) {
+			desc.TestCaseEnv.Networks[name] = networkDesc
+		} else {
+			desc.Networks[name] = networkDesc
+		}
+	}
+
+	for _, name := range sortedComposeKeys(file.Volumes) {
+		volume := file.Volumes[name]
+		if volume == nil {
+			volume = &composeVolume{}
+		}
+		if volume.External {
+			err = multierr.Append(err, errors.Errorf("external volume %s is not supported", name))
+			continue
+		}
+
+		volumeDesc := VolumeDesc{
+			Driver:  volume.Driver,
+			Options: volume.DriverOpts,
+			Labels:  staticComposeStrings(volume.Labels),
+		}
+		if containsString(opts.TestCaseVolumes, name) {
+			desc.TestCaseEnv.Volumes[name] = volumeDesc
+		} else {
+			desc.Volumes[name] = volumeDesc
+		}
+	}
+
+	for _, name := range sortedComposeKeys(file.Services) {
+		testCase := containsString(opts.TestCaseServices, name)
+		container, convertErr := convertComposeService(name, file.Services[name], dir, testCase, &desc, opts)
+		if convertErr != nil {
+			err = multierr.Append(err, errors.Wrapf(convertErr, "service %s", name))
+			continue
+		}
+
+		if testCase {
+			desc.TestCaseEnv.Containers[name] = &container
+		} else {
+			desc.Containers[name] = container
+		}
+	}
+
+	if err != nil {
+		return ProjectEnvDesc{}, err
+	}
+	return desc, nil
+}
+
+// unmarshalCompose expands variables in values of the parsed file rather than
+// in its raw text, so that comments are left alone and values can't change
+// the file structure.
+func unmarshalCompose(data []byte, file *composeFile) error {
+	var tree interface{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return err
+	}
+	expanded, err := yaml.Marshal(expandComposeValues(tree))
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(expanded, file)
+}
+
+func convertComposeService(name string, service composeService, dir string, testCase bool, desc *ProjectEnvDesc, opts ComposeOptions) (ContainerDesc, error) {
+	if len(service.unsupported) != 0 {
+		var err error
+		for _, key := range service.unsupported {
+			err = multierr.Append(err, errors.Errorf("%s is not supported", key))
+		}
+		return ContainerDesc{}, err
+	}
+
+	container := ContainerDesc{
+		Cmd:    service.Command,
+		Envs:   staticComposeStrings(service.Environment),
+		Labels: staticComposeStrings(service.Labels),
+	}
+
+	switch {
+	case service.Build != nil:
+		container.Image = BuildImage(ImageDesc{
+			Dockerfile:        service.Build.Dockerfile,
+			DockerfileContent: service.Build.DockerfileInline,
+			ContextDir:        composePath(dir, service.Build.Context),
+			Labels:            staticComposeStrings(service.Build.Labels),
+			BuildArgs:         staticComposeStrings(service.Build.Args),
+			Target:            service.Build.Target,
+			Platform:          service.Build.Platform,
+			NoCache:           service.Build.NoCache,
+			Pull:              service.Build.Pull,
+		})
+	case service.Image != "":
+		container.Image = ExternalImage(service.Image)
+	default:
+		return ContainerDesc{}, errors.New("either image or build must be set")
+	}
+
+	switch service.PullPolicy {
+	case "", "missing", "if_not_present", "build":
+	case "always":
+		container.PullPolicy = PullAlways
+	case "never":
+		container.PullPolicy = PullNever
+	default:
+		return ContainerDesc{}, errors.Errorf("unknown pull policy %q", service.PullPolicy)
+	}
+
+	for _, port := range service.Expose {
+		container.ExposedPorts = append(container.ExposedPorts, StringValue(port))
+	}
+	for _, port := range service.Ports {
+		container.ExposedPorts = append(container.ExposedPorts, StringValue(port.containerPort()))
+		if port.Published != "" {
+			container.PortBindings = append(container.PortBindings, PortBinding{
+				ContainerPort: StringValue(port.containerPort()),
+				Host:          StringValue(port.HostIP),
+				Port:          StringValue(port.Published),
+			})
+		}
+	}
+
+	networks := service.Networks
+	if len(networks) == 0 {
+		networks = composeServiceNetworks{composeDefaultNetwork: nil}
+	}
+	for _, networkName := range sortedComposeKeys(networks) {
+		resolver, err := composeNetworkResolver(networkName, testCase, desc, opts)
+		if err != nil {
+			return ContainerDesc{}, err
+		}
+		aliases := []string{name}
+		if network := networks[networkName]; network != nil {
+			aliases = append(aliases, network.Aliases...)
+		}
+		for _, alias := range aliases {
+			container.Networks = append(container.Networks, ContainerNetwork{
+				Network: resolver,
+				Alias:   alias,
+			})
+		}
+	}
+
+	for i, volume := range service.Volumes {
+		mount := Mount{
+			Type:      docker.MountType(volume.Type),
+			Target:    volume.Target,
+			ReadOnly:  volume.ReadOnly,
+			TmpfsSize: volume.TmpfsSize,
+		}
+		switch mount.Type {
+		case docker.MountTypeBind:
+			mount.Source = StringValue(composePath(dir, volume.Source))
+		case docker.MountTypeVolume:
+			volumeName := volume.Source
+			if volumeName == "" {
+				// anonymous volume lives as long as the container scope
+				volumeName = name + "-" + strconv.Itoa(i)
+				if testCase {
+					desc.TestCaseEnv.Volumes[volumeName] = VolumeDesc{}
+				} else {
+					desc.Volumes[volumeName] = VolumeDesc{}
+				}
+			}
+			resolver, err := composeVolumeResolver(volumeName, testCase, desc)
+			if err != nil {
+				return ContainerDesc{}, err
+			}
+			mount.Volume = resolver
+		case docker.MountTypeTmpfs:
+		default:
+			return ContainerDesc{}, errors.Errorf("unsupported volume type %q", volume.Type)
+		}
+		container.Mounts = append(container.Mounts, mount)
+	}
+	for _, target := range service.Tmpfs {
+		container.Mounts = append(container.Mounts, TmpfsMount(target, 0))
+	}
+
+	for _, dependency := range sortedComposeKeys(service.DependsOn) {
+		container.DependsOn = append(container.DependsOn, dependency)
+
+		var condition DependencyCondition
+		switch service.DependsOn[dependency] {
+		case "", "service_started":
+			condition = DependencyStarted
+		case "service_healthy":
+			condition = DependencyHealthy
+		case "service_completed_successfully":
+			condition = DependencyCompletedSuccessfully
+		default:
+			return ContainerDesc{}, errors.Errorf("unknown condition %q of dependency %s", service.DependsOn[dependency], dependency)
+		}
+		if condition != DependencyStarted {
+			if container.DependsOnConditions == nil {
+				container.DependsOnConditions = map[string]DependencyCondition{}
+			}
+			container.DependsOnConditions[dependency] = condition
+		}
+	}
+
+	if healthcheck := service.Healthcheck; healthcheck != nil && !healthcheck.Disable {
+		strategy, options, err := composeHealthcheckStrategy(healthcheck)
+		if err != nil {
+			return ContainerDesc{}, errors.Wrap(err, "invalid healthcheck")
+		}
+		container.WaitStrategy = strategy
+		container.HealthCheckOptions = options
+	}
+
+	return container, nil
+}
+
+// composeHealthcheckStrategy runs the healthcheck test until it succeeds.
+// timeout bounds every run of the test. If timeout, retries or start_period
+// is set, waiting is aborted after start_period + retries * (interval +
+// timeout), when docker would mark the container unhealthy.
+func composeHealthcheckStrategy(healthcheck *composeHealthcheck) (WaitStrategy, HealthCheckOptions, error) {
+	var options HealthCheckOptions
+	test := healthcheck.Test
+	if len(test) == 0 {
+		return nil, options, errors.New("test is empty")
+	}
+
+	var cmd []string
+	switch test[0] {
+	case "NONE":
+		return nil, options, nil
+	case "CMD":
+		cmd = test[1:]
+	case "CMD-SHELL":
+		cmd = []string{"sh", "-c", strings.Join(test[1:], " ")}
+	default:
+		cmd = []string{"sh", "-c", strings.Join(test, " ")}
+	}
+
+	interval, err := parseComposeDuration("interval", healthcheck.Interval)
+	if err != nil {
+		return nil, options, err
+	}
+	timeout, err := parseComposeDuration("timeout", healthcheck.Timeout)
+	if err != nil {
+		return nil, options, err
+	}
+	startPeriod, err := parseComposeDuration("start_period", healthcheck.StartPeriod)
+	if err != nil {
+		return nil, options, err
+	}
+
+	strategy := WaitForExec(cmd...)
+	strategy.PollInterval = interval
+	strategy.Timeout = timeout
+	options.Interval = interval
+	if healthcheck.Retries > 0 || timeout > 0 || startPeriod > 0 {
+		retries := healthcheck.Retries
+		if retries == 0 {
+			retries = composeDefaultHealthcheckRetries
+		}
+		if interval == 0 {
+			interval = composeDefaultHealthcheckDuration
+		}
+		if timeout == 0 {
+			timeout = composeDefaultHealthcheckDuration
+		}
+		options.Timeout = startPeriod + time.Duration(retries)*(interval+timeout)
+	}
+	return strategy, options, nil
+}
+
+func parseComposeDuration(name, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(value)
+	return duration, errors.Wrapf(err, "invalid %s", name)
+}
+
+func composeNetworkResolver(name string, testCase bool, desc *ProjectEnvDesc, opts ComposeOptions) (NetworkResolver, error) {
+	_, inProject := desc.Networks[name]
+	_, inTestCase := desc.TestCaseEnv.Networks[name]
+	if name == composeDefaultNetwork && !inProject && !inTestCase {
+		// the default network is implicit in compose files
+		if containsString(opts.TestCaseNetworks, name) {
+			desc.TestCaseEnv.Networks[name] = NetworkDesc{}
+		} else {
+			desc.Networks[name] = NetworkDesc{}
+		}
+	}
+
+	if _, ok := desc.TestCaseEnv.Networks[name]; ok {
+		if !testCase {
+			return nil, errors.Errorf("network %s is in test case scope", name)
+		}
+		return TestCaseNetwork(name), nil
+	}
+	if _, ok := desc.Networks[name]; ok {
+		return ProjectNetwork(name), nil
+	}
+	return nil, errors.Errorf("undefined network %s", name)
+}
+
+func composeVolumeResolver(name string, testCase bool, desc *ProjectEnvDesc) (VolumeResolver, error) {
+	if _, ok := desc.TestCaseEnv.Volumes[name]; ok {
+		if !testCase {
+			return nil, errors.Errorf("volume %s is in test case scope", name)
+		}
+		return TestCaseVolume(name), nil
+	}
+	if _, ok := desc.Volumes[name]; ok {
+		return ProjectVolume(name), nil
+	}
+	return nil, errors.Errorf("undefined volume %s", name)
+}
+
+func composePath(dir string, path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func staticComposeStrings(values map[string]string) StringsMap {
+	if len(values) == 0 {
+		return nil
+	}
+	result := make(StringsMap, len(values))
+	for key, value := range values {
+		result[key] = StringValue(value)
+	}
+	return result
+}
+
+// sortedComposeKeys returns sorted keys of a map with string keys.
+func sortedComposeKeys(m interface{}) []string {
+	keys := reflect.ValueOf(m).MapKeys()
+	result := make([]string, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, key.String())
+	}
+	sort.Strings(result)
+	return result
+}
+
+// expandComposeValues expands variables in string values of a parsed compose
+// file. Numbers and booleans produced by the expansion are typed like YAML
+// would type them, e.g. for tmpfs sizes.
+func expandComposeValues(value interface{}) interface{} {
+	switch value := value.(type) {
+	case string:
+		expanded := expandComposeEnv(value)
+		if expanded == value {
+			return value
+		}
+		if n, err := strconv.ParseInt(expanded, 10, 64); err == nil && strconv.FormatInt(n, 10) == expanded {
+			return n
+		}
+		if expanded == "true" || expanded == "false" {
+			return expanded == "true"
+		}
+		return expanded
+	case map[interface{}]interface{}:
+		for key, item := range value {
+			value[key] = expandComposeValues(item)
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = expandComposeValues(item)
+		}
+	}
+	return value
+}
+
+// expandComposeEnv replaces $VAR, ${VAR}, ${VAR:-default} and ${VAR-default}
+// with values of environment variables, "$$" is a literal dollar sign.
+func expandComposeEnv(data string) string {
+	var result strings.Builder
+	for i := 0; i < len(data); i++ {
+		if data[i] != '$' || i+1 == len(data) {
+			result.WriteByte(data[i])
+			continue
+		}
+
+		switch next := data[i+1]; {
+		case next == '$':
+			result.WriteByte('$')
+			i++
+		case next == '{':
+			end := strings.IndexByte(data[i:], '}')
+			if end == -1 {
+				result.WriteByte(data[i])
+				continue
+			}
+			result.WriteString(expandComposeVariable(data[i+2 : i+end]))
+			i += end
+		case next == '_' || next >= 'A' && next <= 'Z' || next >= 'a' && next <= 'z':
+			end := i + 1
+			for end < len(data) && (data[end] == '_' || data[end] >= 'A' && data[end] <= 'Z' ||
+				data[end] >= 'a' && data[end] <= 'z' || data[end] >= '0' && data[end] <= '9') {
+				end++
+			}
+			result.WriteString(os.Getenv(data[i+1 : end]))
+			i = end - 1
+		default:
+			result.WriteByte(data[i])
+		}
+	}
+	return result.String()
+}
+
+func expandComposeVariable(expr string) string {
+	if idx := strings.Index(expr, ":-"); idx != -1 {
+		if value := os.Getenv(expr[:idx]); value != "" {
+			return value
+		}
+		return expr[idx+2:]
+	}
+	if idx := strings.IndexByte(expr, '-'); idx != -1 {
+		if value, ok := os.LookupEnv(expr[:idx]); ok {
+			return value
+		}
+		return expr[idx+1:]
+	}
+	return os.Getenv(expr)
+}
+
+// splitShellWords splits command like a POSIX shell does, supporting quotes
+// and backslash escapes.
+func splitShellWords(command string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		quote   byte
+		escaped bool
+	)
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case escaped:
+			word.WriteByte(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteByte(c)
+			}
+		case c == '\'' || c == '"':
+			quote, inWord = c, true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.Errorf("unterminated quote in %q", command)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,102 @@
+package testenv_test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/saturn4er/go-testenv"
+	"github.com/saturn4er/go-testenv/docker"
+	"github.com/saturn4er/go-testenv/fake"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromCompose(t *testing.T) {
+	require.NoError(t, os.Setenv("TESTENV_COMPOSE_HOST", "10.0.0.1 # advertised"))
+	defer os.Unsetenv("TESTENV_COMPOSE_HOST")
+	require.NoError(t, os.Setenv("TESTENV_COMPOSE_COMMENT", "\nservices: ["))
+	defer os.Unsetenv("TESTENV_COMPOSE_COMMENT")
+
+	desc, err := testenv.FromCompose("testdata/docker-compose.yml", testenv.ComposeOptions{
+		TestCaseServices: []string{"postgres"},
+	})
+	require.NoError(t, err)
+	require.Len(t, desc.Networks, 2)
+	require.Len(t, desc.Volumes, 2)
+	require.Len(t, desc.Containers, 2)
+	require.Len(t, desc.TestCaseEnv.Containers, 1)
+	require.Equal(t, []string{"zookeeper"}, desc.Containers["kafka"].DependsOn)
+	require.Equal(t, testenv.DependencyHealthy, desc.Containers["kafka"].DependsOnConditions["zookeeper"])
+	require.NotNil(t, desc.TestCaseEnv.Containers["postgres"].WaitStrategy)
+	require.Equal(t, testenv.HealthCheckOptions{}, desc.Containers["zookeeper"].HealthCheckOptions)
+	require.Equal(t, testenv.HealthCheckOptions{Interval: time.Second, Timeout: 28 * time.Second},
+		desc.TestCaseEnv.Containers["postgres"].HealthCheckOptions)
+	require.Equal(t, 5*time.Second, desc.TestCaseEnv.Containers["postgres"].WaitStrategy.(*testenv.ExecWaitStrategy).Timeout)
+
+	backend := fake.NewBackend()
+	var healthchecksMx sync.Mutex
+	healthchecks := map[string][]string{}
+	backend.ExecHandler = func(container *docker.Container, params docker.ExecParams) (*docker.ExecResult, error) {
+		healthchecksMx.Lock()
+		healthchecks[container.Image] = params.Cmd
+		healthchecksMx.Unlock()
+		return &docker.ExecResult{}, nil
+	}
+	projectEnv := testenv.NewProjectEnvWithBackendT(t, desc, backend)
+	testCaseEnv := projectEnv.NewTestCaseEnvT(t)
+
+	zookeeper, ok := backend.ContainerParams(projectEnv.MustContainer("zookeeper").ID())
+	require.True(t, ok)
+	require.Equal(t, "zookeeper:3.4.13", zookeeper.Image)
+
+	kafka, ok := backend.ContainerParams(projectEnv.MustContainer("kafka").ID())
+	require.True(t, ok)
+	require.Equal(t, []string{"start-kafka.sh", "--override", "log.dirs=/kafka logs"}, kafka.Cmd)
+	require.Equal(t, map[string]string{
+		"KAFKA_ZOOKEEPER_CONNECT":    "zookeeper:2181",
+		"KAFKA_ADVERTISED_HOST_NAME": "10.0.0.1 # advertised",
+	}, kafka.Envs)
+	require.Equal(t, []string{"9092", "9094"}, kafka.ExposedPorts)
+	require.Equal(t, map[string][]docker.PortBinding{
+		"9092": {{Host: "127.0.0.1", Port: "9093"}},
+	}, kafka.PortBindings)
+	require.Len(t, kafka.Networks, 2)
+	var aliases []string
+	for _, network := range kafka.Networks {
+		aliases = append(aliases, network.Aliases...)
+	}
+	require.ElementsMatch(t, []string{"kafka", "kafka", "broker"}, aliases)
+
+	initDir, err := filepath.Abs("testdata/init")
+	require.NoError(t, err)
+	require.Len(t, kafka.Mounts, 5)
+	require.Equal(t, docker.Mount{Type: docker.MountTypeBind, Source: initDir, Target: "/init", ReadOnly: true}, kafka.Mounts[0])
+	require.Equal(t, docker.MountTypeVolume, kafka.Mounts[2].Type)
+	require.Equal(t, "/var/lib/kafka", kafka.Mounts[2].Target)
+	require.Equal(t, docker.Mount{Type: docker.MountTypeTmpfs, Target: "/cache", ReadOnly: true, TmpfsSize: 1024}, kafka.Mounts[3])
+	require.Equal(t, docker.Mount{Type: docker.MountTypeTmpfs, Target: "/tmp"}, kafka.Mounts[4])
+
+	postgres, ok := testCaseEnv.Container("postgres")
+	require.True(t, ok)
+	postgresParams, ok := backend.ContainerParams(postgres.ID())
+	require.True(t, ok)
+	require.Equal(t, map[string]string{"POSTGRES_PASSWORD": "secret"}, postgresParams.Envs)
+
+	healthchecksMx.Lock()
+	defer healthchecksMx.Unlock()
+	require.Equal(t, map[string][]string{
+		"zookeeper:3.4.13": {"sh", "-c", "echo ruok | nc localhost 2181 | grep -q 'imok'"},
+		"postgres":         {"sh", "-c", "pg_isready -U postgres"},
+	}, healthchecks)
+}
+
+func TestFromComposeRejectsUnsupportedFeatures(t *testing.T) {
+	_, err := testenv.FromCompose("testdata/compose-unsupported.yml", testenv.ComposeOptions{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "external network shared is not supported")
+	require.Contains(t, err.Error(), "entrypoint is not supported")
+	require.Contains(t, err.Error(), "user is not supported")
+	require.NotContains(t, err.Error(), "x-owner")
+}
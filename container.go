@@ -1,16 +1,36 @@
 package testenv
 
 import (
-	dc "github.com/ory/dockertest/docker"
+	"context"
+	"time"
+
 	"github.com/pkg/errors"
 	"github.com/saturn4er/go-testenv/docker"
 )
 
-type HealthCheck func() (bool, error)
-
 type ContainerHooks struct {
-	BeforeRun func(project *ProjectEnv, testCase *TestCaseEnv) error
-	AfterRun  func(project *ProjectEnv, testCase *TestCaseEnv) error
+	BeforeRun func(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv) error
+	AfterRun  func(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv) error
+}
+
+// runHook calls hook if it is set and reports its duration.
+func runHook(
+	ctx context.Context,
+	project *ProjectEnv,
+	testCase *TestCaseEnv,
+	name, hookName string,
+	hook func(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv) error,
+) error {
+	if hook == nil {
+		return nil
+	}
+
+	started := time.Now()
+	spanCtx, span := startSpan(ctx, project, testCase, "testenv.hook", attrName.String(name), attrHook.String(hookName))
+	err := hook(spanCtx, project, testCase)
+	endSpan(span, err)
+	emit(project, testCase, Event{Type: EventHookFinished, Name: name, Hook: hookName, Duration: time.Since(started), Err: err})
+	return err
 }
 
 type PortBinding struct {
@@ -20,36 +40,64 @@ type PortBinding struct {
 }
 
 type ContainerDesc struct {
-	Image        ImageResolver
-	HealthCheck  *HealthCheck
-	Envs         map[string]StringValueResolver
-	ExposedPorts []StringValueResolver
-	Networks     []ContainerNetwork
-	Labels       map[string]StringValueResolver
-	Cmd          []string
-	Hooks        ContainerHooks
-	PortBindings []PortBinding
+	Image               ImageResolver
+	PullPolicy          PullPolicy
+	HealthCheck         *HealthCheck
+	HealthCheckOptions  HealthCheckOptions
+	Envs                map[string]StringValueResolver
+	ExposedPorts        []StringValueResolver
+	Networks            []ContainerNetwork
+	Labels              map[string]StringValueResolver
+	Cmd                 []string
+	Hooks               ContainerHooks
+	PortBindings        []PortBinding
+	WaitStrategy        WaitStrategy
+	DependsOn           []string
+	DependsOnConditions map[string]DependencyCondition
+	CaptureLogs         bool
+	Mounts              []Mount
+	Files               []ContainerFile
 }
 
-func (c ContainerDesc) run(project *ProjectEnv, testCase *TestCaseEnv) (*dc.Container, error) {
-	if c.Hooks.BeforeRun != nil {
-		if err := c.Hooks.BeforeRun(project, testCase); err != nil {
-			return nil, errors.Wrap(err, "failed to process 'BeforeRun' hook")
-		}
+func (c ContainerDesc) run(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv, name string) (_ *Container, err error) {
+	ctx, span := startContainerSpan(ctx, project, testCase, name)
+	defer func() { endSpan(span, err) }()
+
+	container, err := c.start(ctx, project, testCase, name)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attrContainerID.String(container.ID()))
+
+	if err := c.ready(ctx, project, testCase, name, container); err != nil {
+		return nil, err
+	}
+
+	return container, nil
+}
+
+func (c ContainerDesc) start(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv, name string) (*Container, error) {
+	if err := runHook(ctx, project, testCase, name, "BeforeRun", c.Hooks.BeforeRun); err != nil {
+		return nil, errors.Wrap(err, "failed to process 'BeforeRun' hook")
 	}
-	image, err := c.Image(project, nil)
+	resolveStarted := time.Now()
+	resolveCtx, resolveSpan := startSpan(ctx, project, testCase, "testenv.image.resolve", attrName.String(name))
+	image, err := c.Image(resolveCtx, project, testCase)
+	resolveSpan.SetAttributes(attrImage.String(image))
+	endSpan(resolveSpan, err)
+	emit(project, testCase, Event{Type: EventImageResolved, Name: name, Image: image, Duration: time.Since(resolveStarted), Err: err})
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to resolve image")
 	}
 
 	networks := map[string]docker.RunContainerNetworkConfig{}
 	for _, containerNetwork := range c.Networks {
-		network, err := containerNetwork.Network(project, testCase)
+		network, err := containerNetwork.Network(ctx, project, testCase)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to resolve network")
 		}
 
-		cfg := docker.RunContainerNetworkConfig{}
+		cfg := networks[network]
 		if containerNetwork.Alias != "" {
 			cfg.Aliases = append(cfg.Aliases, containerNetwork.Alias)
 		}
@@ -59,7 +107,7 @@ func (c ContainerDesc) run(project *ProjectEnv, testCase *TestCaseEnv) (*dc.Cont
 
 	labels := make(map[string]string)
 	for labelName, labelValueResolver := range c.Labels {
-		value, err := labelValueResolver(project, testCase)
+		value, err := labelValueResolver(ctx, project, testCase)
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to resolve label %s value", labelName)
 		}
@@ -68,7 +116,7 @@ func (c ContainerDesc) run(project *ProjectEnv, testCase *TestCaseEnv) (*dc.Cont
 
 	envs := make(map[string]string)
 	for envName, envValueResolver := range c.Envs {
-		value, err := envValueResolver(project, testCase)
+		value, err := envValueResolver(ctx, project, testCase)
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to resolve env %s value", envName)
 		}
@@ -77,17 +125,17 @@ func (c ContainerDesc) run(project *ProjectEnv, testCase *TestCaseEnv) (*dc.Cont
 
 	portBindings := make(map[string][]docker.PortBinding)
 	for i, binding := range c.PortBindings {
-		host, err := binding.Host(project, testCase)
+		host, err := binding.Host(ctx, project, testCase)
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to resolve port binding #%d host", i)
 		}
 
-		port, err := binding.Port(project, testCase)
+		port, err := binding.Port(ctx, project, testCase)
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to resolve port binding #%d port", i)
 		}
 
-		containerPort, err := binding.ContainerPort(project, testCase)
+		containerPort, err := binding.ContainerPort(ctx, project, testCase)
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to resolve port binding #%d container port", i)
 		}
@@ -100,14 +148,32 @@ func (c ContainerDesc) run(project *ProjectEnv, testCase *TestCaseEnv) (*dc.Cont
 
 	exposedPorts := make([]string, 0, len(c.ExposedPorts))
 	for i, exposedPortResolver := range c.ExposedPorts {
-		exposedPort, err := exposedPortResolver(project, testCase)
+		exposedPort, err := exposedPortResolver(ctx, project, testCase)
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to resolve %d exposed port", i)
 		}
 		exposedPorts = append(exposedPorts, exposedPort)
 	}
 
-	container, err := project.client.RunContainer(docker.RunContainerParams{
+	mounts := make([]docker.Mount, 0, len(c.Mounts))
+	for i, mount := range c.Mounts {
+		resolved, err := mount.resolve(ctx, project, testCase)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to resolve mount #%d", i)
+		}
+		mounts = append(mounts, resolved)
+	}
+
+	files := make([]docker.File, 0, len(c.Files))
+	for _, file := range c.Files {
+		resolved, err := file.resolve(ctx, project, testCase)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, resolved)
+	}
+
+	params := docker.RunContainerParams{
 		Envs:         envs,
 		Image:        image,
 		ExposedPorts: exposedPorts,
@@ -115,17 +181,63 @@ func (c ContainerDesc) run(project *ProjectEnv, testCase *TestCaseEnv) (*dc.Cont
 		Networks:     networks,
 		Labels:       labels,
 		PortBindings: portBindings,
-	})
+		Mounts:       mounts,
+		Files:        files,
+		Offline:      project.offline(),
+	}
+
+	if err := pullImage(ctx, project, testCase, name, image, c.PullPolicy); err != nil {
+		return nil, err
+	}
+
+	started := time.Now()
+	var container *docker.Container
+	if testCase == nil && name != "" && project.reuse() {
+		container, err = project.reuseContainer(ctx, name, params)
+	} else {
+		runCtx, span := startSpan(ctx, project, testCase, "testenv.container.create", attrName.String(name), attrImage.String(image))
+		params.Created = func(id string) {
+			emit(project, testCase, Event{Type: EventContainerCreated, Name: name, ID: id, Image: image, Duration: time.Since(started)})
+		}
+		container, err = project.client.RunContainer(runCtx, params)
+		event := Event{Type: EventContainerStarted, Name: name, Image: image, Duration: time.Since(started), Err: err}
+		if container != nil {
+			event.ID = container.ID
+			span.SetAttributes(attrContainerID.String(container.ID))
+		}
+		endSpan(span, err)
+		emit(project, testCase, event)
+	}
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
-	if c.Hooks.AfterRun != nil {
-		if err := c.Hooks.AfterRun(project, testCase); err != nil {
-			return nil, errors.Wrap(err, "failed to process 'AfterRun' hook")
-		}
+	return &Container{
+		name:      name,
+		container: container,
+		client:    project.client,
+	}, nil
+}
+
+func (c ContainerDesc) ready(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv, name string, container *Container) error {
+	started := time.Now()
+	waitCtx, span := startSpan(ctx, project, testCase, "testenv.container.wait", attrName.String(name), attrContainerID.String(container.ID()))
+	err := c.waitHealthy(waitCtx, project, testCase, container)
+	if err != nil {
+		err = errors.Wrap(err, "failed to wait for container to become healthy")
+	} else if err = c.waitReady(waitCtx, project, container); err != nil {
+		err = errors.Wrap(err, "failed to wait for container to become ready")
 	}
-	return container, nil
+	endSpan(span, err)
+	emit(project, testCase, Event{Type: EventContainerHealthy, Name: name, ID: container.ID(), Duration: time.Since(started), Err: err})
+	if err != nil {
+		return err
+	}
+
+	if err := runHook(ctx, project, testCase, name, "AfterRun", c.Hooks.AfterRun); err != nil {
+		return errors.Wrap(err, "failed to process 'AfterRun' hook")
+	}
+	return nil
 }
 
 type ContainerNetwork struct {
@@ -134,24 +246,39 @@ type ContainerNetwork struct {
 }
 
 type Container struct {
-	container *dc.Container
+	name      string
+	container *docker.Container
+	client    Backend
+}
+
+func (c Container) ID() string {
+	if c.container == nil {
+		return ""
+	}
+	return c.container.ID
+}
+
+// Host returns the address on which published ports of the container are reachable.
+func (c Container) Host() string {
+	if c.client == nil {
+		return "localhost"
+	}
+	return c.client.Host()
 }
 
 func (c Container) HostPort(port string, portType PortType) (string, bool) {
 	if c.container == nil {
 		return "", false
-	} else if c.container.NetworkSettings == nil {
-		return "", false
 	}
 
-	m, ok := c.container.NetworkSettings.Ports[dc.Port(port+"/"+portType.String())]
+	m, ok := c.container.Ports[port+"/"+portType.String()]
 	if !ok {
 		return "", false
 	} else if len(m) == 0 {
 		return "", false
 	}
 
-	return m[0].HostPort, true
+	return m[0].Port, true
 }
 
 func (c Container) MustHostPort(port string, portType PortType) string {
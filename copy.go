@@ -0,0 +1,254 @@
+package testenv
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/saturn4er/go-testenv/docker"
+)
+
+type FileContent func(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv) ([]byte, error)
+
+// FileBytes is static file content.
+func FileBytes(content []byte) FileContent {
+	return func(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv) ([]byte, error) {
+		return content, nil
+	}
+}
+
+// HostFile reads file content from the host when the container is started.
+func HostFile(hostPath string) FileContent {
+	return func(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv) ([]byte, error) {
+		content, err := ioutil.ReadFile(hostPath)
+		return content, errors.WithStack(err)
+	}
+}
+
+// FileString renders file content with value when the container is started.
+func FileString(value StringValueResolver) FileContent {
+	return func(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv) ([]byte, error) {
+		content, err := value(ctx, project, testCase)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(content), nil
+	}
+}
+
+// ContainerFile is placed into the container before it is started. Zero Mode
+// means 0644.
+type ContainerFile struct {
+	Path    string
+	Content FileContent
+	Mode    os.FileMode
+}
+
+func (f ContainerFile) resolve(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv) (docker.File, error) {
+	if !path.IsAbs(f.Path) {
+		return docker.File{}, errors.Errorf("file path %q is not absolute", f.Path)
+	}
+	if f.Content == nil {
+		return docker.File{}, errors.Errorf("content of file %s is not set", f.Path)
+	}
+
+	content, err := f.Content(ctx, project, testCase)
+	if err != nil {
+		return docker.File{}, errors.Wrapf(err, "failed to resolve content of file %s", f.Path)
+	}
+
+	return docker.File{
+		Path:    f.Path,
+		Content: content,
+		Mode:    f.Mode.Perm(),
+	}, nil
+}
+
+// CopyTo copies a host file or directory to containerPath inside the
+// container. Missing parent directories are created.
+func (c *Container) CopyTo(ctx context.Context, hostPath string, containerPath string) error {
+	var files []docker.File
+	err := filepath.Walk(hostPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(hostPath, filePath)
+		if err != nil {
+			return err
+		}
+		file := docker.File{
+			Path: path.Join(containerPath, filepath.ToSlash(rel)),
+			Mode: info.Mode() & (os.ModeDir | os.ModePerm),
+		}
+		if info.Mode().IsRegular() {
+			if file.Content, err = ioutil.ReadFile(filePath); err != nil {
+				return err
+			}
+		} else if !info.IsDir() {
+			return errors.Errorf("%s is not a regular file or directory", filePath)
+		}
+
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", hostPath)
+	}
+
+	return c.copyFiles(ctx, files)
+}
+
+// CopyReaderTo copies content of r to the file containerPath inside the
+// container.
+func (c *Container) CopyReaderTo(ctx context.Context, r io.Reader, containerPath string, mode os.FileMode) error {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return c.copyFiles(ctx, []docker.File{{
+		Path:    containerPath,
+		Content: content,
+		Mode:    mode.Perm(),
+	}})
+}
+
+// CopyFrom writes content of the regular file containerPath inside the
+// container to w.
+func (c *Container) CopyFrom(ctx context.Context, containerPath string, w io.Writer) error {
+	archive := &bytes.Buffer{}
+	if err := c.client.CopyFromContainer(ctx, c.ID(), containerPath, archive); err != nil {
+		return errors.Wrapf(err, "failed to copy %s from container %s", containerPath, c.ID())
+	}
+
+	reader := tar.NewReader(archive)
+	header, err := reader.Next()
+	if err != nil {
+		return errors.Wrapf(err, "failed to read archive of %s", containerPath)
+	}
+	if header.Typeflag != tar.TypeReg {
+		return errors.Errorf("%s is not a regular file, use CopyDirFrom to copy directories", containerPath)
+	}
+
+	_, err = io.Copy(w, reader)
+	return errors.WithStack(err)
+}
+
+// CopyDirFrom copies content of the directory containerPath inside the
+// container to hostDir, which is created if it doesn't exist. Files keep
+// their permissions, special files other than symlinks are skipped. Entries
+// and symlinks pointing outside of hostDir are rejected.
+func (c *Container) CopyDirFrom(ctx context.Context, containerPath string, hostDir string) error {
+	archive := &bytes.Buffer{}
+	if err := c.client.CopyFromContainer(ctx, c.ID(), containerPath, archive); err != nil {
+		return errors.Wrapf(err, "failed to copy %s from container %s", containerPath, c.ID())
+	}
+
+	root, err := filepath.Abs(hostDir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	reader := tar.NewReader(archive)
+	for first := true; ; first = false {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "failed to read archive of %s", containerPath)
+		}
+		if first && header.Typeflag != tar.TypeDir {
+			return errors.Errorf("%s is not a directory", containerPath)
+		}
+
+		// entries are prefixed with the base name of containerPath
+		rel := "."
+		if parts := strings.SplitN(header.Name, "/", 2); len(parts) == 2 {
+			rel = path.Clean(parts[1])
+		}
+		if rel == "." {
+			if err := os.MkdirAll(root, 0755); err != nil {
+				return errors.WithStack(err)
+			}
+			continue
+		}
+
+		if err := extractEntry(reader, header, root, rel); err != nil {
+			return errors.Wrapf(err, "failed to extract %s", header.Name)
+		}
+	}
+}
+
+// extractEntry extracts the archive entry to rel inside the root directory.
+// Entries and symlinks pointing outside of root are rejected, as are entries
+// written through symlinks.
+func extractEntry(reader io.Reader, header *tar.Header, root, rel string) error {
+	target := filepath.Join(root, filepath.FromSlash(rel))
+	if !insideDir(root, target) {
+		return errors.Errorf("path is outside of %s", root)
+	}
+	for dir := filepath.Dir(target); dir != root; dir = filepath.Dir(dir) {
+		if info, err := os.Lstat(dir); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return errors.Errorf("%s is a symlink", dir)
+		}
+	}
+
+	mode := os.FileMode(header.Mode).Perm()
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if err := os.MkdirAll(target, mode); err != nil {
+			return errors.WithStack(err)
+		}
+		return errors.WithStack(os.Chmod(target, mode))
+	case tar.TypeReg:
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return errors.WithStack(err)
+		}
+		if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(target); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if _, err := io.Copy(file, reader); err != nil {
+			_ = file.Close()
+			return errors.WithStack(err)
+		}
+		return errors.WithStack(file.Close())
+	case tar.TypeSymlink:
+		link := filepath.FromSlash(header.Linkname)
+		if filepath.IsAbs(link) || !insideDir(root, filepath.Join(filepath.Dir(target), link)) {
+			return errors.Errorf("symlink target %s is outside of %s", header.Linkname, root)
+		}
+		_ = os.Remove(target)
+		return errors.WithStack(os.Symlink(link, target))
+	}
+	return nil
+}
+
+func insideDir(dir, target string) bool {
+	return target == dir || strings.HasPrefix(target, dir+string(os.PathSeparator))
+}
+
+func (c *Container) copyFiles(ctx context.Context, files []docker.File) error {
+	archive, err := docker.TarFiles(files)
+	if err != nil {
+		return err
+	}
+
+	if err := c.client.CopyToContainer(ctx, c.ID(), "/", bytes.NewReader(archive)); err != nil {
+		return errors.Wrapf(err, "failed to copy files to container %s", c.ID())
+	}
+	return nil
+}
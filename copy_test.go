@@ -0,0 +1,154 @@
+package testenv_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/saturn4er/go-testenv"
+	"github.com/saturn4er/go-testenv/fake"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContainerFiles(t *testing.T) {
+	backend := fake.NewBackend()
+
+	hostDir, err := ioutil.TempDir("", "testenv")
+	require.NoError(t, err)
+	defer os.RemoveAll(hostDir)
+	require.NoError(t, os.MkdirAll(filepath.Join(hostDir, "fixtures", "users"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(hostDir, "fixtures", "users", "1.json"), []byte(`{"id":1}`), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(hostDir, "init.sql"), []byte("CREATE TABLE users();"), 0644))
+
+	projectEnv := testenv.NewProjectEnvWithBackendT(t, testenv.ProjectEnvDesc{
+		Containers: map[string]testenv.ContainerDesc{
+			"postgres": {
+				Image: testenv.ExternalImage("postgres"),
+				Files: []testenv.ContainerFile{
+					{Path: "/etc/postgresql/postgresql.conf", Content: testenv.FileBytes([]byte("fsync = off"))},
+					{Path: "/docker-entrypoint-initdb.d/init.sql", Content: testenv.HostFile(filepath.Join(hostDir, "init.sql"))},
+					{Path: "/etc/postgresql/password", Content: testenv.FileString(testenv.StringValue("secret")), Mode: 0600},
+				},
+			},
+		},
+	}, backend)
+
+	ctx := context.Background()
+	postgres := projectEnv.MustContainer("postgres")
+
+	file, ok := backend.ContainerFile(postgres.ID(), "/docker-entrypoint-initdb.d/init.sql")
+	require.True(t, ok)
+	require.Equal(t, "CREATE TABLE users();", string(file.Content))
+	file, ok = backend.ContainerFile(postgres.ID(), "/etc/postgresql/password")
+	require.True(t, ok)
+	require.Equal(t, os.FileMode(0600), file.Mode)
+
+	content := &bytes.Buffer{}
+	require.NoError(t, postgres.CopyFrom(ctx, "/etc/postgresql/postgresql.conf", content))
+	require.Equal(t, "fsync = off", content.String())
+
+	require.NoError(t, postgres.CopyTo(ctx, filepath.Join(hostDir, "fixtures"), "/var/fixtures"))
+	content.Reset()
+	require.NoError(t, postgres.CopyFrom(ctx, "/var/fixtures/users/1.json", content))
+	require.Equal(t, `{"id":1}`, content.String())
+	require.Error(t, postgres.CopyFrom(ctx, "/var/fixtures/users", content))
+
+	outDir := filepath.Join(hostDir, "out")
+	require.NoError(t, postgres.CopyDirFrom(ctx, "/var/fixtures", outDir))
+	copied, err := ioutil.ReadFile(filepath.Join(outDir, "users", "1.json"))
+	require.NoError(t, err)
+	require.Equal(t, `{"id":1}`, string(copied))
+	info, err := os.Stat(filepath.Join(outDir, "users", "1.json"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	info, err = os.Stat(filepath.Join(outDir, "users"))
+	require.NoError(t, err)
+	require.True(t, info.IsDir())
+	require.EqualError(t, postgres.CopyDirFrom(ctx, "/etc/postgresql/password", outDir), "/etc/postgresql/password is not a directory")
+
+	require.NoError(t, postgres.CopyReaderTo(ctx, strings.NewReader("SELECT 1;"), "/tmp/query.sql", 0))
+	content.Reset()
+	require.NoError(t, postgres.CopyFrom(ctx, "/tmp/query.sql", content))
+	require.Equal(t, "SELECT 1;", content.String())
+}
+
+// archiveBackend returns archive for every CopyFromContainer call.
+type archiveBackend struct {
+	*fake.Backend
+	archive []byte
+}
+
+func (b *archiveBackend) CopyFromContainer(ctx context.Context, id string, path string, w io.Writer) error {
+	_, err := w.Write(b.archive)
+	return err
+}
+
+func TestCopyDirFromRejectsEntriesOutsideOfDir(t *testing.T) {
+	hostDir, err := ioutil.TempDir("", "testenv")
+	require.NoError(t, err)
+	defer os.RemoveAll(hostDir)
+
+	backend := &archiveBackend{Backend: fake.NewBackend()}
+	projectEnv := testenv.NewProjectEnvWithBackendT(t, testenv.ProjectEnvDesc{
+		Containers: map[string]testenv.ContainerDesc{
+			"app": {Image: testenv.ExternalImage("app")},
+		},
+	}, backend)
+	app := projectEnv.MustContainer("app")
+
+	copyDir := func(headers ...*tar.Header) error {
+		buf := &bytes.Buffer{}
+		writer := tar.NewWriter(buf)
+		for _, header := range append([]*tar.Header{{Name: "data/", Typeflag: tar.TypeDir, Mode: 0755}}, headers...) {
+			header.Size = int64(len(header.Name))
+			if header.Typeflag != tar.TypeReg {
+				header.Size = 0
+			}
+			require.NoError(t, writer.WriteHeader(header))
+			_, err := writer.Write([]byte(header.Name)[:header.Size])
+			require.NoError(t, err)
+		}
+		require.NoError(t, writer.Close())
+		backend.archive = buf.Bytes()
+
+		return app.CopyDirFrom(context.Background(), "/data", filepath.Join(hostDir, "out"))
+	}
+
+	err = copyDir(&tar.Header{Name: "data/../../escaped", Typeflag: tar.TypeReg, Mode: 0644})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "path is outside of")
+	_, err = os.Stat(filepath.Join(hostDir, "escaped"))
+	require.True(t, os.IsNotExist(err))
+
+	err = copyDir(&tar.Header{Name: "data/etc", Typeflag: tar.TypeSymlink, Linkname: "/etc"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "symlink target /etc is outside of")
+
+	err = copyDir(&tar.Header{Name: "data/parent", Typeflag: tar.TypeSymlink, Linkname: "../.."})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "symlink target ../.. is outside of")
+
+	err = copyDir(
+		&tar.Header{Name: "data/conf", Typeflag: tar.TypeDir, Mode: 0755},
+		&tar.Header{Name: "data/link", Typeflag: tar.TypeSymlink, Linkname: "conf"},
+		&tar.Header{Name: "data/link/app.yml", Typeflag: tar.TypeReg, Mode: 0644},
+	)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "link is a symlink")
+	_, err = os.Stat(filepath.Join(hostDir, "out", "conf", "app.yml"))
+	require.True(t, os.IsNotExist(err))
+
+	require.NoError(t, copyDir(
+		&tar.Header{Name: "data/conf/app.yml", Typeflag: tar.TypeReg, Mode: 0644},
+		&tar.Header{Name: "data/app.yml", Typeflag: tar.TypeSymlink, Linkname: "conf/app.yml"},
+	))
+	content, err := ioutil.ReadFile(filepath.Join(hostDir, "out", "app.yml"))
+	require.NoError(t, err)
+	require.Equal(t, "data/conf/app.yml", string(content))
+}
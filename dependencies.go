@@ -0,0 +1,261 @@
+package testenv
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+// DependencyCondition describes what state a container listed in
+// ContainerDesc.DependsOn must reach before the dependent container is
+// started. Conditions are set in ContainerDesc.DependsOnConditions, the
+// default is DependencyStarted.
+type DependencyCondition byte
+
+const (
+	DependencyStarted DependencyCondition = iota
+	DependencyHealthy
+	DependencyCompletedSuccessfully
+)
+
+func (d DependencyCondition) String() string {
+	switch d {
+	case DependencyStarted:
+		return "started"
+	case DependencyHealthy:
+		return "healthy"
+	case DependencyCompletedSuccessfully:
+		return "completed successfully"
+	}
+	return "unknown"
+}
+
+func (c ContainerDesc) dependencyCondition(name string) DependencyCondition {
+	return c.DependsOnConditions[name]
+}
+
+// sortContainers returns container names in dependency order. Dependencies
+// listed in external are considered satisfied and are not part of the
+// result.
+func sortContainers(containers map[string]ContainerDesc, external func(name string) bool) ([]string, error) {
+	names := make([]string, 0, len(containers))
+	for name := range containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var err error
+	inDegree := make(map[string]int, len(containers))
+	dependents := make(map[string][]string, len(containers))
+	for _, name := range names {
+		for _, dependency := range containers[name].DependsOn {
+			if _, ok := containers[dependency]; !ok {
+				if external == nil || !external(dependency) {
+					err = multierr.Append(err, errors.Errorf("container %s depends on unknown container %s", name, dependency))
+				}
+				continue
+			}
+			inDegree[name]++
+			dependents[dependency] = append(dependents[dependency], name)
+		}
+		for dependency := range containers[name].DependsOnConditions {
+			if !containsString(containers[name].DependsOn, dependency) {
+				err = multierr.Append(err, errors.Errorf("container %s has condition for %s which is not listed in DependsOn", name, dependency))
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var queue, result []string
+	for _, name := range names {
+		if inDegree[name] == 0 {
+			queue = append(queue, name)
+		}
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		result = append(result, name)
+
+		for _, dependent := range dependents[name] {
+			inDegree[dependent]--
+			if inDegree[dependent] == 0 {
+				queue = append(queue, dependent)
+			}
+		}
+	}
+
+	if len(result) != len(names) {
+		var cycle []string
+		for _, name := range names {
+			if inDegree[name] > 0 {
+				cycle = append(cycle, name)
+			}
+		}
+		return nil, errors.Errorf("dependency cycle between containers %s", strings.Join(cycle, ", "))
+	}
+
+	return result, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type containerStartup struct {
+	started   chan struct{}
+	ready     chan struct{}
+	container *Container
+	err       error
+}
+
+// startContainers starts containers in dependency order. Containers that
+// don't depend on each other are started concurrently, at most limit at a
+// time. Every container is passed to register as soon as it is created, so
+// it can be cleaned up even if it fails to become ready.
+func startContainers(
+	ctx context.Context,
+	project *ProjectEnv,
+	testCase *TestCaseEnv,
+	containers map[string]ContainerDesc,
+	external func(name string) bool,
+	limit limiter,
+	register func(name string, container *Container),
+) error {
+	order, err := sortContainers(containers, external)
+	if err != nil {
+		return err
+	}
+
+	startups := make(map[string]*containerStartup, len(order))
+	for _, name := range order {
+		startups[name] = &containerStartup{
+			started: make(chan struct{}),
+			ready:   make(chan struct{}),
+		}
+	}
+
+	group := newTaskGroup(ctx)
+	for _, name := range order {
+		name := name
+		group.Go(func(ctx context.Context) error {
+			err := startContainer(ctx, project, testCase, name, containers[name], startups, startups[name], limit, func(container *Container) {
+				register(name, container)
+			})
+			return errors.Wrapf(err, "failed to run container %s", name)
+		})
+	}
+
+	return group.Wait()
+}
+
+func startContainer(
+	ctx context.Context,
+	project *ProjectEnv,
+	testCase *TestCaseEnv,
+	name string,
+	desc ContainerDesc,
+	startups map[string]*containerStartup,
+	startup *containerStartup,
+	limit limiter,
+	register func(container *Container),
+) (err error) {
+	startedClosed := false
+	defer func() {
+		startup.err = err
+		if !startedClosed {
+			close(startup.started)
+		}
+		close(startup.ready)
+	}()
+
+	for _, dependencyName := range desc.DependsOn {
+		dependency, ok := startups[dependencyName]
+		if !ok {
+			continue
+		}
+
+		if err := waitDependency(ctx, project, testCase, dependencyName, dependency, desc.dependencyCondition(dependencyName)); err != nil {
+			return err
+		}
+	}
+
+	if err := limit.acquire(ctx); err != nil {
+		return err
+	}
+	defer limit.release()
+
+	ctx, span := startContainerSpan(ctx, project, testCase, name)
+	defer func() { endSpan(span, err) }()
+
+	container, err := desc.start(ctx, project, testCase, name)
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(attrContainerID.String(container.ID()))
+	register(container)
+
+	startup.container = container
+	close(startup.started)
+	startedClosed = true
+
+	return desc.ready(ctx, project, testCase, name, container)
+}
+
+func waitDependency(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv, name string, dependency *containerStartup, condition DependencyCondition) error {
+	wait := func(done chan struct{}) error {
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		}
+	}
+
+	switch condition {
+	case DependencyStarted:
+		if err := wait(dependency.started); err != nil {
+			return err
+		}
+		if dependency.container == nil {
+			return errors.Errorf("dependency %s failed to start", name)
+		}
+		return nil
+	case DependencyHealthy:
+		if err := wait(dependency.ready); err != nil {
+			return err
+		}
+		if dependency.err != nil {
+			return errors.Errorf("dependency %s failed to become healthy", name)
+		}
+		return nil
+	case DependencyCompletedSuccessfully:
+		if err := wait(dependency.ready); err != nil {
+			return err
+		}
+		if dependency.err != nil {
+			return errors.Errorf("dependency %s failed to start", name)
+		}
+
+		exitCode, err := project.client.WaitContainer(ctx, dependency.container.ID())
+		if err != nil {
+			return errors.Wrapf(err, "failed to wait for dependency %s to complete", name)
+		}
+		emit(project, testCase, Event{Type: EventContainerExited, Name: name, ID: dependency.container.ID(), ExitCode: exitCode})
+		if exitCode != 0 {
+			return errors.Errorf("dependency %s exited with code %d", name, exitCode)
+		}
+		return nil
+	}
+	return errors.Errorf("unknown dependency condition %d", condition)
+}
@@ -0,0 +1,167 @@
+package testenv
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/saturn4er/go-testenv/docker"
+	"github.com/saturn4er/go-testenv/fake"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSortContainers(t *testing.T) {
+	order, err := sortContainers(map[string]ContainerDesc{
+		"kafka":     {DependsOn: []string{"zookeeper"}},
+		"zookeeper": {},
+		"server":    {DependsOn: []string{"kafka", "postgres"}},
+		"postgres":  {},
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"postgres", "zookeeper", "kafka", "server"}, order)
+}
+
+func TestSortContainersRejectsCycles(t *testing.T) {
+	_, err := sortContainers(map[string]ContainerDesc{
+		"a": {DependsOn: []string{"b"}},
+		"b": {DependsOn: []string{"c"}},
+		"c": {DependsOn: []string{"a"}},
+		"d": {},
+	}, nil)
+	require.EqualError(t, err, "dependency cycle between containers a, b, c")
+}
+
+func TestSortContainersRejectsUnknownContainers(t *testing.T) {
+	_, err := sortContainers(map[string]ContainerDesc{
+		"server": {DependsOn: []string{"postgres", "kafka"}},
+	}, func(name string) bool {
+		return name == "kafka"
+	})
+	require.EqualError(t, err, "container server depends on unknown container postgres")
+}
+
+// eventOrder records "<type> <name>" of observed events.
+type eventOrder struct {
+	mx     sync.Mutex
+	events []string
+}
+
+func (o *eventOrder) observe(event Event) {
+	o.mx.Lock()
+	o.events = append(o.events, string(event.Type)+" "+event.Name)
+	o.mx.Unlock()
+}
+
+func (o *eventOrder) index(eventType EventType, name string) int {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	for i, event := range o.events {
+		if event == string(eventType)+" "+name {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestDependencyHealthy(t *testing.T) {
+	backend := fake.NewBackend()
+	var (
+		execsMx sync.Mutex
+		execs   int
+	)
+	backend.ExecHandler = func(container *docker.Container, params docker.ExecParams) (*docker.ExecResult, error) {
+		execsMx.Lock()
+		defer execsMx.Unlock()
+		execs++
+		if execs < 3 {
+			return &docker.ExecResult{ExitCode: 1}, nil
+		}
+		return &docker.ExecResult{}, nil
+	}
+	order := &eventOrder{}
+
+	projectEnv := NewProjectEnvWithBackend(ProjectEnvDesc{
+		Containers: map[string]ContainerDesc{
+			"zookeeper": {
+				Image:        ExternalImage("zookeeper"),
+				WaitStrategy: &ExecWaitStrategy{Cmd: []string{"zkOk.sh"}, PollInterval: time.Millisecond},
+			},
+			"kafka": {
+				Image:               ExternalImage("kafka"),
+				DependsOn:           []string{"zookeeper"},
+				DependsOnConditions: map[string]DependencyCondition{"zookeeper": DependencyHealthy},
+			},
+		},
+		Observers: []Observer{order.observe},
+	}, backend)
+	require.NoError(t, projectEnv.Run())
+	defer projectEnv.Close()
+
+	require.NotEqual(t, -1, order.index(EventContainerHealthy, "zookeeper"))
+	require.Less(t, order.index(EventContainerHealthy, "zookeeper"), order.index(EventContainerCreated, "kafka"))
+	require.Equal(t, 3, execs)
+}
+
+func TestDependencyCompletedSuccessfully(t *testing.T) {
+	run := func(exitCode int) (*eventOrder, error) {
+		backend := fake.NewBackend()
+		order := &eventOrder{}
+		projectEnv := NewProjectEnvWithBackend(ProjectEnvDesc{
+			Containers: map[string]ContainerDesc{
+				"migrations": {
+					Image: ExternalImage("migrations"),
+				},
+				"server": {
+					Image:               ExternalImage("server"),
+					DependsOn:           []string{"migrations"},
+					DependsOnConditions: map[string]DependencyCondition{"migrations": DependencyCompletedSuccessfully},
+				},
+			},
+			Observers: []Observer{
+				order.observe,
+				func(event Event) {
+					if event.Type == EventContainerStarted && event.Name == "migrations" {
+						if err := backend.StopContainer(event.ID, exitCode); err != nil {
+							t.Error(err)
+						}
+					}
+				},
+			},
+		}, backend)
+		err := projectEnv.Run()
+		require.NoError(t, projectEnv.Close())
+		return order, err
+	}
+
+	order, err := run(0)
+	require.NoError(t, err)
+	require.NotEqual(t, -1, order.index(EventContainerExited, "migrations"))
+	require.Less(t, order.index(EventContainerExited, "migrations"), order.index(EventContainerCreated, "server"))
+
+	order, err = run(1)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "dependency migrations exited with code 1")
+	require.Equal(t, -1, order.index(EventContainerCreated, "server"))
+}
+
+func TestCloseRemovesContainersInReverseDependencyOrder(t *testing.T) {
+	order := &eventOrder{}
+	projectEnv := NewProjectEnvWithBackend(ProjectEnvDesc{
+		Containers: map[string]ContainerDesc{
+			"zookeeper": {Image: ExternalImage("zookeeper")},
+			"kafka":     {Image: ExternalImage("kafka"), DependsOn: []string{"zookeeper"}},
+			"server":    {Image: ExternalImage("server"), DependsOn: []string{"kafka"}},
+		},
+		Observers: []Observer{order.observe},
+	}, fake.NewBackend())
+	require.NoError(t, projectEnv.Run())
+	require.NoError(t, projectEnv.Close())
+
+	server := order.index(EventContainerRemoved, "server")
+	kafka := order.index(EventContainerRemoved, "kafka")
+	zookeeper := order.index(EventContainerRemoved, "zookeeper")
+	require.NotEqual(t, -1, server)
+	require.Less(t, server, kafka)
+	require.Less(t, kafka, zookeeper)
+}
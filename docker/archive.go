@@ -0,0 +1,72 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultFileMode = 0644
+	defaultDirMode  = 0755
+)
+
+// File is a file or, if Mode has os.ModeDir set, a directory placed into a
+// container by its absolute Path. Zero permissions mean 0644 for files and
+// 0755 for directories.
+type File struct {
+	Path    string
+	Content []byte
+	Mode    os.FileMode
+}
+
+// TarFiles packs files into a tar archive that is extracted at the root of
+// the container filesystem.
+func TarFiles(files []File) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	writer := tar.NewWriter(buf)
+
+	now := time.Now()
+	for _, file := range files {
+		name := strings.TrimPrefix(path.Clean("/"+file.Path), "/")
+		if name == "" {
+			return nil, errors.Errorf("invalid file path %q", file.Path)
+		}
+
+		header := &tar.Header{
+			Name:    name,
+			Mode:    int64(file.Mode.Perm()),
+			ModTime: now,
+		}
+		if file.Mode.IsDir() {
+			header.Typeflag = tar.TypeDir
+			header.Name += "/"
+			if header.Mode == 0 {
+				header.Mode = defaultDirMode
+			}
+		} else {
+			if header.Mode == 0 {
+				header.Mode = defaultFileMode
+			}
+			header.Typeflag = tar.TypeReg
+			header.Size = int64(len(file.Content))
+		}
+
+		if err := writer.WriteHeader(header); err != nil {
+			return nil, errors.Wrapf(err, "failed to write header of %s", file.Path)
+		}
+		if _, err := writer.Write(file.Content); err != nil {
+			return nil, errors.Wrapf(err, "failed to write content of %s", file.Path)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return buf.Bytes(), nil
+}
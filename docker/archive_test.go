@@ -0,0 +1,41 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTarFiles(t *testing.T) {
+	archive, err := TarFiles([]File{
+		{Path: "/etc/app", Mode: os.ModeDir},
+		{Path: "/etc/app/config.yml", Content: []byte("debug: true")},
+		{Path: "/etc/app/secret", Content: []byte("secret"), Mode: 0600},
+		{Path: "/var/lib/app", Mode: os.ModeDir | 0700},
+	})
+	require.NoError(t, err)
+
+	modes := map[string]int64{}
+	reader := tar.NewReader(bytes.NewReader(archive))
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		modes[header.Name] = header.Mode
+	}
+	require.Equal(t, map[string]int64{
+		"etc/app/":           0755,
+		"etc/app/config.yml": 0644,
+		"etc/app/secret":     0600,
+		"var/lib/app/":       0700,
+	}, modes)
+
+	_, err = TarFiles([]File{{Path: "/"}})
+	require.EqualError(t, err, `invalid file path "/"`)
+}
@@ -0,0 +1,336 @@
+package docker
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ory/dockertest/docker/pkg/archive"
+	"github.com/ory/dockertest/docker/pkg/fileutils"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	inlineDockerfileName = ".testenv.Dockerfile"
+	buildErrorOutputTail = 20
+)
+
+// BuildImage builds an image. The build request is sent directly to the
+// engine API, so options missing from the underlying client, such as target
+// and platform, are supported.
+func (c *Client) BuildImage(ctx context.Context, params BuildImageParams) (string, error) {
+	if err := c.startReaper(ctx); err != nil {
+		return "", err
+	}
+
+	imageName := params.Name
+	if imageName == "" {
+		imageName = uuid.NewV4().String()
+	}
+
+	buildContext, dockerfile, err := buildContextArchive(params)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create build context")
+	}
+
+	query, err := c.buildQuery(imageName, dockerfile, params)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, c.apiURL("/build")+"?"+query.Encode(), buildContext)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "application/x-tar")
+
+	authConfigs, err := c.dockerAuthConfigs()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	registryConfig, err := json.Marshal(authConfigs.Configs)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	request.Header.Set("X-Registry-Config", base64.URLEncoding.EncodeToString(registryConfig))
+
+	response, err := c.client.HTTPClient.Do(request)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to send build request")
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(response.Body)
+		return "", errors.Errorf("failed to build image: %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+
+	if err := readBuildOutput(response.Body, params.Output); err != nil {
+		return "", err
+	}
+
+	if !params.Persistent {
+		c.mx.Lock()
+		c.builtImages[imageName] = struct{}{}
+		c.mx.Unlock()
+	}
+
+	return imageName, nil
+}
+
+func (c *Client) buildQuery(imageName, dockerfile string, params BuildImageParams) (url.Values, error) {
+	labels, err := json.Marshal(c.sessionLabels(params.Labels, params.Persistent))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	buildArgs, err := json.Marshal(params.BuildArgs)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	query := url.Values{}
+	query.Set("t", imageName)
+	query.Set("rm", "1")
+	query.Set("forcerm", "1")
+	query.Set("labels", string(labels))
+	query.Set("buildargs", string(buildArgs))
+	if dockerfile != "" {
+		query.Set("dockerfile", dockerfile)
+	}
+	if params.Target != "" {
+		query.Set("target", params.Target)
+	}
+	if params.Platform != "" {
+		query.Set("platform", params.Platform)
+	}
+	if params.NoCache {
+		query.Set("nocache", "1")
+	}
+	if params.Pull {
+		query.Set("pull", "1")
+	}
+	return query, nil
+}
+
+// apiURL returns URL of the engine API endpoint path.
+func (c *Client) apiURL(path string) string {
+	endpoint, err := url.Parse(c.client.Endpoint())
+	if err != nil || endpoint.Scheme == "unix" || endpoint.Scheme == "npipe" {
+		return "http://docker" + path
+	}
+
+	scheme := "http"
+	if c.client.TLSConfig != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + endpoint.Host + path
+}
+
+// jsonMessage is a message of the JSON stream returned by build and load
+// requests.
+type jsonMessage struct {
+	Stream      string `json:"stream"`
+	Status      string `json:"status"`
+	Error       string `json:"error"`
+	ErrorDetail struct {
+		Message string `json:"message"`
+	} `json:"errorDetail"`
+}
+
+func (m jsonMessage) errorMessage() string {
+	if m.ErrorDetail.Message != "" {
+		return m.ErrorDetail.Message
+	}
+	return m.Error
+}
+
+// readBuildOutput copies build output to w and returns the build error with
+// the last lines of output, if the build failed.
+func readBuildOutput(r io.Reader, w io.Writer) error {
+	if w == nil {
+		w = ioutil.Discard
+	}
+
+	var tail []string
+	decoder := json.NewDecoder(r)
+	for {
+		var message jsonMessage
+		if err := decoder.Decode(&message); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "failed to read build output")
+		}
+
+		output := message.Stream
+		if output == "" && message.Status != "" {
+			output = message.Status + "\n"
+		}
+		if output != "" {
+			if _, err := io.WriteString(w, output); err != nil {
+				return errors.Wrap(err, "failed to write build output")
+			}
+			tail = appendTail(tail, output)
+		}
+
+		if message.Error != "" {
+			msg := message.errorMessage()
+			if len(tail) == 0 {
+				return errors.Errorf("failed to build image: %s", msg)
+			}
+			return errors.Errorf("failed to build image: %s\nlast %d lines of build output:\n%s",
+				msg, len(tail), strings.Join(tail, "\n"))
+		}
+	}
+}
+
+func appendTail(tail []string, output string) []string {
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); line != "" {
+			tail = append(tail, line)
+		}
+	}
+	if len(tail) > buildErrorOutputTail {
+		tail = tail[len(tail)-buildErrorOutputTail:]
+	}
+	return tail
+}
+
+// buildContextArchive returns the build context as a tar stream and the name
+// of the Dockerfile in it.
+func buildContextArchive(params BuildImageParams) (io.Reader, string, error) {
+	contextArchive := params.ContextArchive
+	if contextArchive == nil && params.ContextDir != "" {
+		dir, err := filepath.Abs(params.ContextDir)
+		if err != nil {
+			return nil, "", errors.WithStack(err)
+		}
+		if contextArchive, err = tarContextDir(dir, params.Dockerfile); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if params.DockerfileContent == nil {
+		if contextArchive == nil {
+			return nil, "", errors.New("no build context")
+		}
+		return bytes.NewReader(contextArchive), params.Dockerfile, nil
+	}
+
+	buf := &bytes.Buffer{}
+	writer := tar.NewWriter(buf)
+	if contextArchive != nil {
+		reader := tar.NewReader(bytes.NewReader(contextArchive))
+		for {
+			header, err := reader.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, "", errors.Wrap(err, "invalid build context archive")
+			}
+			if header.Name == inlineDockerfileName {
+				continue
+			}
+			if err := writer.WriteHeader(header); err != nil {
+				return nil, "", errors.WithStack(err)
+			}
+			if _, err := io.Copy(writer, reader); err != nil {
+				return nil, "", errors.WithStack(err)
+			}
+		}
+	}
+
+	err := writer.WriteHeader(&tar.Header{
+		Name:     inlineDockerfileName,
+		Mode:     0644,
+		Size:     int64(len(params.DockerfileContent)),
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	if _, err := writer.Write(params.DockerfileContent); err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	return buf, inlineDockerfileName, nil
+}
+
+func tarContextDir(dir, dockerfile string) ([]byte, error) {
+	excludes, err := ReadDockerignore(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Dockerfile and .dockerignore are always sent, the engine excludes them
+	// itself if needed.
+	includes := []string{"."}
+	for _, name := range []string{".dockerignore", dockerfile} {
+		if name == "" {
+			continue
+		}
+		excluded, err := fileutils.Matches(name, excludes)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if excluded {
+			includes = append(includes, name)
+		}
+	}
+
+	result, err := archive.TarWithOptions(dir, &archive.TarOptions{
+		ExcludePatterns: excludes,
+		IncludeFiles:    includes,
+		Compression:     archive.Uncompressed,
+		NoLchown:        true,
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer result.Close()
+
+	data, err := ioutil.ReadAll(result)
+	return data, errors.WithStack(err)
+}
+
+// ReadDockerignore returns exclusion patterns from .dockerignore in the
+// build context directory.
+func ReadDockerignore(contextDir string) ([]string, error) {
+	file, err := os.Open(filepath.Join(contextDir, ".dockerignore"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer file.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		pattern := strings.TrimSpace(scanner.Text())
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		exclusion := strings.HasPrefix(pattern, "!")
+		pattern = filepath.Clean(strings.TrimPrefix(pattern, "!"))
+		if exclusion {
+			pattern = "!" + pattern
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, errors.Wrap(scanner.Err(), "failed to read .dockerignore")
+}
@@ -0,0 +1,93 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ory/dockertest/docker"
+	"github.com/pkg/errors"
+)
+
+const offlineEnv = "TESTENV_OFFLINE"
+
+// Offline reports whether $TESTENV_OFFLINE forbids pulling images.
+func Offline() bool {
+	offline, _ := strconv.ParseBool(os.Getenv(offlineEnv))
+	return offline
+}
+
+// SaveImages writes images to w as a tar archive in the format of docker
+// save. The reaper image is saved as well, unless the reaper is disabled, so
+// environments started from the archive don't need to pull it.
+func (c *Client) SaveImages(ctx context.Context, images []string, w io.Writer) error {
+	if err := c.startReaper(ctx); err != nil {
+		return err
+	}
+	images = append(images, c.HelperImages()...)
+
+	err := c.client.ExportImages(docker.ExportImagesOptions{
+		Names:        images,
+		OutputStream: w,
+		Context:      ctx,
+	})
+	return errors.Wrap(err, "failed to save images")
+}
+
+// LoadImages loads images from a tar archive written by SaveImages and
+// returns their names.
+func (c *Client) LoadImages(ctx context.Context, r io.Reader) ([]string, error) {
+	reader, writer := io.Pipe()
+	result := make(chan loadResult, 1)
+	go func() {
+		images, err := readLoadOutput(reader)
+		result <- loadResult{images: images, err: err}
+	}()
+
+	err := c.client.LoadImage(docker.LoadImageOptions{
+		InputStream:  r,
+		OutputStream: writer,
+		Context:      ctx,
+	})
+	writer.Close()
+	loaded := <-result
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load images")
+	}
+	return loaded.images, errors.Wrap(loaded.err, "failed to load images")
+}
+
+type loadResult struct {
+	images []string
+	err    error
+}
+
+// readLoadOutput returns names of images reported by docker load. r is
+// always read to the end.
+func readLoadOutput(r io.Reader) ([]string, error) {
+	defer io.Copy(ioutil.Discard, r)
+
+	var images []string
+	decoder := json.NewDecoder(r)
+	for {
+		var message jsonMessage
+		if err := decoder.Decode(&message); err == io.EOF {
+			return images, nil
+		} else if err != nil {
+			return nil, errors.Wrap(err, "failed to read output")
+		}
+
+		if message.Error != "" {
+			return nil, errors.New(message.errorMessage())
+		}
+		for _, line := range strings.Split(message.Stream, "\n") {
+			if image := strings.TrimPrefix(line, "Loaded image: "); image != line {
+				images = append(images, strings.TrimSpace(image))
+			}
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadLoadOutput(t *testing.T) {
+	images, err := readLoadOutput(strings.NewReader(`
+		{"stream":"Loaded image: postgres:12\n"}
+		{"stream":"Loaded image: testenv/app:0123456789abcdef0123\n"}
+	`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"postgres:12", "testenv/app:0123456789abcdef0123"}, images)
+
+	_, err = readLoadOutput(strings.NewReader(`{"errorDetail":{"message":"unexpected EOF"},"error":"unexpected EOF"}`))
+	require.EqualError(t, err, "unexpected EOF")
+}
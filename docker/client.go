@@ -1,9 +1,17 @@
 package docker
 
 import (
+	"bytes"
+	"context"
+	"io"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/ory/dockertest/docker"
 	"github.com/pkg/errors"
@@ -11,29 +19,60 @@ import (
 	"go.uber.org/multierr"
 )
 
+// Client is safe for concurrent use.
 type Client struct {
-	client *docker.Client
+	client    *docker.Client
+	sessionID string
 
-	createdContainers map[string]*docker.Container
-	createdNetworks   map[string]*docker.Network
+	reaperMx   sync.Mutex
+	reaperConn net.Conn
+
+	mx                sync.Mutex
+	createdContainers map[string]struct{}
+	createdNetworks   map[string]struct{}
 	builtImages       map[string]struct{}
+	createdVolumes    map[string]struct{}
 }
 
-func (c *Client) Cleanup() error {
-	var err error
+func (c *Client) Cleanup(ctx context.Context) error {
+	c.mx.Lock()
+	containers := make([]string, 0, len(c.createdContainers))
 	for id := range c.createdContainers {
-		if removeErr := c.RemoveContainer(id); removeErr != nil {
+		containers = append(containers, id)
+	}
+	networks := make([]string, 0, len(c.createdNetworks))
+	for id := range c.createdNetworks {
+		networks = append(networks, id)
+	}
+	images := make([]string, 0, len(c.builtImages))
+	for imageName := range c.builtImages {
+		images = append(images, imageName)
+	}
+	volumes := make([]string, 0, len(c.createdVolumes))
+	for name := range c.createdVolumes {
+		volumes = append(volumes, name)
+	}
+	c.mx.Unlock()
+
+	var err error
+	for _, id := range containers {
+		if removeErr := c.RemoveContainer(ctx, id); removeErr != nil {
 			err = multierr.Append(err, removeErr)
 		}
 	}
 
-	for id := range c.createdNetworks {
-		if removeErr := c.RemoveNetwork(id); removeErr != nil {
+	for _, id := range networks {
+		if removeErr := c.RemoveNetwork(ctx, id); removeErr != nil {
 			err = multierr.Append(err, removeErr)
 		}
 	}
-	for imageName := range c.builtImages {
-		if removeErr := c.RemoveImage(imageName); removeErr != nil {
+	for _, name := range volumes {
+		if removeErr := c.RemoveVolume(ctx, name); removeErr != nil {
+			err = multierr.Append(err, removeErr)
+		}
+	}
+	for _, imageName := range images {
+		if removeErr := c.RemoveImage(ctx, imageName); removeErr != nil {
 			err = multierr.Append(err, removeErr)
 		}
 	}
@@ -41,138 +80,196 @@ func (c *Client) Cleanup() error {
 	return err
 }
 
-func (c *Client) RemoveContainer(id string) error {
+func (c *Client) RemoveContainer(ctx context.Context, id string) error {
 	err := c.client.RemoveContainer(docker.RemoveContainerOptions{
 		ID:            id,
 		RemoveVolumes: true,
 		Force:         true,
+		Context:       ctx,
 	})
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
+	c.mx.Lock()
 	delete(c.createdContainers, id)
+	c.mx.Unlock()
 	return nil
 }
 
-func (c *Client) RemoveNetwork(id string) error {
+func (c *Client) RemoveNetwork(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
 	err := c.client.RemoveNetwork(id)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
+	c.mx.Lock()
 	delete(c.createdNetworks, id)
+	c.mx.Unlock()
 	return nil
 }
 
-func (c *Client) RemoveImage(id string) error {
+func (c *Client) RemoveImage(ctx context.Context, id string) error {
 	err := c.client.RemoveImageExtended(id, docker.RemoveImageOptions{
-		Force: true,
+		Force:   true,
+		Context: ctx,
 	})
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
+	c.mx.Lock()
 	delete(c.builtImages, id)
+	c.mx.Unlock()
 
 	return nil
 }
-func (c *Client) CreateNetwork(params CreateNetworkParams) (*docker.Network, error) {
-	network, err := c.client.CreateNetwork(docker.CreateNetworkOptions{
-		Name:    uuid.NewV4().String(),
-		Driver:  params.Driver,
-		Options: params.Options,
-		Labels:  params.Labels,
+
+// UntagImage removes the image tag. Images used by containers are left
+// intact.
+func (c *Client) UntagImage(ctx context.Context, image string) error {
+	err := c.client.RemoveImageExtended(image, docker.RemoveImageOptions{Context: ctx})
+	if err == docker.ErrNoSuchImage {
+		return nil
+	}
+	if apiErr, ok := err.(*docker.Error); ok && apiErr.Status == http.StatusConflict {
+		return nil
+	}
+	return errors.WithStack(err)
+}
+
+func (c *Client) RemoveVolume(ctx context.Context, name string) error {
+	err := c.client.RemoveVolumeWithOptions(docker.RemoveVolumeOptions{
+		Name:    name,
+		Context: ctx,
 	})
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return errors.WithStack(err)
 	}
 
-	c.createdNetworks[network.ID] = network
-	return network, nil
+	c.mx.Lock()
+	delete(c.createdVolumes, name)
+	c.mx.Unlock()
+	return nil
 }
 
-func (c *Client) RunContainer(params RunContainerParams) (*docker.Container, error) {
-	container, err := c.createContainer(params)
+func (c *Client) CreateVolume(ctx context.Context, params CreateVolumeParams) (*Volume, error) {
+	if err := c.startReaper(ctx); err != nil {
+		return nil, err
+	}
+
+	name := uuid.NewV4().String()
+	volume, err := c.client.CreateVolume(docker.CreateVolumeOptions{
+		Name:       name,
+		Driver:     params.Driver,
+		DriverOpts: params.Options,
+		Labels:     c.sessionLabels(params.Labels, params.Persistent),
+		Context:    ctx,
+	})
 	if err != nil {
-		if errors.Cause(err) != docker.ErrNoSuchImage {
-			return nil, errors.WithStack(err)
+		if ctx.Err() != nil {
+			// the request may have reached the daemon before it was cancelled
+			_ = c.client.RemoveVolume(name)
 		}
+		return nil, errors.WithStack(err)
+	}
 
-		if err := c.PullImage(params.Image); err != nil {
-			return nil, errors.WithStack(err)
-		}
-		container, err = c.createContainer(params)
-		if err != nil {
-			return nil, errors.WithStack(err)
-		}
+	if !params.Persistent {
+		c.mx.Lock()
+		c.createdVolumes[volume.Name] = struct{}{}
+		c.mx.Unlock()
 	}
 
-	return container, nil
+	return &Volume{
+		Name:   volume.Name,
+		Labels: volume.Labels,
+	}, nil
 }
 
-func (c *Client) PullImage(image string) error {
-	authConfigs, err := docker.NewAuthConfigurationsFromDockerCfg()
-	if err != nil {
-		if !os.IsNotExist(err) {
-			return errors.WithStack(err)
-		}
+func (c *Client) CreateNetwork(ctx context.Context, params CreateNetworkParams) (*Network, error) {
+	if err := c.startReaper(ctx); err != nil {
+		return nil, err
 	}
 
-	var authConfig docker.AuthConfiguration
-	for server, config := range authConfigs.Configs {
-		if strings.HasPrefix(image, server) {
-			authConfig = config
-			break
+	name := uuid.NewV4().String()
+	network, err := c.client.CreateNetwork(docker.CreateNetworkOptions{
+		Name:    name,
+		Driver:  params.Driver,
+		Options: params.Options,
+		Labels:  c.sessionLabels(params.Labels, params.Persistent),
+		Context: ctx,
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			// the request may have reached the daemon before it was cancelled
+			_ = c.client.RemoveNetwork(name)
 		}
+		return nil, errors.WithStack(err)
 	}
 
-	imageParts := strings.Split(image, ":")
-	err = c.client.PullImage(docker.PullImageOptions{
-		Repository: imageParts[0],
-		Tag:        imageParts[1],
-	}, authConfig)
-	if err != nil {
-		return errors.WithStack(err)
+	if !params.Persistent {
+		c.mx.Lock()
+		c.createdNetworks[network.ID] = struct{}{}
+		c.mx.Unlock()
 	}
 
-	return nil
+	return &Network{
+		ID:     network.ID,
+		Name:   network.Name,
+		Labels: network.Labels,
+	}, nil
 }
 
-func (c *Client) BuildImage(params BuildImageParams) (string, error) {
-	authConfigs, err := c.dockerAuthConfigs()
-	if err != nil {
-		return "", errors.WithStack(err)
+func (c *Client) RunContainer(ctx context.Context, params RunContainerParams) (*Container, error) {
+	if err := c.startReaper(ctx); err != nil {
+		return nil, err
 	}
-
-	buildArgs := make([]docker.BuildArg, 0, len(params.BuildArgs))
-	for key, value := range params.BuildArgs {
-		buildArgs = append(buildArgs, docker.BuildArg{
-			Name:  key,
-			Value: value,
-		})
+	if params.ContainerName == "" {
+		params.ContainerName = uuid.NewV4().String()
 	}
 
-	imageName := uuid.NewV4().String()
-	err = c.client.BuildImage(docker.BuildImageOptions{
-		Name:         imageName,
-		Dockerfile:   params.Dockerfile,
-		ContextDir:   params.ContextDir,
-		Labels:       params.Labels,
-		OutputStream: ioutil.Discard,
-		AuthConfigs:  *authConfigs,
-		BuildArgs:    buildArgs,
-	})
+	container, err := c.createContainer(ctx, params)
 	if err != nil {
-		return "", errors.WithStack(err)
+		if errors.Cause(err) != docker.ErrNoSuchImage {
+			return nil, errors.WithStack(err)
+		}
+
+		if params.Offline || Offline() {
+			return nil, errors.Errorf("image %s is not present and pulling is disabled in offline mode", params.Image)
+		}
+		if err := c.PullImage(ctx, PullImageParams{Image: params.Image}); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		container, err = c.createContainer(ctx, params)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
 	}
 
-	c.builtImages[imageName] = struct{}{}
+	if params.Persistent {
+		// started successfully, so it must outlive Cleanup
+		c.mx.Lock()
+		delete(c.createdContainers, container.ID)
+		c.mx.Unlock()
+	}
+	return container, nil
+}
 
-	return imageName, nil
+func (c *Client) ImageExists(ctx context.Context, image string) (bool, error) {
+	_, err := c.client.InspectImage(image)
+	if err == docker.ErrNoSuchImage {
+		return false, nil
+	} else if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return true, nil
 }
 
-func (c *Client) createContainer(params RunContainerParams) (*docker.Container, error) {
+func (c *Client) createContainer(ctx context.Context, params RunContainerParams) (*Container, error) {
 	exposedPorts := make(map[docker.Port]struct{})
 	for _, exposedPort := range params.ExposedPorts {
 		exposedPorts[docker.Port(exposedPort)] = struct{}{}
@@ -195,26 +292,65 @@ func (c *Client) createContainer(params RunContainerParams) (*docker.Container,
 		portBindings[docker.Port(port)] = dockerBindings
 	}
 
+	mounts := make([]docker.HostMount, 0, len(params.Mounts))
+	for _, mount := range params.Mounts {
+		hostMount := docker.HostMount{
+			Type:     string(mount.Type),
+			Source:   mount.Source,
+			Target:   mount.Target,
+			ReadOnly: mount.ReadOnly,
+		}
+		if mount.Type == MountTypeTmpfs {
+			hostMount.TempfsOptions = &docker.TempfsOptions{
+				SizeBytes: mount.TmpfsSize,
+				Mode:      int(mount.TmpfsMode),
+			}
+		}
+		mounts = append(mounts, hostMount)
+	}
+
 	container, err := c.client.CreateContainer(docker.CreateContainerOptions{
+		Name: params.ContainerName,
 		Config: &docker.Config{
 			Cmd:          params.Cmd,
 			Env:          envs,
 			Image:        params.Image,
 			ExposedPorts: exposedPorts,
 			StopSignal:   "SIGWINCH", // to support timeouts
-			Labels:       params.Labels,
+			Labels:       c.sessionLabels(params.Labels, params.Persistent),
 		},
 		HostConfig: &docker.HostConfig{
 			PublishAllPorts: true,
 			PortBindings:    portBindings,
+			Mounts:          mounts,
 		},
+		Context: ctx,
 	})
 	if err != nil {
+		if ctx.Err() != nil {
+			// the request may have reached the daemon before it was cancelled
+			_ = c.client.RemoveContainer(docker.RemoveContainerOptions{ID: params.ContainerName, Force: true})
+		}
 		return nil, errors.WithStack(err)
 	}
-	c.createdContainers[container.ID] = container
+	c.mx.Lock()
+	c.createdContainers[container.ID] = struct{}{}
+	c.mx.Unlock()
+	if params.Created != nil {
+		params.Created(container.ID)
+	}
+
+	if len(params.Files) != 0 {
+		archive, err := TarFiles(params.Files)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.CopyToContainer(ctx, container.ID, "/", bytes.NewReader(archive)); err != nil {
+			return nil, err
+		}
+	}
 
-	if err := c.client.StartContainer(container.ID, nil); err != nil {
+	if err := c.client.StartContainerWithContext(container.ID, nil, ctx); err != nil {
 		return nil, errors.WithStack(err)
 	}
 
@@ -224,18 +360,244 @@ func (c *Client) createContainer(params RunContainerParams) (*docker.Container,
 			EndpointConfig: &docker.EndpointConfig{
 				Aliases: networkConfig.Aliases,
 			},
+			Context: ctx,
 		})
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
 	}
 
-	container, err = c.client.InspectContainer(container.ID)
+	return c.InspectContainer(ctx, container.ID)
+}
+
+func (c *Client) FindContainers(ctx context.Context, labels map[string]string) ([]*Container, error) {
+	containers, err := c.client.ListContainers(docker.ListContainersOptions{
+		All:     true,
+		Filters: map[string][]string{"label": labelFilters(labels)},
+		Context: ctx,
+	})
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
-	return container, err
+	result := make([]*Container, 0, len(containers))
+	for _, container := range containers {
+		inspected, err := c.InspectContainer(ctx, container.ID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, inspected)
+	}
+	return result, nil
+}
+
+func (c *Client) FindNetworks(ctx context.Context, labels map[string]string) ([]*Network, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	filters := docker.NetworkFilterOpts{"label": {}}
+	for _, filter := range labelFilters(labels) {
+		filters["label"][filter] = true
+	}
+	networks, err := c.client.FilteredListNetworks(filters)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	result := make([]*Network, 0, len(networks))
+	for _, network := range networks {
+		result = append(result, &Network{
+			ID:     network.ID,
+			Name:   network.Name,
+			Labels: network.Labels,
+		})
+	}
+	return result, nil
+}
+
+func (c *Client) FindVolumes(ctx context.Context, labels map[string]string) ([]*Volume, error) {
+	volumes, err := c.client.ListVolumes(docker.ListVolumesOptions{
+		Filters: map[string][]string{"label": labelFilters(labels)},
+		Context: ctx,
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	result := make([]*Volume, 0, len(volumes))
+	for _, volume := range volumes {
+		result = append(result, &Volume{
+			Name:   volume.Name,
+			Labels: volume.Labels,
+		})
+	}
+	return result, nil
+}
+
+func (c *Client) InspectContainer(ctx context.Context, id string) (*Container, error) {
+	container, err := c.client.InspectContainerWithContext(id, ctx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return convertContainer(container), nil
+}
+
+func (c *Client) WaitContainer(ctx context.Context, id string) (int, error) {
+	exitCode, err := c.client.WaitContainerWithContext(id, ctx)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return exitCode, nil
+}
+
+func (c *Client) Logs(ctx context.Context, id string, params LogsParams) error {
+	tail := "all"
+	if params.Tail > 0 {
+		tail = strconv.Itoa(params.Tail)
+	}
+
+	var since int64
+	if !params.Since.IsZero() {
+		since = params.Since.Unix()
+	}
+
+	stdout, stderr := params.Stdout, params.Stderr
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+
+	err := c.client.Logs(docker.LogsOptions{
+		Container:    id,
+		OutputStream: stdout,
+		ErrorStream:  stderr,
+		Stdout:       params.Stdout != nil,
+		Stderr:       params.Stderr != nil,
+		Tail:         tail,
+		Since:        since,
+		Follow:       params.Follow,
+		Timestamps:   params.Timestamps,
+		Context:      ctx,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Exec runs params.Cmd in the container. WorkingDir is entered with
+// "sh -c cd", as the exec API doesn't support it, so it requires sh in the
+// container.
+func (c *Client) Exec(ctx context.Context, id string, params ExecParams) (*ExecResult, error) {
+	cmd := params.Cmd
+	if params.WorkingDir != "" {
+		// Exec API of the engine client doesn't support working directory.
+		cmd = append([]string{"sh", "-c", `cd "$0" && exec "$@"`, params.WorkingDir}, cmd...)
+	}
+
+	exec, err := c.client.CreateExec(docker.CreateExecOptions{
+		Container:    id,
+		Cmd:          cmd,
+		Env:          params.Env,
+		User:         params.User,
+		AttachStdin:  params.Stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+		Context:      ctx,
+	})
+	if err != nil {
+		return nil, execError(err, params)
+	}
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	err = c.client.StartExec(exec.ID, docker.StartExecOptions{
+		InputStream:  params.Stdin,
+		OutputStream: stdout,
+		ErrorStream:  stderr,
+		Context:      ctx,
+	})
+	if err != nil {
+		return nil, execError(err, params)
+	}
+
+	inspect, err := c.client.InspectExec(exec.ID)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	result := &ExecResult{
+		ExitCode: inspect.ExitCode,
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+	}
+	if err := missingShellError(params, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// execError names the sh requirement of WorkingDir in exec errors.
+func execError(err error, params ExecParams) error {
+	if params.WorkingDir == "" {
+		return errors.WithStack(err)
+	}
+	return errors.Wrapf(err, "failed to exec in working directory %s, which requires sh in the container", params.WorkingDir)
+}
+
+// missingShellError returns an error if the exec with WorkingDir failed
+// because the container has no sh. The runtime reports it with exit code 126
+// or 127 and a message like `exec: "sh": executable file not found in $PATH`.
+func missingShellError(params ExecParams, result *ExecResult) error {
+	if params.WorkingDir == "" || result.ExitCode != 126 && result.ExitCode != 127 {
+		return nil
+	}
+	output := result.Stdout + result.Stderr
+	if !strings.Contains(output, `"sh"`) {
+		return nil
+	}
+	return errors.Errorf("working directory %s requires sh in the container: %s", params.WorkingDir, strings.TrimSpace(output))
+}
+
+// CopyToContainer extracts tar archive to path inside the container.
+func (c *Client) CopyToContainer(ctx context.Context, id string, path string, archive io.Reader) error {
+	err := c.client.UploadToContainer(id, docker.UploadToContainerOptions{
+		InputStream: archive,
+		Path:        path,
+		Context:     ctx,
+	})
+	return errors.WithStack(err)
+}
+
+// CopyFromContainer writes tar archive of path inside the container to w.
+func (c *Client) CopyFromContainer(ctx context.Context, id string, path string, w io.Writer) error {
+	err := c.client.DownloadFromContainer(id, docker.DownloadFromContainerOptions{
+		OutputStream: w,
+		Path:         path,
+		Context:      ctx,
+	})
+	return errors.WithStack(err)
+}
+
+// Host returns the address on which published container ports are reachable.
+func (c *Client) Host() string {
+	endpoint, err := url.Parse(c.client.Endpoint())
+	if err != nil {
+		return "localhost"
+	}
+
+	switch endpoint.Scheme {
+	case "tcp", "http", "https":
+		if host := endpoint.Hostname(); host != "" {
+			return host
+		}
+	}
+	return "localhost"
 }
 
 func (c *Client) dockerAuthConfigs() (*docker.AuthConfigurations, error) {
@@ -257,8 +619,51 @@ func NewClient() (*Client, error) {
 	}
 	return &Client{
 		client:            client,
-		createdContainers: map[string]*docker.Container{},
-		createdNetworks:   map[string]*docker.Network{},
+		sessionID:         uuid.NewV4().String(),
+		createdContainers: map[string]struct{}{},
+		createdNetworks:   map[string]struct{}{},
 		builtImages:       map[string]struct{}{},
+		createdVolumes:    map[string]struct{}{},
 	}, nil
 }
+
+func labelFilters(labels map[string]string) []string {
+	filters := make([]string, 0, len(labels))
+	for key, value := range labels {
+		filters = append(filters, key+"="+value)
+	}
+	return filters
+}
+
+func convertContainer(container *docker.Container) *Container {
+	result := &Container{
+		ID:    container.ID,
+		Name:  container.Name,
+		Image: container.Image,
+		Ports: map[string][]PortBinding{},
+		State: ContainerState{
+			Status:     container.State.StateString(),
+			Running:    container.State.Running,
+			ExitCode:   container.State.ExitCode,
+			OOMKilled:  container.State.OOMKilled,
+			Error:      container.State.Error,
+			StartedAt:  container.State.StartedAt,
+			FinishedAt: container.State.FinishedAt,
+		},
+	}
+	if container.Config != nil {
+		result.Labels = container.Config.Labels
+	}
+	if container.NetworkSettings != nil {
+		for port, bindings := range container.NetworkSettings.Ports {
+			for _, binding := range bindings {
+				result.Ports[string(port)] = append(result.Ports[string(port)], PortBinding{
+					Host: binding.HostIP,
+					Port: binding.HostPort,
+				})
+			}
+		}
+	}
+
+	return result
+}
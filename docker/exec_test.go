@@ -0,0 +1,22 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMissingShellError(t *testing.T) {
+	missing := &ExecResult{
+		ExitCode: 126,
+		Stdout:   `OCI runtime exec failed: exec failed: unable to start container process: exec: "sh": executable file not found in $PATH` + "\n",
+	}
+	err := missingShellError(ExecParams{WorkingDir: "/app"}, missing)
+	require.EqualError(t, err, `working directory /app requires sh in the container: `+
+		`OCI runtime exec failed: exec failed: unable to start container process: exec: "sh": executable file not found in $PATH`)
+	require.NoError(t, missingShellError(ExecParams{}, missing))
+
+	notFound := &ExecResult{ExitCode: 127, Stderr: "sh: exec: line 1: psql: not found\n"}
+	require.NoError(t, missingShellError(ExecParams{WorkingDir: "/app"}, notFound))
+	require.NoError(t, missingShellError(ExecParams{WorkingDir: "/app"}, &ExecResult{ExitCode: 1}))
+}
@@ -1,5 +1,28 @@
 package docker
 
+import (
+	"io"
+	"os"
+	"time"
+)
+
+type MountType string
+
+const (
+	MountTypeBind   MountType = "bind"
+	MountTypeVolume MountType = "volume"
+	MountTypeTmpfs  MountType = "tmpfs"
+)
+
+type Mount struct {
+	Type      MountType
+	Source    string
+	Target    string
+	ReadOnly  bool
+	TmpfsSize int64
+	TmpfsMode os.FileMode
+}
+
 type RunContainerNetworkConfig struct {
 	Aliases []string
 }
@@ -17,17 +40,122 @@ type RunContainerParams struct {
 	Networks      map[string]RunContainerNetworkConfig
 	Labels        map[string]string
 	PortBindings  map[string][]PortBinding
+	Mounts        []Mount
+	Files         []File
+	Persistent    bool
+	// Offline forbids pulling Image if it's missing, like $TESTENV_OFFLINE.
+	Offline bool `json:"-"`
+	// Created, if set, is called with ID of the container once it's created,
+	// before it's started.
+	Created func(id string) `json:"-"`
 }
 
 type CreateNetworkParams struct {
-	Driver  string
-	Options map[string]interface{}
-	Labels  map[string]string
+	Driver     string
+	Options    map[string]interface{}
+	Labels     map[string]string
+	Persistent bool
 }
 
+// BuildImageParams describes an image build. Name is the image tag, a random
+// one is generated if it's empty. The build context is ContextArchive, a tar
+// archive, or the ContextDir directory without files excluded by
+// .dockerignore. DockerfileContent, if set, is added to the context and used
+// instead of the Dockerfile file. Build output is written to Output.
+// Persistent images are not removed by Cleanup.
 type BuildImageParams struct {
-	Dockerfile string
-	ContextDir string
+	Name              string
+	Dockerfile        string
+	DockerfileContent []byte
+	ContextDir        string
+	ContextArchive    []byte
+	Labels            map[string]string
+	BuildArgs         map[string]string
+	Target            string
+	Platform          string
+	NoCache           bool
+	Pull              bool
+	Output            io.Writer
+	Persistent        bool
+}
+
+// PullImageParams describes an image pull. Progress, if set, is called for
+// every progress message of the registry.
+type PullImageParams struct {
+	Image    string
+	Progress func(progress PullProgress)
+}
+
+// PullProgress is the state of a layer being pulled. Current and Total are
+// in bytes and are zero for statuses without progress.
+type PullProgress struct {
+	Layer   string
+	Status  string
+	Current int64
+	Total   int64
+}
+
+type ExecParams struct {
+	Cmd   []string
+	Stdin io.Reader
+	Env   []string
+	User  string
+	// WorkingDir requires sh in the container, see Client.Exec.
+	WorkingDir string
+}
+
+type ExecResult struct {
+	ExitCode int
+	Stdout   string
+	Stderr   string
+}
+
+type CreateVolumeParams struct {
+	Driver     string
+	Options    map[string]string
 	Labels     map[string]string
-	BuildArgs  map[string]string
+	Persistent bool
+}
+
+type Volume struct {
+	Name   string
+	Labels map[string]string
+}
+
+type Network struct {
+	ID     string
+	Name   string
+	Labels map[string]string
+}
+
+type ContainerState struct {
+	Status     string
+	Running    bool
+	ExitCode   int
+	OOMKilled  bool
+	Error      string
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+type Container struct {
+	ID     string
+	Name   string
+	Image  string
+	Labels map[string]string
+	// Ports maps container ports in "port/proto" form to published host ports.
+	Ports map[string][]PortBinding
+	State ContainerState
+}
+
+// LogsParams describes which container output to fetch. Only streams with a
+// non-nil writer are fetched. Tail limits output to the given number of
+// last lines, zero means all lines.
+type LogsParams struct {
+	Stdout     io.Writer
+	Stderr     io.Writer
+	Since      time.Time
+	Tail       int
+	Follow     bool
+	Timestamps bool
 }
@@ -0,0 +1,88 @@
+package docker
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/ory/dockertest/docker"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+// Prune removes containers, networks, volumes and built images of other
+// sessions which were created more than olderThan ago.
+func (c *Client) Prune(ctx context.Context, olderThan time.Duration) error {
+	deadline := time.Now().Add(-olderThan)
+	stale := func(labels map[string]string) bool {
+		return isStale(labels, c.sessionID, deadline)
+	}
+	filters := map[string][]string{"label": {LabelSession}}
+
+	var err error
+
+	containers, listErr := c.client.ListContainers(docker.ListContainersOptions{All: true, Filters: filters, Context: ctx})
+	if listErr != nil {
+		return errors.Wrap(listErr, "failed to list containers")
+	}
+	for _, container := range containers {
+		if stale(container.Labels) {
+			removeErr := c.client.RemoveContainer(docker.RemoveContainerOptions{
+				ID:            container.ID,
+				RemoveVolumes: true,
+				Force:         true,
+				Context:       ctx,
+			})
+			err = multierr.Append(err, errors.Wrapf(removeErr, "failed to remove container %s", container.ID))
+		}
+	}
+
+	networks, listErr := c.client.FilteredListNetworks(docker.NetworkFilterOpts{"label": {LabelSession: true}})
+	if listErr != nil {
+		return multierr.Append(err, errors.Wrap(listErr, "failed to list networks"))
+	}
+	for _, network := range networks {
+		if stale(network.Labels) {
+			removeErr := c.client.RemoveNetwork(network.ID)
+			err = multierr.Append(err, errors.Wrapf(removeErr, "failed to remove network %s", network.ID))
+		}
+	}
+
+	volumes, listErr := c.client.ListVolumes(docker.ListVolumesOptions{Filters: filters, Context: ctx})
+	if listErr != nil {
+		return multierr.Append(err, errors.Wrap(listErr, "failed to list volumes"))
+	}
+	for _, volume := range volumes {
+		if stale(volume.Labels) {
+			removeErr := c.client.RemoveVolumeWithOptions(docker.RemoveVolumeOptions{Name: volume.Name, Context: ctx})
+			err = multierr.Append(err, errors.Wrapf(removeErr, "failed to remove volume %s", volume.Name))
+		}
+	}
+
+	images, listErr := c.client.ListImages(docker.ListImagesOptions{Filters: filters, Context: ctx})
+	if listErr != nil {
+		return multierr.Append(err, errors.Wrap(listErr, "failed to list images"))
+	}
+	for _, image := range images {
+		if stale(image.Labels) {
+			removeErr := c.client.RemoveImageExtended(image.ID, docker.RemoveImageOptions{Force: true, Context: ctx})
+			err = multierr.Append(err, errors.Wrapf(removeErr, "failed to remove image %s", image.ID))
+		}
+	}
+
+	return err
+}
+
+// isStale reports whether resource labels belong to a session other than
+// sessionID, which created the resource before deadline.
+func isStale(labels map[string]string, sessionID string, deadline time.Time) bool {
+	session, ok := labels[LabelSession]
+	if !ok || session == sessionID {
+		return false
+	}
+	created, err := strconv.ParseInt(labels[LabelCreated], 10, 64)
+	if err != nil {
+		return false
+	}
+	return time.Unix(created, 0).Before(deadline)
+}
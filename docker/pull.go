@@ -0,0 +1,105 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+
+	"github.com/ory/dockertest/docker"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+type pullMessage struct {
+	ID             string `json:"id"`
+	Status         string `json:"status"`
+	ProgressDetail struct {
+		Current int64 `json:"current"`
+		Total   int64 `json:"total"`
+	} `json:"progressDetail"`
+	Error       string `json:"error"`
+	ErrorDetail struct {
+		Message string `json:"message"`
+	} `json:"errorDetail"`
+}
+
+// PullImage pulls an image using credentials of its registry from docker
+// config.
+func (c *Client) PullImage(ctx context.Context, params PullImageParams) error {
+	ref, err := ParseReference(params.Image)
+	if err != nil {
+		return err
+	}
+	if Offline() {
+		return errors.Errorf("failed to pull image %s: pulling is disabled in offline mode", ref)
+	}
+
+	authConfigs, err := c.dockerAuthConfigs()
+	if err != nil {
+		return err
+	}
+
+	tag := ref.Tag
+	if ref.Digest != "" {
+		tag = ref.Digest
+	}
+
+	reader, writer := io.Pipe()
+	progressErr := make(chan error, 1)
+	go func() {
+		progressErr <- readPullProgress(reader, params.Progress)
+	}()
+
+	err = c.client.PullImage(docker.PullImageOptions{
+		Repository:    ref.Name(),
+		Tag:           tag,
+		OutputStream:  writer,
+		RawJSONStream: true,
+		Context:       ctx,
+	}, registryAuth(authConfigs, ref.Registry))
+	writer.Close()
+	err = multierr.Append(err, <-progressErr)
+	return errors.Wrapf(err, "failed to pull image %s", ref)
+}
+
+// registryAuth returns credentials of docker config for registry.
+func registryAuth(configs *docker.AuthConfigurations, registry string) docker.AuthConfiguration {
+	for server, config := range configs.Configs {
+		if registryHost(server) == registry {
+			return config
+		}
+	}
+	return docker.AuthConfiguration{}
+}
+
+// readPullProgress passes pull progress to progress and returns the pull
+// error reported by the registry. r is always read to the end.
+func readPullProgress(r io.Reader, progress func(PullProgress)) error {
+	defer io.Copy(ioutil.Discard, r)
+
+	decoder := json.NewDecoder(r)
+	for {
+		var message pullMessage
+		if err := decoder.Decode(&message); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "failed to read pull progress")
+		}
+
+		if message.Error != "" {
+			if message.ErrorDetail.Message != "" {
+				return errors.New(message.ErrorDetail.Message)
+			}
+			return errors.New(message.Error)
+		}
+		if progress != nil && message.Status != "" {
+			progress(PullProgress{
+				Layer:   message.ID,
+				Status:  message.Status,
+				Current: message.ProgressDetail.Current,
+				Total:   message.ProgressDetail.Total,
+			})
+		}
+	}
+}
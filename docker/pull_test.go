@@ -0,0 +1,41 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ory/dockertest/docker"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryAuth(t *testing.T) {
+	configs := &docker.AuthConfigurations{Configs: map[string]docker.AuthConfiguration{
+		"https://index.docker.io/v1/":   {Username: "hub"},
+		"localhost:5000":                {Username: "local"},
+		"https://registry.example.com":  {Username: "example"},
+		"registry.example.com.evil.com": {Username: "evil"},
+	}}
+
+	for registry, username := range map[string]string{
+		"docker.io":            "hub",
+		"localhost:5000":       "local",
+		"registry.example.com": "example",
+		"localhost":            "",
+		"registry.example":     "",
+	} {
+		require.Equal(t, username, registryAuth(configs, registry).Username, registry)
+	}
+}
+
+func TestReadPullProgress(t *testing.T) {
+	var statuses []string
+	err := readPullProgress(strings.NewReader(`
+		{"status":"Pulling from library/alpine","id":"3.10"}
+		{"status":"Downloading","progressDetail":{"current":10,"total":100},"id":"a1"}
+		{"error":"unauthorized","errorDetail":{"message":"unauthorized: authentication required"}}
+	`), func(progress PullProgress) {
+		statuses = append(statuses, progress.Layer+" "+progress.Status)
+	})
+	require.EqualError(t, err, "unauthorized: authentication required")
+	require.Equal(t, []string{"3.10 Pulling from library/alpine", "a1 Downloading"}, statuses)
+}
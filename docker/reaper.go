@@ -0,0 +1,177 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ory/dockertest/docker"
+	"github.com/pkg/errors"
+)
+
+const (
+	reaperEnv            = "TESTENV_REAPER"
+	reaperDisabledEnv    = "TESTENV_REAPER_DISABLED"
+	reaperImageEnv       = "TESTENV_REAPER_IMAGE"
+	reaperSocketEnv      = "TESTENV_REAPER_DOCKER_SOCKET"
+	defaultReaperImage   = "testcontainers/ryuk:0.3.4"
+	reaperPort           = "8080/tcp"
+	reaperConnectTimeout = 30 * time.Second
+)
+
+// reaperImage returns image of the reaper, or an empty string if the reaper
+// is disabled with TESTENV_REAPER=off or TESTENV_REAPER_DISABLED=true.
+func reaperImage() string {
+	if disabled, _ := strconv.ParseBool(os.Getenv(reaperDisabledEnv)); disabled {
+		return ""
+	}
+	switch strings.ToLower(os.Getenv(reaperEnv)) {
+	case "off", "false", "0", "disabled":
+		return ""
+	}
+	if image := os.Getenv(reaperImageEnv); image != "" {
+		return image
+	}
+	return defaultReaperImage
+}
+
+// HelperImages returns the reaper image, unless the reaper is disabled.
+func (c *Client) HelperImages() []string {
+	if image := reaperImage(); image != "" {
+		return []string{image}
+	}
+	return nil
+}
+
+// reaperDockerSocket returns path of the docker socket on the daemon host,
+// which is mounted into the reaper container. It's taken from the unix
+// endpoint of the client, as the socket of a remote daemon is unknown.
+func reaperDockerSocket(endpoint string) (string, error) {
+	if socket := os.Getenv(reaperSocketEnv); socket != "" {
+		return socket, nil
+	}
+
+	parsed, err := url.Parse(endpoint)
+	if err == nil && parsed.Scheme == "unix" && parsed.Path != "" {
+		return parsed.Path, nil
+	}
+	return "", errors.Errorf("docker socket of %s is unknown, set $%s to its path on the docker host",
+		endpoint, reaperSocketEnv)
+}
+
+// startReaper starts a sidecar container which removes every resource of the
+// session once the connection to it is closed, e.g. when the test process
+// is killed. The connection stays open until the process exits.
+func (c *Client) startReaper(ctx context.Context) error {
+	c.reaperMx.Lock()
+	defer c.reaperMx.Unlock()
+
+	if c.reaperConn != nil {
+		return nil
+	}
+	image := reaperImage()
+	if image == "" {
+		return nil
+	}
+
+	conn, err := c.runReaper(ctx, image)
+	if err != nil {
+		return errors.Wrapf(err, "failed to start reaper, it can be disabled with $%s=off", reaperEnv)
+	}
+	c.reaperConn = conn
+	return nil
+}
+
+func (c *Client) runReaper(ctx context.Context, image string) (net.Conn, error) {
+	socket, err := reaperDockerSocket(c.client.Endpoint())
+	if err != nil {
+		return nil, err
+	}
+
+	container, err := c.createReaper(ctx, image, socket)
+	if errors.Cause(err) == docker.ErrNoSuchImage {
+		if err := c.PullImage(ctx, PullImageParams{Image: image}); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		container, err = c.createReaper(ctx, image, socket)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create reaper container")
+	}
+
+	if err := c.client.StartContainerWithContext(container.ID, nil, ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to start reaper container")
+	}
+
+	container, err = c.client.InspectContainerWithContext(container.ID, ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to inspect reaper container")
+	}
+	bindings := container.NetworkSettings.Ports[reaperPort]
+	if len(bindings) == 0 {
+		return nil, errors.New("reaper container has no published port")
+	}
+
+	conn, err := c.connectReaper(ctx, net.JoinHostPort(c.Host(), bindings[0].HostPort))
+	return conn, errors.Wrap(err, "failed to connect to reaper")
+}
+
+func (c *Client) createReaper(ctx context.Context, image, socket string) (*docker.Container, error) {
+	container, err := c.client.CreateContainer(docker.CreateContainerOptions{
+		Config: &docker.Config{
+			Image:        image,
+			ExposedPorts: map[docker.Port]struct{}{reaperPort: {}},
+			Labels:       map[string]string{LabelSession + ".reaper": c.sessionID},
+		},
+		HostConfig: &docker.HostConfig{
+			AutoRemove:      true,
+			PublishAllPorts: true,
+			Binds:           []string{socket + ":/var/run/docker.sock"},
+		},
+		Context: ctx,
+	})
+	return container, errors.WithStack(err)
+}
+
+func (c *Client) connectReaper(ctx context.Context, address string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, reaperConnectTimeout)
+	defer cancel()
+
+	dialer := &net.Dialer{}
+	for {
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err == nil {
+			if err = registerReaperFilter(conn, c.sessionID); err == nil {
+				return conn, nil
+			}
+			_ = conn.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrapf(err, "reaper is not reachable at %s", address)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func registerReaperFilter(conn net.Conn, sessionID string) error {
+	if _, err := fmt.Fprintf(conn, "label=%s=%s\n", LabelSession, sessionID); err != nil {
+		return errors.WithStack(err)
+	}
+
+	ack, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if strings.TrimSpace(ack) != "ACK" {
+		return errors.Errorf("unexpected reaper response %q", ack)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaperImage(t *testing.T) {
+	require.Equal(t, defaultReaperImage, reaperImage())
+
+	os.Setenv(reaperImageEnv, "registry.local/ryuk:1")
+	defer os.Unsetenv(reaperImageEnv)
+	require.Equal(t, "registry.local/ryuk:1", reaperImage())
+
+	require.Equal(t, []string{"registry.local/ryuk:1"}, (&Client{}).HelperImages())
+
+	os.Setenv(reaperEnv, "off")
+	require.Empty(t, reaperImage())
+	require.Empty(t, (&Client{}).HelperImages())
+	os.Unsetenv(reaperEnv)
+
+	os.Setenv(reaperDisabledEnv, "true")
+	defer os.Unsetenv(reaperDisabledEnv)
+	require.Empty(t, reaperImage())
+}
+
+func TestReaperDockerSocket(t *testing.T) {
+	socket, err := reaperDockerSocket("unix:///run/user/1000/docker.sock")
+	require.NoError(t, err)
+	require.Equal(t, "/run/user/1000/docker.sock", socket)
+
+	_, err = reaperDockerSocket("tcp://10.0.0.1:2376")
+	require.EqualError(t, err, "docker socket of tcp://10.0.0.1:2376 is unknown, set $TESTENV_REAPER_DOCKER_SOCKET to its path on the docker host")
+
+	os.Setenv(reaperSocketEnv, "/var/run/docker.sock")
+	defer os.Unsetenv(reaperSocketEnv)
+	socket, err = reaperDockerSocket("tcp://10.0.0.1:2376")
+	require.NoError(t, err)
+	require.Equal(t, "/var/run/docker.sock", socket)
+}
+
+func TestConnectReaper(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	filters := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		filter, _ := bufio.NewReader(conn).ReadString('\n')
+		filters <- filter
+		_, _ = conn.Write([]byte("ACK\n"))
+		_, _ = bufio.NewReader(conn).ReadString('\n')
+	}()
+
+	client := &Client{sessionID: "session-1"}
+	conn, err := client.connectReaper(context.Background(), listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, "label=testenv.session=session-1\n", <-filters)
+}
+
+func TestRegisterReaperFilterUnexpectedResponse(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		_, _ = bufio.NewReader(server).ReadString('\n')
+		_, _ = server.Write([]byte("NOPE\n"))
+	}()
+	require.EqualError(t, registerReaperFilter(client, "session-1"), `unexpected reaper response "NOPE\n"`)
+}
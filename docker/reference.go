@@ -0,0 +1,126 @@
+package docker
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultRegistry  = "docker.io"
+	officialRepoPath = "library/"
+	defaultTag       = "latest"
+)
+
+var (
+	pathComponentRegexp = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*$`)
+	tagRegexp           = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestRegexp        = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]{32,}$`)
+)
+
+// Reference is a parsed image reference, e.g. "localhost:5000/app:1" or
+// "alpine@sha256:...". Registry defaults to docker.io and repositories of
+// docker.io without a namespace are prefixed with "library/". Tag defaults to
+// "latest" when neither Tag nor Digest is set.
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses and normalizes image reference.
+func ParseReference(image string) (Reference, error) {
+	if image == "" {
+		return Reference{}, errors.New("empty image reference")
+	}
+
+	var ref Reference
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, ref.Digest = name[:i], name[i+1:]
+		if !digestRegexp.MatchString(ref.Digest) {
+			return Reference{}, errors.Errorf("invalid digest in image reference %q", image)
+		}
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.Tag = name[:i], name[i+1:]
+		if !tagRegexp.MatchString(ref.Tag) {
+			return Reference{}, errors.Errorf("invalid tag in image reference %q", image)
+		}
+	}
+
+	ref.Registry = defaultRegistry
+	if i := strings.Index(name, "/"); i >= 0 && isRegistry(name[:i]) {
+		ref.Registry, name = normalizeRegistry(name[:i]), name[i+1:]
+	}
+	if ref.Registry == defaultRegistry && !strings.Contains(name, "/") {
+		name = officialRepoPath + name
+	}
+	for _, component := range strings.Split(name, "/") {
+		if !pathComponentRegexp.MatchString(component) {
+			return Reference{}, errors.Errorf("invalid repository name in image reference %q", image)
+		}
+	}
+	ref.Repository = name
+
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = defaultTag
+	}
+	return ref, nil
+}
+
+// Name returns the repository with its registry.
+func (r Reference) Name() string {
+	return r.Registry + "/" + r.Repository
+}
+
+// FamiliarName returns the repository in the short form used by docker CLI,
+// without the default registry and "library/" prefix.
+func (r Reference) FamiliarName() string {
+	if r.Registry != defaultRegistry {
+		return r.Name()
+	}
+	return strings.TrimPrefix(r.Repository, officialRepoPath)
+}
+
+func (r Reference) String() string {
+	result := r.FamiliarName()
+	if r.Tag != "" {
+		result += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		result += "@" + r.Digest
+	}
+	return result
+}
+
+// isRegistry reports whether the first component of the image name is a
+// registry host, the same way docker CLI does.
+func isRegistry(component string) bool {
+	return strings.ContainsAny(component, ".:") || component == "localhost" || strings.ToLower(component) != component
+}
+
+func normalizeRegistry(host string) string {
+	switch host {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return defaultRegistry
+	}
+	return host
+}
+
+// registryHost returns registry host of a server address from docker config,
+// e.g. "https://index.docker.io/v1/" or "localhost:5000".
+func registryHost(server string) string {
+	if strings.Contains(server, "://") {
+		if u, err := url.Parse(server); err == nil {
+			server = u.Host
+		}
+	}
+	if i := strings.Index(server, "/"); i >= 0 {
+		server = server[:i]
+	}
+	return normalizeRegistry(server)
+}
@@ -0,0 +1,49 @@
+package docker_test
+
+import (
+	"testing"
+
+	"github.com/saturn4er/go-testenv/docker"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReference(t *testing.T) {
+	digest := "sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	for image, expected := range map[string]docker.Reference{
+		"alpine":                   {Registry: "docker.io", Repository: "library/alpine", Tag: "latest"},
+		"alpine:3.10":              {Registry: "docker.io", Repository: "library/alpine", Tag: "3.10"},
+		"bitnami/kafka:2":          {Registry: "docker.io", Repository: "bitnami/kafka", Tag: "2"},
+		"index.docker.io/postgres": {Registry: "docker.io", Repository: "library/postgres", Tag: "latest"},
+		"localhost:5000/app:1":     {Registry: "localhost:5000", Repository: "app", Tag: "1"},
+		"localhost/app":            {Registry: "localhost", Repository: "app", Tag: "latest"},
+		"ghcr.io/org/team/app:v1":  {Registry: "ghcr.io", Repository: "org/team/app", Tag: "v1"},
+		"alpine@" + digest:         {Registry: "docker.io", Repository: "library/alpine", Digest: digest},
+		"my.registry:443/app:1@" + digest: {
+			Registry: "my.registry:443", Repository: "app", Tag: "1", Digest: digest,
+		},
+	} {
+		ref, err := docker.ParseReference(image)
+		require.NoError(t, err, image)
+		require.Equal(t, expected, ref, image)
+	}
+
+	for _, image := range []string{"", "Alpine", "alpine:", "alpine:-bad", "alpine@sha256:123", "app//name", "-app"} {
+		_, err := docker.ParseReference(image)
+		require.Error(t, err, image)
+	}
+}
+
+func TestReferenceString(t *testing.T) {
+	for image, expected := range map[string]string{
+		"alpine":                   "alpine:latest",
+		"docker.io/library/alpine": "alpine:latest",
+		"bitnami/kafka:2":          "bitnami/kafka:2",
+		"localhost:5000/app:1":     "localhost:5000/app:1",
+		"registry-1.docker.io/a/b": "a/b:latest",
+	} {
+		ref, err := docker.ParseReference(image)
+		require.NoError(t, err, image)
+		require.Equal(t, expected, ref.String(), image)
+	}
+}
@@ -0,0 +1,33 @@
+package docker
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	LabelSession = "testenv.session"
+	LabelCreated = "testenv.created"
+)
+
+// SessionID identifies resources created by the client. It is stored in the
+// LabelSession label of every container, network, volume and built image.
+func (c *Client) SessionID() string {
+	return c.sessionID
+}
+
+// sessionLabels returns labels with the session labels added, unless the
+// resource is persistent and must outlive the session.
+func (c *Client) sessionLabels(labels map[string]string, persistent bool) map[string]string {
+	if persistent {
+		return labels
+	}
+
+	result := make(map[string]string, len(labels)+2)
+	for key, value := range labels {
+		result[key] = value
+	}
+	result[LabelSession] = c.sessionID
+	result[LabelCreated] = strconv.FormatInt(time.Now().Unix(), 10)
+	return result
+}
@@ -0,0 +1,45 @@
+package docker
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionLabels(t *testing.T) {
+	client := &Client{sessionID: "session-1"}
+	labels := map[string]string{"app": "db"}
+
+	result := client.sessionLabels(labels, false)
+	require.Equal(t, "db", result["app"])
+	require.Equal(t, "session-1", result[LabelSession])
+	created, err := strconv.ParseInt(result[LabelCreated], 10, 64)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now(), time.Unix(created, 0), time.Minute)
+	require.Equal(t, map[string]string{"app": "db"}, labels)
+
+	require.Equal(t, labels, client.sessionLabels(labels, true))
+}
+
+func TestIsStale(t *testing.T) {
+	now := time.Now()
+	created := func(at time.Time) string {
+		return strconv.FormatInt(at.Unix(), 10)
+	}
+	deadline := now.Add(-time.Hour)
+
+	for name, test := range map[string]struct {
+		labels map[string]string
+		stale  bool
+	}{
+		"old session":     {map[string]string{LabelSession: "other", LabelCreated: created(now.Add(-2 * time.Hour))}, true},
+		"recent session":  {map[string]string{LabelSession: "other", LabelCreated: created(now)}, false},
+		"current session": {map[string]string{LabelSession: "current", LabelCreated: created(now.Add(-2 * time.Hour))}, false},
+		"persistent":      {map[string]string{"app": "db"}, false},
+		"invalid created": {map[string]string{LabelSession: "other", LabelCreated: "yesterday"}, false},
+	} {
+		require.Equal(t, test.stale, isStale(test.labels, "current", deadline), name)
+	}
+}
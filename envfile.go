@@ -0,0 +1,595 @@
+package testenv
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/saturn4er/go-testenv/docker"
+	"go.uber.org/multierr"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type Hook func(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv) error
+
+// HookRegistry holds Go hooks referenced by name from environment files.
+type HookRegistry struct {
+	mx    sync.RWMutex
+	hooks map[string]Hook
+}
+
+func NewHookRegistry() *HookRegistry {
+	return &HookRegistry{
+		hooks: map[string]Hook{},
+	}
+}
+
+func (r *HookRegistry) Register(name string, hook Hook) {
+	r.mx.Lock()
+	r.hooks[name] = hook
+	r.mx.Unlock()
+}
+
+func (r *HookRegistry) hook(name string) (Hook, error) {
+	if name == "" {
+		return nil, nil
+	}
+	if r == nil {
+		return nil, errors.Errorf("no hook %s registered", name)
+	}
+
+	r.mx.RLock()
+	hook, ok := r.hooks[name]
+	r.mx.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("no hook %s registered", name)
+	}
+	return hook, nil
+}
+
+// LoadProjectEnvDesc reads a YAML or JSON environment file. Relative host
+// paths in it are resolved against the directory of the file. String values
+// support placeholders: ${env:NAME}, ${project:KEY}, ${testCase:KEY} and
+// ${port:CONTAINER:PORT}, see ParseProjectEnvDesc.
+func LoadProjectEnvDesc(path string, hooks *HookRegistry) (ProjectEnvDesc, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ProjectEnvDesc{}, errors.WithStack(err)
+	}
+
+	desc, err := parseProjectEnvDesc(data, filepath.Dir(path), hooks)
+	return desc, errors.Wrapf(err, "failed to load %s", path)
+}
+
+// ParseProjectEnvDesc parses a YAML or JSON environment description.
+// Relative host paths are resolved against the working directory. A
+// ${port:CONTAINER:PORT} placeholder makes the container depend on CONTAINER.
+func ParseProjectEnvDesc(data []byte, hooks *HookRegistry) (ProjectEnvDesc, error) {
+	return parseProjectEnvDesc(data, "", hooks)
+}
+
+type envFile struct {
+	Networks       map[string]envFileNetwork   `yaml:"networks"`
+	Volumes        map[string]envFileVolume    `yaml:"volumes"`
+	Containers     map[string]envFileContainer `yaml:"containers"`
+	TestCase       envFileTestCase             `yaml:"testCase"`
+	MaxParallelism int                         `yaml:"maxParallelism"`
+	ArtifactsDir   string                      `yaml:"artifactsDir"`
+	Reuse          bool                        `yaml:"reuse"`
+	Preflight      bool                        `yaml:"preflight"`
+}
+
+type envFileTestCase struct {
+	Networks   map[string]envFileNetwork   `yaml:"networks"`
+	Volumes    map[string]envFileVolume    `yaml:"volumes"`
+	Containers map[string]envFileContainer `yaml:"containers"`
+	Hooks      envFileHooks                `yaml:"hooks"`
+}
+
+type envFileNetwork struct {
+	Labels map[string]string `yaml:"labels"`
+}
+
+type envFileVolume struct {
+	Driver  string            `yaml:"driver"`
+	Options map[string]string `yaml:"options"`
+	Labels  map[string]string `yaml:"labels"`
+}
+
+type envFileContainer struct {
+	Image               string               `yaml:"image"`
+	PullPolicy          string               `yaml:"pullPolicy"`
+	Build               *envFileBuild        `yaml:"build"`
+	Cmd                 []string             `yaml:"cmd"`
+	Env                 map[string]string    `yaml:"env"`
+	Labels              map[string]string    `yaml:"labels"`
+	Ports               []string             `yaml:"ports"`
+	PortBindings        []envFilePortBinding `yaml:"portBindings"`
+	Networks            []envFileNetworkRef  `yaml:"networks"`
+	Mounts              []envFileMount       `yaml:"mounts"`
+	Files               []envFileFile        `yaml:"files"`
+	DependsOn           []string             `yaml:"dependsOn"`
+	DependsOnConditions map[string]string    `yaml:"dependsOnConditions"`
+	Wait                *envFileWait         `yaml:"wait"`
+	WaitTimeout         string               `yaml:"waitTimeout"`
+	CaptureLogs         bool                 `yaml:"captureLogs"`
+	Hooks               envFileHooks         `yaml:"hooks"`
+}
+
+type envFileBuild struct {
+	Dockerfile       string            `yaml:"dockerfile"`
+	DockerfileInline string            `yaml:"dockerfileInline"`
+	Context          string            `yaml:"context"`
+	Labels           map[string]string `yaml:"labels"`
+	Args             map[string]string `yaml:"args"`
+	Target           string            `yaml:"target"`
+	Platform         string            `yaml:"platform"`
+	NoCache          bool              `yaml:"noCache"`
+	Pull             bool              `yaml:"pull"`
+	Keep             bool              `yaml:"keep"`
+}
+
+type envFilePortBinding struct {
+	ContainerPort string `yaml:"containerPort"`
+	Host          string `yaml:"host"`
+	Port          string `yaml:"port"`
+}
+
+type envFileNetworkRef struct {
+	Network string `yaml:"network"`
+	Alias   string `yaml:"alias"`
+}
+
+type envFileMount struct {
+	Type     string `yaml:"type"`
+	Source   string `yaml:"source"`
+	Target   string `yaml:"target"`
+	ReadOnly bool   `yaml:"readOnly"`
+	Size     int64  `yaml:"size"`
+	Mode     uint32 `yaml:"mode"`
+}
+
+type envFileFile struct {
+	Path     string `yaml:"path"`
+	Content  string `yaml:"content"`
+	HostFile string `yaml:"hostFile"`
+	Mode     uint32 `yaml:"mode"`
+}
+
+type envFileWait struct {
+	Log  string           `yaml:"log"`
+	Port string           `yaml:"port"`
+	HTTP *envFileWaitHTTP `yaml:"http"`
+	Exec []string         `yaml:"exec"`
+	All  []envFileWait    `yaml:"all"`
+	Any  []envFileWait    `yaml:"any"`
+}
+
+type envFileWaitHTTP struct {
+	Port       string `yaml:"port"`
+	Path       string `yaml:"path"`
+	StatusCode int    `yaml:"statusCode"`
+}
+
+type envFileHooks struct {
+	BeforeRun string `yaml:"beforeRun"`
+	AfterRun  string `yaml:"afterRun"`
+}
+
+// envFileScope resolves names of networks and volumes referenced by
+// containers of the project or the test case.
+type envFileScope struct {
+	dir              string
+	hooks            *HookRegistry
+	testCase         bool
+	testCaseNetworks map[string]envFileNetwork
+	testCaseVolumes  map[string]envFileVolume
+}
+
+func parseProjectEnvDesc(data []byte, dir string, hooks *HookRegistry) (ProjectEnvDesc, error) {
+	var file envFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return ProjectEnvDesc{}, errors.Wrap(err, "failed to parse environment")
+	}
+
+	desc := ProjectEnvDesc{
+		Containers:     map[string]ContainerDesc{},
+		MaxParallelism: file.MaxParallelism,
+		ArtifactsDir:   file.ArtifactsDir,
+		Reuse:          file.Reuse,
+		Preflight:      file.Preflight,
+		TestCaseEnv: TestCaseEnvDesc{
+			Containers: map[string]*ContainerDesc{},
+		},
+	}
+
+	var err error
+	var convertErr error
+	if desc.Networks, convertErr = convertEnvFileNetworks(file.Networks); convertErr != nil {
+		err = multierr.Append(err, errors.Wrap(convertErr, "networks"))
+	}
+	if desc.Volumes, convertErr = convertEnvFileVolumes(file.Volumes); convertErr != nil {
+		err = multierr.Append(err, errors.Wrap(convertErr, "volumes"))
+	}
+	if desc.TestCaseEnv.Networks, convertErr = convertEnvFileNetworks(file.TestCase.Networks); convertErr != nil {
+		err = multierr.Append(err, errors.Wrap(convertErr, "test case networks"))
+	}
+	if desc.TestCaseEnv.Volumes, convertErr = convertEnvFileVolumes(file.TestCase.Volumes); convertErr != nil {
+		err = multierr.Append(err, errors.Wrap(convertErr, "test case volumes"))
+	}
+
+	project := envFileScope{dir: dir, hooks: hooks}
+	for _, name := range containerNames(file.Containers) {
+		container, convertErr := project.container(file.Containers[name])
+		if convertErr != nil {
+			err = multierr.Append(err, errors.Wrapf(convertErr, "container %s", name))
+			continue
+		}
+		desc.Containers[name] = container
+	}
+
+	testCase := envFileScope{
+		dir:              dir,
+		hooks:            hooks,
+		testCase:         true,
+		testCaseNetworks: file.TestCase.Networks,
+		testCaseVolumes:  file.TestCase.Volumes,
+	}
+	for _, name := range containerNames(file.TestCase.Containers) {
+		container, convertErr := testCase.container(file.TestCase.Containers[name])
+		if convertErr != nil {
+			err = multierr.Append(err, errors.Wrapf(convertErr, "test case container %s", name))
+			continue
+		}
+		desc.TestCaseEnv.Containers[name] = &container
+	}
+
+	beforeRun, hookErr := hooks.hook(file.TestCase.Hooks.BeforeRun)
+	err = multierr.Append(err, hookErr)
+	afterRun, hookErr := hooks.hook(file.TestCase.Hooks.AfterRun)
+	err = multierr.Append(err, hookErr)
+	desc.TestCaseEnv.Hooks = TestCaseHooks{BeforeRun: beforeRun, AfterRun: afterRun}
+
+	if err != nil {
+		return ProjectEnvDesc{}, err
+	}
+	return desc, nil
+}
+
+func (s envFileScope) container(c envFileContainer) (ContainerDesc, error) {
+	desc := ContainerDesc{
+		Cmd:         c.Cmd,
+		CaptureLogs: c.CaptureLogs,
+		DependsOn:   append([]string(nil), c.DependsOn...),
+	}
+	var dependencies []string
+	value := func(raw string) (StringValueResolver, error) {
+		resolver, containers, err := interpolate(raw)
+		dependencies = append(dependencies, containers...)
+		return resolver, err
+	}
+	values := func(raw map[string]string) (StringsMap, error) {
+		result, containers, err := interpolateStrings(raw)
+		dependencies = append(dependencies, containers...)
+		return result, err
+	}
+
+	var err error
+	switch {
+	case c.Image != "" && c.Build != nil:
+		return ContainerDesc{}, errors.New("image and build are mutually exclusive")
+	case c.Image != "":
+		image, err := value(c.Image)
+		if err != nil {
+			return ContainerDesc{}, errors.Wrap(err, "invalid image")
+		}
+		desc.Image = ImageResolver(image)
+	case c.Build != nil:
+		imageDesc := ImageDesc{
+			Dockerfile:        c.Build.Dockerfile,
+			DockerfileContent: c.Build.DockerfileInline,
+			ContextDir:        s.path(c.Build.Context),
+			Target:            c.Build.Target,
+			Platform:          c.Build.Platform,
+			NoCache:           c.Build.NoCache,
+			Pull:              c.Build.Pull,
+		}
+		if c.Build.Keep {
+			imageDesc.Retention = ImageRetentionKeep
+		}
+		if imageDesc.Labels, err = values(c.Build.Labels); err != nil {
+			return ContainerDesc{}, errors.Wrap(err, "invalid build labels")
+		}
+		if imageDesc.BuildArgs, err = values(c.Build.Args); err != nil {
+			return ContainerDesc{}, errors.Wrap(err, "invalid build args")
+		}
+		desc.Image = BuildImage(imageDesc)
+	default:
+		return ContainerDesc{}, errors.New("either image or build must be set")
+	}
+
+	if c.PullPolicy != "" {
+		if desc.PullPolicy, err = parsePullPolicy(c.PullPolicy); err != nil {
+			return ContainerDesc{}, err
+		}
+	}
+
+	if desc.Envs, err = values(c.Env); err != nil {
+		return ContainerDesc{}, errors.Wrap(err, "invalid env")
+	}
+	if desc.Labels, err = values(c.Labels); err != nil {
+		return ContainerDesc{}, errors.Wrap(err, "invalid labels")
+	}
+
+	for _, port := range c.Ports {
+		resolver, err := value(port)
+		if err != nil {
+			return ContainerDesc{}, errors.Wrap(err, "invalid port")
+		}
+		desc.ExposedPorts = append(desc.ExposedPorts, resolver)
+	}
+
+	for i, binding := range c.PortBindings {
+		var portBinding PortBinding
+		if portBinding.ContainerPort, err = value(binding.ContainerPort); err != nil {
+			return ContainerDesc{}, errors.Wrapf(err, "invalid port binding #%d", i)
+		}
+		if portBinding.Host, err = value(binding.Host); err != nil {
+			return ContainerDesc{}, errors.Wrapf(err, "invalid port binding #%d", i)
+		}
+		if portBinding.Port, err = value(binding.Port); err != nil {
+			return ContainerDesc{}, errors.Wrapf(err, "invalid port binding #%d", i)
+		}
+		desc.PortBindings = append(desc.PortBindings, portBinding)
+	}
+
+	for _, network := range c.Networks {
+		desc.Networks = append(desc.Networks, ContainerNetwork{
+			Network: s.network(network.Network),
+			Alias:   network.Alias,
+		})
+	}
+
+	for i, mount := range c.Mounts {
+		m := Mount{
+			Type:      docker.MountType(mount.Type),
+			Target:    mount.Target,
+			ReadOnly:  mount.ReadOnly,
+			TmpfsSize: mount.Size,
+			TmpfsMode: os.FileMode(mount.Mode),
+		}
+		switch m.Type {
+		case docker.MountTypeBind:
+			source, err := value(mount.Source)
+			if err != nil {
+				return ContainerDesc{}, errors.Wrapf(err, "invalid mount #%d", i)
+			}
+			m.Source = s.pathValue(source)
+		case docker.MountTypeVolume:
+			m.Volume = s.volume(mount.Source)
+		case docker.MountTypeTmpfs:
+		default:
+			return ContainerDesc{}, errors.Errorf("unknown type %q of mount #%d", mount.Type, i)
+		}
+		desc.Mounts = append(desc.Mounts, m)
+	}
+
+	for _, file := range c.Files {
+		containerFile := ContainerFile{
+			Path: file.Path,
+			Mode: os.FileMode(file.Mode),
+		}
+		if file.HostFile != "" {
+			containerFile.Content = HostFile(s.path(file.HostFile))
+		} else {
+			content, err := value(file.Content)
+			if err != nil {
+				return ContainerDesc{}, errors.Wrapf(err, "invalid content of file %s", file.Path)
+			}
+			containerFile.Content = FileString(content)
+		}
+		desc.Files = append(desc.Files, containerFile)
+	}
+
+	if c.Wait != nil {
+		if desc.WaitStrategy, err = c.Wait.strategy(); err != nil {
+			return ContainerDesc{}, errors.Wrap(err, "invalid wait strategy")
+		}
+	}
+	if c.WaitTimeout != "" {
+		if desc.HealthCheckOptions.Timeout, err = time.ParseDuration(c.WaitTimeout); err != nil {
+			return ContainerDesc{}, errors.Wrap(err, "invalid wait timeout")
+		}
+	}
+
+	if len(c.DependsOnConditions) != 0 {
+		desc.DependsOnConditions = make(map[string]DependencyCondition, len(c.DependsOnConditions))
+		for name, rawCondition := range c.DependsOnConditions {
+			condition, err := parseDependencyCondition(rawCondition)
+			if err != nil {
+				return ContainerDesc{}, err
+			}
+			desc.DependsOnConditions[name] = condition
+		}
+	}
+	for _, dependency := range dependencies {
+		if !containsString(desc.DependsOn, dependency) {
+			desc.DependsOn = append(desc.DependsOn, dependency)
+		}
+	}
+
+	if desc.Hooks.BeforeRun, err = s.hooks.hook(c.Hooks.BeforeRun); err != nil {
+		return ContainerDesc{}, err
+	}
+	if desc.Hooks.AfterRun, err = s.hooks.hook(c.Hooks.AfterRun); err != nil {
+		return ContainerDesc{}, err
+	}
+
+	return desc, nil
+}
+
+func (s envFileScope) network(name string) NetworkResolver {
+	if _, ok := s.testCaseNetworks[name]; ok && s.testCase {
+		return TestCaseNetwork(name)
+	}
+	return ProjectNetwork(name)
+}
+
+func (s envFileScope) volume(name string) VolumeResolver {
+	if _, ok := s.testCaseVolumes[name]; ok && s.testCase {
+		return TestCaseVolume(name)
+	}
+	return ProjectVolume(name)
+}
+
+func (s envFileScope) path(path string) string {
+	if path == "" || filepath.IsAbs(path) || s.dir == "" {
+		return path
+	}
+	return filepath.Join(s.dir, path)
+}
+
+func (s envFileScope) pathValue(value StringValueResolver) StringValueResolver {
+	return func(ctx context.Context, project *ProjectEnv, caseEnv *TestCaseEnv) (string, error) {
+		path, err := value(ctx, project, caseEnv)
+		if err != nil {
+			return "", err
+		}
+		return s.path(path), nil
+	}
+}
+
+func (w envFileWait) strategy() (WaitStrategy, error) {
+	var strategies []WaitStrategy
+	if w.Log != "" {
+		pattern, err := regexp.Compile(w.Log)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid wait.log pattern %q", w.Log)
+		}
+		strategies = append(strategies, &LogWaitStrategy{Pattern: pattern, Occurrences: 1})
+	}
+	if w.Port != "" {
+		strategies = append(strategies, WaitForPort(w.Port))
+	}
+	if w.HTTP != nil {
+		strategy := WaitForHTTP(w.HTTP.Port, w.HTTP.Path)
+		if w.HTTP.StatusCode != 0 {
+			strategy.StatusCode = w.HTTP.StatusCode
+		}
+		strategies = append(strategies, strategy)
+	}
+	if len(w.Exec) != 0 {
+		strategies = append(strategies, WaitForExec(w.Exec...))
+	}
+	for _, nested := range w.All {
+		strategy, err := nested.strategy()
+		if err != nil {
+			return nil, err
+		}
+		strategies = append(strategies, strategy)
+	}
+	if len(w.Any) != 0 {
+		var anyOf []WaitStrategy
+		for _, nested := range w.Any {
+			strategy, err := nested.strategy()
+			if err != nil {
+				return nil, err
+			}
+			anyOf = append(anyOf, strategy)
+		}
+		strategies = append(strategies, WaitForAny(anyOf...))
+	}
+
+	switch len(strategies) {
+	case 0:
+		return nil, errors.New("wait strategy is empty")
+	case 1:
+		return strategies[0], nil
+	}
+	return WaitForAll(strategies...), nil
+}
+
+func parseDependencyCondition(value string) (DependencyCondition, error) {
+	for _, condition := range []DependencyCondition{DependencyStarted, DependencyHealthy, DependencyCompletedSuccessfully} {
+		if condition.String() == value {
+			return condition, nil
+		}
+	}
+	return 0, errors.Errorf("unknown dependency condition %q", value)
+}
+
+func parsePullPolicy(value string) (PullPolicy, error) {
+	for _, policy := range []PullPolicy{PullIfNotPresent, PullAlways, PullNever} {
+		if policy.String() == value {
+			return policy, nil
+		}
+	}
+	return 0, errors.Errorf("unknown pull policy %q", value)
+}
+
+func convertEnvFileNetworks(networks map[string]envFileNetwork) (map[string]NetworkDesc, error) {
+	if networks == nil {
+		return nil, nil
+	}
+	result := make(map[string]NetworkDesc, len(networks))
+	for name, network := range networks {
+		labels, _, err := interpolateStrings(network.Labels)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid labels of network %s", name)
+		}
+		result[name] = NetworkDesc{Labels: labels}
+	}
+	return result, nil
+}
+
+func convertEnvFileVolumes(volumes map[string]envFileVolume) (map[string]VolumeDesc, error) {
+	if volumes == nil {
+		return nil, nil
+	}
+	result := make(map[string]VolumeDesc, len(volumes))
+	for name, volume := range volumes {
+		labels, _, err := interpolateStrings(volume.Labels)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid labels of volume %s", name)
+		}
+		result[name] = VolumeDesc{
+			Driver:  volume.Driver,
+			Options: volume.Options,
+			Labels:  labels,
+		}
+	}
+	return result, nil
+}
+
+func interpolateStrings(values map[string]string) (StringsMap, []string, error) {
+	if values == nil {
+		return nil, nil, nil
+	}
+
+	var containers []string
+	result := make(StringsMap, len(values))
+	for key, value := range values {
+		resolver, referenced, err := interpolate(value)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid value of %s", key)
+		}
+		result[key] = resolver
+		containers = append(containers, referenced...)
+	}
+	return result, containers, nil
+}
+
+func containerNames(containers map[string]envFileContainer) []string {
+	names := make([]string, 0, len(containers))
+	for name := range containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
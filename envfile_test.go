@@ -0,0 +1,105 @@
+package testenv_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/saturn4er/go-testenv"
+	"github.com/saturn4er/go-testenv/docker"
+	"github.com/saturn4er/go-testenv/fake"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadProjectEnvDesc(t *testing.T) {
+	require.NoError(t, os.Setenv("TESTENV_HOST", "10.0.0.1"))
+	defer os.Unsetenv("TESTENV_HOST")
+
+	var called []string
+	hooks := testenv.NewHookRegistry()
+	for _, name := range []string{"createTopics", "seed"} {
+		name := name
+		hooks.Register(name, func(ctx context.Context, project *testenv.ProjectEnv, testCase *testenv.TestCaseEnv) error {
+			called = append(called, name)
+			return nil
+		})
+	}
+
+	desc, err := testenv.LoadProjectEnvDesc("testdata/env.yaml", hooks)
+	require.NoError(t, err)
+	require.Equal(t, 2, desc.MaxParallelism)
+	require.Equal(t, []string{"zookeeper"}, desc.Containers["kafka"].DependsOn)
+	require.Equal(t, []string{"zookeeper"}, desc.TestCaseEnv.Containers["postgres"].DependsOn)
+
+	backend := fake.NewBackend()
+	projectEnv := testenv.NewProjectEnvWithBackendT(t, desc, backend)
+	testCaseEnv := projectEnv.NewTestCaseEnvT(t)
+	require.Equal(t, []string{"createTopics", "seed"}, called)
+
+	zookeeperPort := projectEnv.MustContainer("zookeeper").MustHostPort("2181", testenv.PortTypeTCP)
+	kafka, ok := backend.ContainerParams(projectEnv.MustContainer("kafka").ID())
+	require.True(t, ok)
+	require.Equal(t, map[string]string{
+		"KAFKA_ZOOKEEPER_CONNECT":    "zookeeper:2181",
+		"KAFKA_ADVERTISED_LISTENERS": "OUTSIDE://10.0.0.1:" + zookeeperPort,
+		"KAFKA_PRICE":                "$5",
+	}, kafka.Envs)
+
+	initDir, err := filepath.Abs("testdata/init")
+	require.NoError(t, err)
+	require.Equal(t, []docker.Mount{
+		{Type: docker.MountTypeBind, Source: initDir, Target: "/init", ReadOnly: true},
+		{Type: docker.MountTypeVolume, Source: backend.Volumes()[0].Name, Target: "/data"},
+		{Type: docker.MountTypeTmpfs, Target: "/tmp", TmpfsSize: 1 << 20},
+	}, kafka.Mounts)
+
+	postgres, ok := testCaseEnv.Container("postgres")
+	require.True(t, ok)
+	postgresParams, ok := backend.ContainerParams(postgres.ID())
+	require.True(t, ok)
+	require.Len(t, postgresParams.Networks, 1)
+	for networkID := range postgresParams.Networks {
+		require.NotEqual(t, backend.Networks()[0].ID, networkID, "test case network must shadow the project one")
+	}
+	file, ok := backend.ContainerFile(postgres.ID(), "/docker-entrypoint-initdb.d/init.sql")
+	require.True(t, ok)
+	require.Equal(t, "-- kafka at "+zookeeperPort, string(file.Content))
+	require.Equal(t, os.FileMode(0600), file.Mode)
+}
+
+func TestParseProjectEnvDescErrors(t *testing.T) {
+	_, err := testenv.ParseProjectEnvDesc([]byte(`
+containers:
+  kafka:
+    image: kafka
+    imagee: kafka
+`), nil)
+	require.Error(t, err)
+
+	_, err = testenv.ParseProjectEnvDesc([]byte(`
+containers:
+  kafka:
+    image: kafka
+    env:
+      HOST: "${unknown:x}"
+    hooks:
+      afterRun: missing
+  zookeeper: {}
+`), nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unknown placeholder ${unknown:x}")
+	require.Contains(t, err.Error(), "either image or build must be set")
+
+	_, err = testenv.ParseProjectEnvDesc([]byte(`
+containers:
+  kafka:
+    image: kafka
+    wait:
+      any:
+        - port: "9092"
+        - log: "(unclosed"
+`), nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `invalid wait.log pattern "(unclosed"`)
+}
@@ -0,0 +1,162 @@
+package testenv
+
+import (
+	"time"
+)
+
+type EventType string
+
+const (
+	EventImagePullStarted   EventType = "image pull started"
+	EventImagePullProgress  EventType = "image pull progress"
+	EventImagePullFinished  EventType = "image pull finished"
+	EventImageBuildStarted  EventType = "image build started"
+	EventImageBuildFinished EventType = "image build finished"
+	EventImageResolved      EventType = "image resolved"
+	EventNetworkCreated     EventType = "network created"
+	EventNetworkRemoved     EventType = "network removed"
+	EventVolumeCreated      EventType = "volume created"
+	EventVolumeRemoved      EventType = "volume removed"
+	// EventContainerCreated is emitted once the backend has created the
+	// container, before it's started.
+	EventContainerCreated EventType = "container created"
+	// EventContainerStarted is emitted once the backend has started the
+	// container, or failed to create or start it.
+	EventContainerStarted EventType = "container started"
+	// EventContainerHealthy is emitted once the container has passed its
+	// health check and wait strategy.
+	EventContainerHealthy EventType = "container healthy"
+	EventContainerExited  EventType = "container exited"
+	EventContainerRemoved EventType = "container removed"
+	EventHookFinished     EventType = "hook finished"
+	EventCleanupStarted   EventType = "cleanup started"
+	EventCleanupFinished  EventType = "cleanup finished"
+)
+
+// eventFailures are log messages of events carrying an error.
+var eventFailures = map[EventType]string{
+	EventImagePullFinished:  "image pull failed",
+	EventImageBuildFinished: "image build failed",
+	EventImageResolved:      "image resolution failed",
+	EventNetworkCreated:     "network creation failed",
+	EventNetworkRemoved:     "network removal failed",
+	EventVolumeCreated:      "volume creation failed",
+	EventVolumeRemoved:      "volume removal failed",
+	EventContainerCreated:   "container creation failed",
+	EventContainerStarted:   "container start failed",
+	EventContainerHealthy:   "container health check failed",
+	EventContainerExited:    "container wait failed",
+	EventContainerRemoved:   "container removal failed",
+	EventHookFinished:       "hook failed",
+	EventCleanupFinished:    "cleanup failed",
+}
+
+type Scope string
+
+const (
+	ScopeProject  Scope = "project"
+	ScopeTestCase Scope = "test case"
+)
+
+// Event describes a step of environment lifecycle. Events finishing an
+// operation carry its Duration and, if it failed, Err. Name is the name of
+// network, volume or container in environment description, ID is the
+// identifier assigned by the backend. For EventImagePullProgress ID is the
+// layer, Status its state and Current and Total the downloaded and total
+// bytes.
+type Event struct {
+	Type     EventType
+	Scope    Scope
+	TestCase string
+	Name     string
+	ID       string
+	Image    string
+	Hook     string
+	ExitCode int
+	Status   string
+	Current  int64
+	Total    int64
+	Time     time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// Observer is called synchronously for every event of ProjectEnv and its
+// test cases. It may be called concurrently and must not block.
+type Observer func(event Event)
+
+// message returns the log message of the event.
+func (e Event) message() string {
+	if e.Err == nil {
+		return string(e.Type)
+	}
+	if message, ok := eventFailures[e.Type]; ok {
+		return message
+	}
+	return string(e.Type) + " failed"
+}
+
+func (e Event) fields() []interface{} {
+	fields := []interface{}{"scope", e.Scope}
+	if e.TestCase != "" {
+		fields = append(fields, "testCase", e.TestCase)
+	}
+	if e.Name != "" {
+		fields = append(fields, "name", e.Name)
+	}
+	if e.ID != "" {
+		fields = append(fields, "id", e.ID)
+	}
+	if e.Image != "" {
+		fields = append(fields, "image", e.Image)
+	}
+	if e.Hook != "" {
+		fields = append(fields, "hook", e.Hook)
+	}
+	if e.Status != "" {
+		fields = append(fields, "status", e.Status)
+	}
+	if e.Total != 0 {
+		fields = append(fields, "current", e.Current, "total", e.Total)
+	}
+	if e.Type == EventContainerExited {
+		fields = append(fields, "exitCode", e.ExitCode)
+	}
+	if e.Duration != 0 {
+		fields = append(fields, "duration", e.Duration)
+	}
+	if e.Err != nil {
+		fields = append(fields, "error", e.Err)
+	}
+	return fields
+}
+
+// emit logs event and passes it to observers of the project.
+func emit(project *ProjectEnv, testCase *TestCaseEnv, event Event) {
+	logger, report := project.logger, project.report
+	event.Scope = ScopeProject
+	if testCase != nil {
+		logger, report = testCase.logger, testCase.report
+		event.Scope = ScopeTestCase
+		event.TestCase = testCase.id
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	switch {
+	case event.Err != nil:
+		logger.Error(event.message(), event.fields()...)
+	case event.Type == EventImagePullStarted || event.Type == EventImagePullProgress || event.Type == EventImageBuildStarted,
+		event.Type == EventContainerCreated || event.Type == EventCleanupStarted,
+		event.Type == EventImageResolved || event.Type == EventHookFinished:
+		logger.Debug(string(event.Type), event.fields()...)
+	default:
+		logger.Info(string(event.Type), event.fields()...)
+	}
+
+	report.add(event)
+	for _, observer := range project.desc.Observers {
+		observer(event)
+	}
+}
@@ -0,0 +1,149 @@
+package testenv_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/saturn4er/go-testenv"
+	"github.com/saturn4er/go-testenv/docker"
+	"github.com/saturn4er/go-testenv/fake"
+	"github.com/stretchr/testify/require"
+)
+
+type eventRecorder struct {
+	mx     sync.Mutex
+	events []testenv.Event
+}
+
+func (r *eventRecorder) observe(event testenv.Event) {
+	r.mx.Lock()
+	r.events = append(r.events, event)
+	r.mx.Unlock()
+}
+
+func (r *eventRecorder) find(eventType testenv.EventType, name string) []testenv.Event {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	var result []testenv.Event
+	for _, event := range r.events {
+		if event.Type == eventType && event.Name == name {
+			result = append(result, event)
+		}
+	}
+	return result
+}
+
+func (r *eventRecorder) index(eventType testenv.EventType, name string) int {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	for i, event := range r.events {
+		if event.Type == eventType && event.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestProjectEnvEvents(t *testing.T) {
+	backend := fake.NewBackend()
+	recorder := &eventRecorder{}
+
+	var logs []string
+	var logsMx sync.Mutex
+	logger := testenv.PrintfLogger(func(format string, args ...interface{}) {
+		logsMx.Lock()
+		logs = append(logs, fmt.Sprintf(format, args...))
+		logsMx.Unlock()
+	})
+
+	projectEnv := testenv.NewProjectEnvWithBackend(testenv.ProjectEnvDesc{
+		Networks: map[string]testenv.NetworkDesc{
+			"public": {},
+		},
+		Containers: map[string]testenv.ContainerDesc{
+			"postgres": {
+				Image: testenv.ExternalImage("postgres"),
+			},
+		},
+		TestCaseEnv: testenv.TestCaseEnvDesc{
+			Networks: map[string]testenv.NetworkDesc{
+				"private": {},
+			},
+		},
+		Logger:    logger,
+		Observers: []testenv.Observer{recorder.observe},
+	}, backend)
+	require.NoError(t, projectEnv.Run())
+
+	pulls := recorder.find(testenv.EventImagePullFinished, "postgres")
+	require.Len(t, pulls, 1)
+	require.Equal(t, "postgres", pulls[0].Image)
+	require.NoError(t, pulls[0].Err)
+
+	postgres := projectEnv.MustContainer("postgres")
+	created := recorder.find(testenv.EventContainerCreated, "postgres")
+	require.Len(t, created, 1)
+	require.Equal(t, postgres.ID(), created[0].ID)
+	started := recorder.find(testenv.EventContainerStarted, "postgres")
+	require.Len(t, started, 1)
+	require.Equal(t, postgres.ID(), started[0].ID)
+	require.Equal(t, testenv.ScopeProject, started[0].Scope)
+	require.Less(t, recorder.index(testenv.EventContainerCreated, "postgres"), recorder.index(testenv.EventContainerStarted, "postgres"))
+	require.Len(t, recorder.find(testenv.EventContainerHealthy, "postgres"), 1)
+
+	testCaseEnv := projectEnv.NewTestCaseEnv()
+	require.NoError(t, testCaseEnv.Run())
+	networks := recorder.find(testenv.EventNetworkCreated, "private")
+	require.Len(t, networks, 1)
+	require.Equal(t, testenv.ScopeTestCase, networks[0].Scope)
+	require.NotEmpty(t, networks[0].TestCase)
+
+	require.NoError(t, testCaseEnv.Close())
+	require.Len(t, recorder.find(testenv.EventNetworkRemoved, "private"), 1)
+
+	require.NoError(t, projectEnv.Close())
+	removed := recorder.find(testenv.EventContainerRemoved, "postgres")
+	require.Len(t, removed, 1)
+	require.Equal(t, postgres.ID(), removed[0].ID)
+	require.Len(t, recorder.find(testenv.EventCleanupFinished, ""), 2)
+
+	logsMx.Lock()
+	defer logsMx.Unlock()
+	require.Contains(t, strings.Join(logs, "\n"), "INFO network created scope=test case testCase=")
+}
+
+func TestProjectEnvLogsFailedEvents(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.PullImageHook = func(params docker.PullImageParams) error {
+		return errors.New("registry is unavailable")
+	}
+
+	var logs []string
+	var logsMx sync.Mutex
+	logger := testenv.PrintfLogger(func(format string, args ...interface{}) {
+		logsMx.Lock()
+		logs = append(logs, fmt.Sprintf(format, args...))
+		logsMx.Unlock()
+	})
+
+	projectEnv := testenv.NewProjectEnvWithBackend(testenv.ProjectEnvDesc{
+		Containers: map[string]testenv.ContainerDesc{
+			"postgres": {
+				Image: testenv.ExternalImage("postgres"),
+			},
+		},
+		Logger: logger,
+	}, backend)
+	require.Error(t, projectEnv.Run())
+	require.NoError(t, projectEnv.Close())
+
+	logsMx.Lock()
+	defer logsMx.Unlock()
+	require.Contains(t, strings.Join(logs, "\n"), "ERROR image pull failed scope=project")
+	require.NotContains(t, strings.Join(logs, "\n"), "ERROR image pull finished")
+}
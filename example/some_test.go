@@ -1,14 +1,13 @@
 package example
 
 import (
+	"context"
 	"fmt"
 	"testing"
-	"time"
 
 	"github.com/pkg/errors"
 	uuid "github.com/satori/go.uuid"
 	"github.com/saturn4er/go-testenv"
-	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -35,8 +34,8 @@ var testEnv = testenv.ProjectEnvDesc{
 	Containers: map[string]testenv.ContainerDesc{
 		"kafka": {
 			Hooks: testenv.ContainerHooks{
-				BeforeRun: func(project *testenv.ProjectEnv, testCase *testenv.TestCaseEnv) error {
-					kafkaHostPort, err := project.FindFreeHostPort()
+				BeforeRun: func(ctx context.Context, project *testenv.ProjectEnv, testCase *testenv.TestCaseEnv) error {
+					kafkaHostPort, err := project.FindFreeHostPort(ctx)
 					if err != nil {
 						return errors.WithStack(err)
 					}
@@ -46,6 +45,11 @@ var testEnv = testenv.ProjectEnvDesc{
 				},
 			},
 			Image:        testenv.ExternalImage(kafkaImage),
+			WaitStrategy: testenv.WaitForLog(`started \(kafka.server.KafkaServer\)`),
+			DependsOn:    []string{"zookeeper"},
+			DependsOnConditions: map[string]testenv.DependencyCondition{
+				"zookeeper": testenv.DependencyHealthy,
+			},
 			ExposedPorts: []testenv.StringValueResolver{testenv.ProjectVariableValue("kafka_host_port")},
 			Labels: map[string]testenv.StringValueResolver{
 				testEnvLabel: testenv.StringValue(testEnvID),
@@ -60,11 +64,11 @@ var testEnv = testenv.ProjectEnvDesc{
 			Envs: map[string]testenv.StringValueResolver{
 				"KAFKA_BROKER_ID":                      testenv.StringValue("1"),
 				"KAFKA_LISTENER_SECURITY_PROTOCOL_MAP": testenv.StringValue("INSIDE:PLAINTEXT,OUTSIDE:PLAINTEXT"),
-				"KAFKA_LISTENERS": func(project *testenv.ProjectEnv, caseEnv *testenv.TestCaseEnv) (s string, e error) {
+				"KAFKA_LISTENERS": func(ctx context.Context, project *testenv.ProjectEnv, caseEnv *testenv.TestCaseEnv) (s string, e error) {
 					kafkaHostPort := project.Get("kafka_host_port").(string)
 					return "INSIDE://:9092,OUTSIDE://:" + kafkaHostPort, nil
 				},
-				"KAFKA_ADVERTISED_LISTENERS": func(project *testenv.ProjectEnv, caseEnv *testenv.TestCaseEnv) (s string, e error) {
+				"KAFKA_ADVERTISED_LISTENERS": func(ctx context.Context, project *testenv.ProjectEnv, caseEnv *testenv.TestCaseEnv) (s string, e error) {
 					kafkaHostPort := project.Get("kafka_host_port").(string)
 					return fmt.Sprintf("INSIDE://:9092,OUTSIDE://%s:%s", hostIP, kafkaHostPort), nil
 				},
@@ -80,7 +84,8 @@ var testEnv = testenv.ProjectEnvDesc{
 			},
 		},
 		"zookeeper": {
-			Image: testenv.ExternalImage(zookeeperImage),
+			Image:        testenv.ExternalImage(zookeeperImage),
+			WaitStrategy: testenv.WaitForLog("binding to port"),
 			Labels: map[string]testenv.StringValueResolver{
 				testEnvLabel: testenv.StringValue(testEnvID),
 			},
@@ -104,6 +109,7 @@ var testEnv = testenv.ProjectEnvDesc{
 			"postgres": {
 				Image:        testenv.ExternalImage("postgres:latest"),
 				ExposedPorts: []testenv.StringValueResolver{testenv.StringValue("5432")},
+				WaitStrategy: testenv.WaitForExec("pg_isready", "-U", "postgres"),
 				Networks: []testenv.ContainerNetwork{
 					{
 						Network: testenv.TestCaseNetwork(testCaseNetworkName),
@@ -134,22 +140,6 @@ var testEnv = testenv.ProjectEnvDesc{
 }
 
 func TestEnv(t *testing.T) {
-	projectEnv, err := testenv.NewProjectEnv(testEnv)
-	require.NoError(t, err)
-	defer func() {
-		require.NoError(t, projectEnv.Close())
-	}()
-
-	err = projectEnv.Run()
-	require.NoError(t, err)
-
-	tcEnv := projectEnv.NewTestCaseEnv()
-	defer func() {
-		require.NoError(t, tcEnv.Close())
-	}()
-
-	err = tcEnv.Run()
-	require.NoError(t, err)
-
-	time.Sleep(time.Second * 20)
+	projectEnv := testenv.NewProjectEnvT(t, testEnv)
+	projectEnv.NewTestCaseEnvT(t)
 }
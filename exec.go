@@ -0,0 +1,65 @@
+package testenv
+
+import (
+	"context"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/saturn4er/go-testenv/docker"
+)
+
+// ExecOptions configures a command executed with Container.Exec. Empty User
+// and WorkingDir mean defaults of the container image.
+type ExecOptions struct {
+	Stdin io.Reader
+	Env   map[string]string
+	User  string
+	// WorkingDir is entered with sh before the command runs, as the exec
+	// API doesn't support it, so the container must have sh in $PATH.
+	WorkingDir string
+}
+
+type ExecResult struct {
+	ExitCode int
+	Stdout   string
+	Stderr   string
+}
+
+// Exec runs cmd inside the container and waits until it exits. Non-zero exit
+// code of the command is not an error, check ExecResult.ExitCode.
+func (c *Container) Exec(ctx context.Context, cmd []string, opts ExecOptions) (*ExecResult, error) {
+	if len(cmd) == 0 {
+		return nil, errors.New("command is empty")
+	}
+
+	result, err := c.client.Exec(ctx, c.ID(), docker.ExecParams{
+		Cmd:        cmd,
+		Stdin:      opts.Stdin,
+		Env:        opts.env(),
+		User:       opts.User,
+		WorkingDir: opts.WorkingDir,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to exec %q in container %s", cmd, c.ID())
+	}
+
+	return &ExecResult{
+		ExitCode: result.ExitCode,
+		Stdout:   result.Stdout,
+		Stderr:   result.Stderr,
+	}, nil
+}
+
+func (e ExecOptions) env() []string {
+	if len(e.Env) == 0 {
+		return nil
+	}
+
+	env := make([]string, 0, len(e.Env))
+	for name, value := range e.Env {
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
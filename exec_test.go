@@ -0,0 +1,49 @@
+package testenv_test
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/saturn4er/go-testenv"
+	"github.com/saturn4er/go-testenv/docker"
+	"github.com/saturn4er/go-testenv/fake"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContainerExec(t *testing.T) {
+	backend := fake.NewBackend()
+
+	var executed docker.ExecParams
+	backend.ExecHandler = func(container *docker.Container, params docker.ExecParams) (*docker.ExecResult, error) {
+		executed = params
+		stdin, err := ioutil.ReadAll(params.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		return &docker.ExecResult{ExitCode: 1, Stdout: string(stdin), Stderr: "error"}, nil
+	}
+
+	projectEnv := testenv.NewProjectEnvWithBackendT(t, testenv.ProjectEnvDesc{
+		Containers: map[string]testenv.ContainerDesc{
+			"postgres": {
+				Image: testenv.ExternalImage("postgres"),
+			},
+		},
+	}, backend)
+
+	result, err := projectEnv.MustContainer("postgres").Exec(context.Background(), []string{"psql", "-f", "-"}, testenv.ExecOptions{
+		Stdin:      strings.NewReader("SELECT 1"),
+		Env:        map[string]string{"PGUSER": "postgres", "PGDATABASE": "test"},
+		User:       "postgres",
+		WorkingDir: "/tmp",
+	})
+	require.NoError(t, err)
+	require.Equal(t, &testenv.ExecResult{ExitCode: 1, Stdout: "SELECT 1", Stderr: "error"}, result)
+
+	require.Equal(t, []string{"psql", "-f", "-"}, executed.Cmd)
+	require.Equal(t, []string{"PGDATABASE=test", "PGUSER=postgres"}, executed.Env)
+	require.Equal(t, "postgres", executed.User)
+	require.Equal(t, "/tmp", executed.WorkingDir)
+}
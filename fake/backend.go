@@ -0,0 +1,962 @@
+// Package fake provides an in-memory testenv.Backend that simulates
+// containers, networks, volumes, port mappings and labels without a Docker
+// daemon.
+package fake
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/saturn4er/go-testenv/docker"
+)
+
+const firstHostPort = 32768
+
+type ExecHandler func(container *docker.Container, params docker.ExecParams) (*docker.ExecResult, error)
+
+type logLine struct {
+	time   time.Time
+	stderr bool
+	text   string
+}
+
+type container struct {
+	info   docker.Container
+	params docker.RunContainerParams
+	logs   []logLine
+	files  map[string]docker.File
+	logged chan struct{}
+	exited chan struct{}
+}
+
+type Backend struct {
+	// RunContainerHook is called before a container is created. Returning an
+	// error from it simulates a failure of the engine.
+	RunContainerHook func(params docker.RunContainerParams) error
+	// BuildImageHook is called before an image is built. Returning an error
+	// from it simulates a failed build.
+	BuildImageHook func(params docker.BuildImageParams) error
+	// PullImageHook is called before an image is pulled. Returning an error
+	// from it simulates a failed pull.
+	PullImageHook func(params docker.PullImageParams) error
+	// Helpers are returned by HelperImages, e.g. to simulate the reaper.
+	Helpers []string
+	// ExecHandler handles commands executed in containers. By default every
+	// command succeeds with empty output.
+	ExecHandler ExecHandler
+
+	*store
+	session string
+}
+
+// store is the state of the simulated engine shared by sessions.
+type store struct {
+	mx            sync.Mutex
+	lastID        int
+	lastPort      int
+	lastSessionID int
+	containers    map[string]*container
+	networks      map[string]*docker.Network
+	volumes       map[string]*docker.Volume
+	images        map[string]struct{}
+	builds        int
+	pulls         int
+	owners        map[string]owner
+}
+
+// owner is the session which created a resource.
+type owner struct {
+	session string
+	created time.Time
+}
+
+func NewBackend() *Backend {
+	b := &Backend{
+		store: &store{
+			lastPort:   firstHostPort - 1,
+			containers: map[string]*container{},
+			networks:   map[string]*docker.Network{},
+			volumes:    map[string]*docker.Volume{},
+			images:     map[string]struct{}{},
+			owners:     map[string]owner{},
+		},
+	}
+	b.session = b.nextSessionID()
+	return b
+}
+
+// NewSession returns a backend sharing the engine with b, like another test
+// process connected to the same daemon. Cleanup of a session removes only
+// resources it created. Hooks are not shared.
+func (b *Backend) NewSession() *Backend {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	return &Backend{store: b.store, session: b.nextSessionID()}
+}
+
+// own marks resource created by the session, so it's removed by Cleanup and
+// Prune, unless it's persistent.
+func (b *Backend) own(id string, persistent bool) {
+	if !persistent {
+		b.owners[id] = owner{session: b.session, created: time.Now()}
+	}
+}
+
+func (b *Backend) CreateNetwork(ctx context.Context, params docker.CreateNetworkParams) (*docker.Network, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	network := &docker.Network{
+		ID:     b.nextID(),
+		Labels: copyStrings(params.Labels),
+	}
+	network.Name = "network-" + shortID(network.ID)
+	b.networks[network.ID] = network
+	b.own(network.ID, params.Persistent)
+
+	result := *network
+	return &result, nil
+}
+
+func (b *Backend) RemoveNetwork(ctx context.Context, id string) error {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if _, ok := b.networks[id]; !ok {
+		return errors.Errorf("no such network: %s", id)
+	}
+	for _, c := range b.containers {
+		if _, ok := c.params.Networks[id]; ok {
+			return errors.Errorf("network %s has active endpoints", id)
+		}
+	}
+
+	delete(b.networks, id)
+	delete(b.owners, id)
+	return nil
+}
+
+func (b *Backend) CreateVolume(ctx context.Context, params docker.CreateVolumeParams) (*docker.Volume, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	volume := &docker.Volume{
+		Name:   "volume-" + shortID(b.nextID()),
+		Labels: copyStrings(params.Labels),
+	}
+	b.volumes[volume.Name] = volume
+	b.own(volume.Name, params.Persistent)
+
+	result := *volume
+	return &result, nil
+}
+
+func (b *Backend) RemoveVolume(ctx context.Context, name string) error {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if _, ok := b.volumes[name]; !ok {
+		return errors.Errorf("no such volume: %s", name)
+	}
+	for _, c := range b.containers {
+		for _, mount := range c.params.Mounts {
+			if mount.Type == docker.MountTypeVolume && mount.Source == name {
+				return errors.Errorf("volume %s is in use", name)
+			}
+		}
+	}
+
+	delete(b.volumes, name)
+	delete(b.owners, name)
+	return nil
+}
+
+func (b *Backend) FindNetworks(ctx context.Context, labels map[string]string) ([]*docker.Network, error) {
+	var result []*docker.Network
+	for _, network := range b.Networks() {
+		if hasLabels(network.Labels, labels) {
+			result = append(result, network)
+		}
+	}
+	return result, nil
+}
+
+func (b *Backend) FindVolumes(ctx context.Context, labels map[string]string) ([]*docker.Volume, error) {
+	var result []*docker.Volume
+	for _, volume := range b.Volumes() {
+		if hasLabels(volume.Labels, labels) {
+			result = append(result, volume)
+		}
+	}
+	return result, nil
+}
+
+func (b *Backend) RunContainer(ctx context.Context, params docker.RunContainerParams) (*docker.Container, error) {
+	container, err := b.runContainer(ctx, params)
+	if err == nil && params.Created != nil {
+		params.Created(container.ID)
+	}
+	return container, err
+}
+
+func (b *Backend) runContainer(ctx context.Context, params docker.RunContainerParams) (*docker.Container, error) {
+	if b.RunContainerHook != nil {
+		if err := b.RunContainerHook(params); err != nil {
+			return nil, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	for networkID := range params.Networks {
+		if _, ok := b.networks[networkID]; !ok {
+			return nil, errors.Errorf("no such network: %s", networkID)
+		}
+	}
+	for _, mount := range params.Mounts {
+		if mount.Type == docker.MountTypeVolume {
+			if _, ok := b.volumes[mount.Source]; !ok {
+				return nil, errors.Errorf("no such volume: %s", mount.Source)
+			}
+		}
+	}
+	if _, ok := b.images[params.Image]; !ok && (params.Offline || docker.Offline()) {
+		return nil, errors.Errorf("image %s is not present and pulling is disabled in offline mode", params.Image)
+	}
+	b.addImage(params.Image)
+
+	c := &container{
+		info: docker.Container{
+			ID:     b.nextID(),
+			Name:   params.ContainerName,
+			Image:  params.Image,
+			Labels: copyStrings(params.Labels),
+			Ports:  map[string][]docker.PortBinding{},
+			State: docker.ContainerState{
+				Status:    "running",
+				Running:   true,
+				StartedAt: time.Now(),
+			},
+		},
+		params: params,
+		files:  map[string]docker.File{},
+		logged: make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+	if c.info.Name == "" {
+		c.info.Name = "container-" + shortID(c.info.ID)
+	}
+
+	for port, bindings := range params.PortBindings {
+		port = normalizePort(port)
+		for _, binding := range bindings {
+			if binding.Port == "" {
+				binding.Port = b.nextPort()
+			}
+			c.info.Ports[port] = append(c.info.Ports[port], binding)
+		}
+	}
+	for _, port := range params.ExposedPorts {
+		port = normalizePort(port)
+		if _, ok := c.info.Ports[port]; !ok {
+			c.info.Ports[port] = []docker.PortBinding{{Host: "0.0.0.0", Port: b.nextPort()}}
+		}
+	}
+
+	for _, file := range params.Files {
+		c.putFile(file)
+	}
+
+	b.containers[c.info.ID] = c
+	b.own(c.info.ID, params.Persistent)
+	return c.snapshot(), nil
+}
+
+func (b *Backend) InspectContainer(ctx context.Context, id string) (*docker.Container, error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	c, ok := b.containers[id]
+	if !ok {
+		return nil, errors.Errorf("no such container: %s", id)
+	}
+	return c.snapshot(), nil
+}
+
+func (b *Backend) FindContainers(ctx context.Context, labels map[string]string) ([]*docker.Container, error) {
+	var result []*docker.Container
+	for _, c := range b.Containers() {
+		if hasLabels(c.Labels, labels) {
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+func (b *Backend) WaitContainer(ctx context.Context, id string) (int, error) {
+	b.mx.Lock()
+	c, ok := b.containers[id]
+	b.mx.Unlock()
+	if !ok {
+		return 0, errors.Errorf("no such container: %s", id)
+	}
+
+	select {
+	case <-c.exited:
+	case <-ctx.Done():
+		return 0, errors.WithStack(ctx.Err())
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return c.info.State.ExitCode, nil
+}
+
+func (b *Backend) Logs(ctx context.Context, id string, params docker.LogsParams) error {
+	b.mx.Lock()
+	c, ok := b.containers[id]
+	if !ok {
+		b.mx.Unlock()
+		return errors.Errorf("no such container: %s", id)
+	}
+
+	var lines []logLine
+	for _, line := range c.logs {
+		if !line.time.Before(params.Since) && (line.stderr && params.Stderr != nil || !line.stderr && params.Stdout != nil) {
+			lines = append(lines, line)
+		}
+	}
+	if params.Tail > 0 && len(lines) > params.Tail {
+		lines = lines[len(lines)-params.Tail:]
+	}
+	written := len(c.logs)
+	b.mx.Unlock()
+
+	for {
+		for _, line := range lines {
+			text := line.text
+			if params.Timestamps {
+				text = line.time.Format(time.RFC3339Nano) + " " + text
+			}
+
+			w := params.Stdout
+			if line.stderr {
+				w = params.Stderr
+			}
+			if _, err := io.WriteString(w, text); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		if !params.Follow {
+			return nil
+		}
+
+		b.mx.Lock()
+		logged := c.logged
+		b.mx.Unlock()
+
+		select {
+		case <-logged:
+		case <-c.exited:
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		}
+
+		b.mx.Lock()
+		lines = nil
+		for _, line := range c.logs[written:] {
+			if line.stderr && params.Stderr != nil || !line.stderr && params.Stdout != nil {
+				lines = append(lines, line)
+			}
+		}
+		written = len(c.logs)
+		stopped := !c.info.State.Running
+		b.mx.Unlock()
+
+		if stopped && len(lines) == 0 {
+			return nil
+		}
+	}
+}
+
+func (b *Backend) Exec(ctx context.Context, id string, params docker.ExecParams) (*docker.ExecResult, error) {
+	c, err := b.InspectContainer(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !c.State.Running {
+		return nil, errors.Errorf("container %s is not running", id)
+	}
+
+	if b.ExecHandler == nil {
+		return &docker.ExecResult{}, nil
+	}
+	return b.ExecHandler(c, params)
+}
+
+func (b *Backend) CopyToContainer(ctx context.Context, id string, dir string, archive io.Reader) error {
+	var files []docker.File
+	reader := tar.NewReader(archive)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return errors.WithStack(err)
+		}
+
+		content, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		mode := os.FileMode(header.Mode).Perm()
+		if header.Typeflag == tar.TypeDir {
+			mode |= os.ModeDir
+		}
+		files = append(files, docker.File{
+			Path:    path.Join(dir, header.Name),
+			Content: content,
+			Mode:    mode,
+		})
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	c, ok := b.containers[id]
+	if !ok {
+		return errors.Errorf("no such container: %s", id)
+	}
+	for _, file := range files {
+		c.putFile(file)
+	}
+	return nil
+}
+
+func (b *Backend) CopyFromContainer(ctx context.Context, id string, filePath string, w io.Writer) error {
+	b.mx.Lock()
+	c, ok := b.containers[id]
+	if !ok {
+		b.mx.Unlock()
+		return errors.Errorf("no such container: %s", id)
+	}
+
+	filePath = path.Clean(filePath)
+	prefix := strings.TrimSuffix(filePath, "/") + "/"
+	var files []docker.File
+	for name, file := range c.files {
+		if name == filePath || strings.HasPrefix(name, prefix) {
+			file.Path = path.Join(path.Base(filePath), strings.TrimPrefix(name, filePath))
+			files = append(files, file)
+		}
+	}
+	b.mx.Unlock()
+
+	if len(files) == 0 {
+		return errors.Errorf("no such file or directory: %s", filePath)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	archive, err := docker.TarFiles(files)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(archive)
+	return errors.WithStack(err)
+}
+
+func (b *Backend) RemoveContainer(ctx context.Context, id string) error {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	c, ok := b.containers[id]
+	if !ok {
+		return errors.Errorf("no such container: %s", id)
+	}
+	c.stop(137)
+
+	delete(b.containers, id)
+	delete(b.owners, id)
+	return nil
+}
+
+func (b *Backend) ImageExists(ctx context.Context, image string) (bool, error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	_, ok := b.images[image]
+	return ok, nil
+}
+
+func (b *Backend) PullImage(ctx context.Context, params docker.PullImageParams) error {
+	if _, err := docker.ParseReference(params.Image); err != nil {
+		return err
+	}
+	if docker.Offline() {
+		return errors.Errorf("failed to pull image %s: pulling is disabled in offline mode", params.Image)
+	}
+	if b.PullImageHook != nil {
+		if err := b.PullImageHook(params); err != nil {
+			return err
+		}
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.addImage(params.Image)
+	b.pulls++
+	return nil
+}
+
+func (b *Backend) BuildImage(ctx context.Context, params docker.BuildImageParams) (string, error) {
+	if b.BuildImageHook != nil {
+		if err := b.BuildImageHook(params); err != nil {
+			return "", err
+		}
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	image := params.Name
+	if image == "" {
+		image = "image-" + shortID(b.nextID())
+	}
+	b.images[image] = struct{}{}
+	b.own(image, params.Persistent)
+	b.builds++
+
+	if params.Output != nil {
+		if _, err := fmt.Fprintf(params.Output, "Successfully tagged %s\n", image); err != nil {
+			return "", errors.WithStack(err)
+		}
+	}
+	return image, nil
+}
+
+func (b *Backend) RemoveImage(ctx context.Context, id string) error {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if _, ok := b.images[id]; !ok {
+		return errors.Errorf("no such image: %s", id)
+	}
+	delete(b.images, id)
+	delete(b.owners, id)
+	return nil
+}
+
+// UntagImage removes image unless a container uses it.
+func (b *Backend) UntagImage(ctx context.Context, image string) error {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	for _, c := range b.containers {
+		if c.info.Image == image {
+			return nil
+		}
+	}
+	delete(b.images, image)
+	delete(b.owners, image)
+	return nil
+}
+
+type imageManifest struct {
+	RepoTags []string
+}
+
+// SaveImages writes a tar archive with manifest.json in the format of docker
+// save, without image layers.
+func (b *Backend) SaveImages(ctx context.Context, images []string, w io.Writer) error {
+	b.mx.Lock()
+	for _, image := range images {
+		if _, ok := b.images[image]; !ok {
+			b.mx.Unlock()
+			return errors.Errorf("no such image: %s", image)
+		}
+	}
+	b.mx.Unlock()
+
+	manifest, err := json.Marshal([]imageManifest{{RepoTags: images}})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	writer := tar.NewWriter(w)
+	err = writer.WriteHeader(&tar.Header{
+		Name:     "manifest.json",
+		Mode:     0644,
+		Size:     int64(len(manifest)),
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := writer.Write(manifest); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(writer.Close())
+}
+
+// LoadImages adds images listed in manifest.json of the archive.
+func (b *Backend) LoadImages(ctx context.Context, r io.Reader) ([]string, error) {
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil, errors.New("manifest.json not found in archive")
+		} else if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if header.Name != "manifest.json" {
+			continue
+		}
+
+		var manifests []imageManifest
+		if err := json.NewDecoder(reader).Decode(&manifests); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		b.mx.Lock()
+		defer b.mx.Unlock()
+
+		var images []string
+		for _, manifest := range manifests {
+			for _, image := range manifest.RepoTags {
+				b.addImage(image)
+				images = append(images, image)
+			}
+		}
+		return images, nil
+	}
+}
+
+func (b *Backend) HelperImages() []string {
+	return b.Helpers
+}
+
+func (b *Backend) Host() string {
+	return "127.0.0.1"
+}
+
+func (b *Backend) Cleanup(ctx context.Context) error {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.removeOwned(func(owner owner) bool {
+		return owner.session == b.session
+	})
+	return nil
+}
+
+// Prune removes resources of other sessions created more than olderThan ago.
+func (b *Backend) Prune(ctx context.Context, olderThan time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	deadline := time.Now().Add(-olderThan)
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.removeOwned(func(owner owner) bool {
+		return owner.session != b.session && owner.created.Before(deadline)
+	})
+	return nil
+}
+
+func (b *Backend) removeOwned(match func(owner owner) bool) {
+	owned := func(id string) bool {
+		owner, ok := b.owners[id]
+		if ok && match(owner) {
+			delete(b.owners, id)
+			return true
+		}
+		return false
+	}
+
+	for id, c := range b.containers {
+		if owned(id) {
+			c.stop(137)
+			delete(b.containers, id)
+		}
+	}
+	for id := range b.networks {
+		if owned(id) {
+			delete(b.networks, id)
+		}
+	}
+	for name := range b.volumes {
+		if owned(name) {
+			delete(b.volumes, name)
+		}
+	}
+	for image := range b.images {
+		if owned(image) {
+			delete(b.images, image)
+		}
+	}
+}
+
+// WriteLogs appends output to the container stdout.
+func (b *Backend) WriteLogs(id string, output string) error {
+	return b.writeLogs(id, output, false)
+}
+
+// WriteErrorLogs appends output to the container stderr.
+func (b *Backend) WriteErrorLogs(id string, output string) error {
+	return b.writeLogs(id, output, true)
+}
+
+func (b *Backend) writeLogs(id string, output string, stderr bool) error {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	c, ok := b.containers[id]
+	if !ok {
+		return errors.Errorf("no such container: %s", id)
+	}
+
+	now := time.Now()
+	for _, text := range strings.SplitAfter(output, "\n") {
+		if text != "" {
+			c.logs = append(c.logs, logLine{time: now, stderr: stderr, text: text})
+		}
+	}
+	close(c.logged)
+	c.logged = make(chan struct{})
+	return nil
+}
+
+// StopContainer simulates exit of the container main process.
+func (b *Backend) StopContainer(id string, exitCode int) error {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	c, ok := b.containers[id]
+	if !ok {
+		return errors.Errorf("no such container: %s", id)
+	}
+	c.stop(exitCode)
+	return nil
+}
+
+// ContainerFile returns a file placed into the container.
+func (b *Backend) ContainerFile(id string, filePath string) (docker.File, bool) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	c, ok := b.containers[id]
+	if !ok {
+		return docker.File{}, false
+	}
+	file, ok := c.files[path.Clean(filePath)]
+	return file, ok
+}
+
+// Containers returns all existing containers sorted by creation order.
+func (b *Backend) Containers() []*docker.Container {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	result := make([]*docker.Container, 0, len(b.containers))
+	for _, c := range b.containers {
+		result = append(result, c.snapshot())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// ContainerParams returns parameters the container was created with.
+func (b *Backend) ContainerParams(id string) (docker.RunContainerParams, bool) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	c, ok := b.containers[id]
+	if !ok {
+		return docker.RunContainerParams{}, false
+	}
+	return c.params, true
+}
+
+// Networks returns all existing networks sorted by creation order.
+func (b *Backend) Networks() []*docker.Network {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	result := make([]*docker.Network, 0, len(b.networks))
+	for _, network := range b.networks {
+		n := *network
+		result = append(result, &n)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// Volumes returns all existing volumes sorted by creation order.
+func (b *Backend) Volumes() []*docker.Volume {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	result := make([]*docker.Volume, 0, len(b.volumes))
+	for _, volume := range b.volumes {
+		v := *volume
+		result = append(result, &v)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Builds returns the number of images built by the backend.
+func (b *Backend) Builds() int {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	return b.builds
+}
+
+// Pulls returns the number of images pulled by the backend.
+func (b *Backend) Pulls() int {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	return b.pulls
+}
+
+// AddImage makes image present in the backend, as if it was pulled before.
+func (b *Backend) AddImage(image string) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.addImage(image)
+}
+
+// Images returns names of all pulled and built images.
+func (b *Backend) Images() []string {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	result := make([]string, 0, len(b.images))
+	for image := range b.images {
+		result = append(result, image)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (b *Backend) addImage(image string) {
+	b.images[image] = struct{}{}
+}
+
+func (b *Backend) nextSessionID() string {
+	b.lastSessionID++
+	return "session-" + strconv.Itoa(b.lastSessionID)
+}
+
+func (b *Backend) nextID() string {
+	b.lastID++
+	return fmt.Sprintf("%064x", b.lastID)
+}
+
+func (b *Backend) nextPort() string {
+	b.lastPort++
+	return strconv.Itoa(b.lastPort)
+}
+
+func (c *container) snapshot() *docker.Container {
+	result := c.info
+	result.Labels = copyStrings(c.info.Labels)
+	result.Ports = make(map[string][]docker.PortBinding, len(c.info.Ports))
+	for port, bindings := range c.info.Ports {
+		result.Ports[port] = append([]docker.PortBinding(nil), bindings...)
+	}
+	return &result
+}
+
+func (c *container) putFile(file docker.File) {
+	file.Path = path.Clean("/" + file.Path)
+	if file.Mode.Perm() == 0 && file.Mode.IsDir() {
+		file.Mode |= 0755
+	} else if file.Mode.Perm() == 0 {
+		file.Mode |= 0644
+	}
+	c.files[file.Path] = file
+}
+
+func (c *container) stop(exitCode int) {
+	if !c.info.State.Running {
+		return
+	}
+
+	c.info.State.Running = false
+	c.info.State.Status = "exited"
+	c.info.State.ExitCode = exitCode
+	c.info.State.FinishedAt = time.Now()
+	close(c.exited)
+}
+
+func normalizePort(port string) string {
+	if strings.Contains(port, "/") {
+		return port
+	}
+	return port + "/tcp"
+}
+
+func copyStrings(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+
+	result := make(map[string]string, len(values))
+	for key, value := range values {
+		result[key] = value
+	}
+	return result
+}
+
+func hasLabels(labels map[string]string, filter map[string]string) bool {
+	for key, value := range filter {
+		if labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func shortID(id string) string {
+	return id[len(id)-12:]
+}
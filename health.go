@@ -0,0 +1,122 @@
+package testenv
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultHealthCheckInterval = 500 * time.Millisecond
+	defaultHealthCheckTimeout  = time.Minute
+
+	diagnosticsLogLines = 50
+)
+
+type HealthCheck func(ctx context.Context) (bool, error)
+
+// HealthCheckOptions controls how ContainerDesc.HealthCheck is polled.
+// FailureThreshold is the number of consecutive errors after which waiting
+// is aborted; zero means errors are retried until Timeout. Timeout also
+// bounds ContainerDesc.WaitStrategy.
+type HealthCheckOptions struct {
+	Interval         time.Duration
+	Timeout          time.Duration
+	FailureThreshold int
+}
+
+func (h HealthCheckOptions) interval() time.Duration {
+	if h.Interval <= 0 {
+		return defaultHealthCheckInterval
+	}
+	return h.Interval
+}
+
+func (h HealthCheckOptions) timeout() time.Duration {
+	if h.Timeout <= 0 {
+		return defaultHealthCheckTimeout
+	}
+	return h.Timeout
+}
+
+func (c ContainerDesc) waitHealthy(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv, container *Container) error {
+	if c.HealthCheck == nil || *c.HealthCheck == nil {
+		return nil
+	}
+	healthCheck := *c.HealthCheck
+	containerID := container.ID()
+
+	timeout := c.HealthCheckOptions.timeout()
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	failures := 0
+	var lastErr error
+	for {
+		healthy, err := healthCheck(waitCtx)
+		switch {
+		case err != nil && waitCtx.Err() == nil:
+			failures++
+			lastErr = err
+			if c.HealthCheckOptions.FailureThreshold > 0 && failures >= c.HealthCheckOptions.FailureThreshold {
+				return errors.Errorf("health check failed %d times in a row: %v\n%s",
+					failures, err, containerDiagnostics(ctx, project.client, containerID, diagnosticsLogLines))
+			}
+		case healthy:
+			return nil
+		default:
+			failures = 0
+		}
+
+		info, err := project.client.InspectContainer(waitCtx, containerID)
+		if err == nil && !info.State.Running && !info.State.FinishedAt.IsZero() {
+			emit(project, testCase, Event{Type: EventContainerExited, Name: container.name, ID: containerID, ExitCode: info.State.ExitCode})
+			return errors.Errorf("container exited before becoming healthy\n%s",
+				containerDiagnostics(ctx, project.client, containerID, diagnosticsLogLines))
+		}
+
+		select {
+		case <-waitCtx.Done():
+			if err := ctx.Err(); err != nil {
+				return errors.WithStack(err)
+			}
+			msg := fmt.Sprintf("container is not healthy after %s", timeout)
+			if lastErr != nil {
+				msg += fmt.Sprintf(" (last error: %v)", lastErr)
+			}
+			return errors.Errorf("%s\n%s", msg, containerDiagnostics(ctx, project.client, containerID, diagnosticsLogLines))
+		case <-time.After(c.HealthCheckOptions.interval()):
+		}
+	}
+}
+
+func containerDiagnostics(ctx context.Context, client Backend, containerID string, logLines int) string {
+	result := &strings.Builder{}
+
+	container, err := client.InspectContainer(ctx, containerID)
+	if err != nil {
+		fmt.Fprintf(result, "state: failed to inspect container: %v\n", err)
+	} else {
+		state := container.State
+		fmt.Fprintf(result, "state: %s (running: %t, exit code: %d", state.Status, state.Running, state.ExitCode)
+		if state.OOMKilled {
+			result.WriteString(", OOM killed")
+		}
+		if state.Error != "" {
+			fmt.Fprintf(result, ", error: %s", state.Error)
+		}
+		result.WriteString(")\n")
+	}
+
+	logs, err := containerLogs(ctx, client, containerID, logLines)
+	if err != nil {
+		fmt.Fprintf(result, "logs: failed to fetch logs: %v", err)
+	} else {
+		fmt.Fprintf(result, "last %d log lines:\n%s", logLines, logs)
+	}
+
+	return result.String()
+}
@@ -0,0 +1,94 @@
+package testenv_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/saturn4er/go-testenv"
+	"github.com/saturn4er/go-testenv/fake"
+	"github.com/stretchr/testify/require"
+)
+
+func runHealthCheck(t *testing.T, backend *fake.Backend, healthCheck testenv.HealthCheck, options testenv.HealthCheckOptions, observers ...testenv.Observer) error {
+	projectEnv := testenv.NewProjectEnvWithBackend(testenv.ProjectEnvDesc{
+		Containers: map[string]testenv.ContainerDesc{
+			"postgres": {
+				Image:              testenv.ExternalImage("postgres"),
+				HealthCheck:        &healthCheck,
+				HealthCheckOptions: options,
+			},
+		},
+		Observers: observers,
+	}, backend)
+	defer func() {
+		require.NoError(t, projectEnv.Close())
+	}()
+
+	return projectEnv.Run()
+}
+
+func TestHealthCheckHealthy(t *testing.T) {
+	var calls int32
+	err := runHealthCheck(t, fake.NewBackend(), func(ctx context.Context) (bool, error) {
+		return atomic.AddInt32(&calls, 1) == 3, nil
+	}, testenv.HealthCheckOptions{Interval: time.Millisecond})
+	require.NoError(t, err)
+	require.EqualValues(t, 3, atomic.LoadInt32(&calls))
+}
+
+func TestHealthCheckTimeoutBoundsCheck(t *testing.T) {
+	started := time.Now()
+	err := runHealthCheck(t, fake.NewBackend(), func(ctx context.Context) (bool, error) {
+		<-ctx.Done()
+		return false, ctx.Err()
+	}, testenv.HealthCheckOptions{Interval: time.Millisecond, Timeout: 20 * time.Millisecond, FailureThreshold: 1})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "container is not healthy after 20ms")
+	require.NotContains(t, err.Error(), "failed 1 times in a row")
+	require.Less(t, int64(time.Since(started)), int64(5*time.Second))
+}
+
+func TestHealthCheckTimeoutReportsLastError(t *testing.T) {
+	err := runHealthCheck(t, fake.NewBackend(), func(ctx context.Context) (bool, error) {
+		return false, errors.New("connection refused")
+	}, testenv.HealthCheckOptions{Interval: time.Millisecond, Timeout: 20 * time.Millisecond})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "container is not healthy after 20ms (last error: connection refused)")
+}
+
+func TestHealthCheckFailureThreshold(t *testing.T) {
+	var calls int32
+	err := runHealthCheck(t, fake.NewBackend(), func(ctx context.Context) (bool, error) {
+		if atomic.AddInt32(&calls, 1) == 2 {
+			return false, nil
+		}
+		return false, errors.New("connection refused")
+	}, testenv.HealthCheckOptions{Interval: time.Millisecond, FailureThreshold: 3})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "health check failed 3 times in a row: connection refused")
+	require.EqualValues(t, 5, atomic.LoadInt32(&calls))
+}
+
+func TestHealthCheckContainerExited(t *testing.T) {
+	backend := fake.NewBackend()
+	recorder := &eventRecorder{}
+
+	err := runHealthCheck(t, backend, func(ctx context.Context) (bool, error) {
+		for _, container := range backend.Containers() {
+			if container.State.Running {
+				require.NoError(t, backend.StopContainer(container.ID, 3))
+			}
+		}
+		return false, nil
+	}, testenv.HealthCheckOptions{Interval: time.Millisecond}, recorder.observe)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "container exited before becoming healthy")
+	require.Contains(t, err.Error(), "exit code: 3")
+
+	exited := recorder.find(testenv.EventContainerExited, "postgres")
+	require.Len(t, exited, 1)
+	require.Equal(t, 3, exited[0].ExitCode)
+}
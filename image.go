@@ -1,7 +1,11 @@
 package testenv
 
 import (
+	"context"
+	"io"
+	"io/ioutil"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/saturn4er/go-testenv/docker"
@@ -10,55 +14,243 @@ import (
 type BuildImageParams struct {
 }
 
-type ImageResolver func(project *ProjectEnv, caseEnv *TestCaseEnv) (string, error)
+type ImageResolver func(ctx context.Context, project *ProjectEnv, caseEnv *TestCaseEnv) (string, error)
 
 func ExternalImage(image string) ImageResolver {
-	return func(project *ProjectEnv, caseEnv *TestCaseEnv) (string, error) {
+	return func(ctx context.Context, project *ProjectEnv, caseEnv *TestCaseEnv) (string, error) {
 		return image, nil
 	}
 }
 
+// BuildImage builds the image once per project, later calls return the
+// built image until the project is closed.
 func BuildImage(desc ImageDesc) ImageResolver {
-	var image string
-	var err error
-
-	once := &sync.Once{}
-	return func(project *ProjectEnv, caseEnv *TestCaseEnv) (string, error) {
-		once.Do(func() {
-			image, err = desc.build(project, caseEnv)
+	key := &desc
+	return func(ctx context.Context, project *ProjectEnv, caseEnv *TestCaseEnv) (string, error) {
+		return project.resolveImage(key, func() (string, error) {
+			return desc.build(ctx, project, caseEnv)
 		})
-
-		return image, err
 	}
 }
 
+// imageBuild is the image built by an ImageResolver for a project.
+type imageBuild struct {
+	mx    sync.Mutex
+	image string
+}
+
+type ImageRetention int
+
+const (
+	// ImageRetentionRemove untags images built by the environment on Close,
+	// unless containers, e.g. of other sessions, use them.
+	ImageRetentionRemove ImageRetention = iota
+	// ImageRetentionKeep keeps built images, so later runs reuse them.
+	ImageRetentionKeep
+)
+
+// ImageDesc describes an image built from ContextDir, or from ContextArchive,
+// a tar archive of the build context. DockerfileContent, if set, is used
+// instead of the Dockerfile file, and the context may be omitted then.
+// Target selects a stage of a multi-stage Dockerfile, Platform the platform
+// of the image, e.g. "linux/amd64".
+//
+// The image is tagged with a hash of the Dockerfile, the build context
+// without files excluded by .dockerignore, build args, labels, target and
+// platform, and an existing image with that tag is used instead of building
+// it again, unless NoCache or Pull is set. Set $TESTENV_FRESH to always
+// build. As the tag is shared by all sessions on the host, images are built
+// without session labels and are not removed by Cleanup or Prune, Retention
+// only decides whether the tag is removed on Close.
+//
+// Build output is written to Output, and to the project Logger if LogOutput
+// is set. Errors of failed builds include the last lines of output.
 type ImageDesc struct {
-	Dockerfile string
-	ContextDir string
-	Labels     StringsMap
-	BuildArgs  StringsMap
+	Dockerfile        string
+	DockerfileContent string
+	ContextDir        string
+	ContextArchive    []byte
+	Labels            StringsMap
+	BuildArgs         StringsMap
+	Target            string
+	Platform          string
+	NoCache           bool
+	Pull              bool
+	Output            io.Writer
+	LogOutput         bool
+	Retention         ImageRetention
 }
 
-func (i ImageDesc) build(project *ProjectEnv, testCase *TestCaseEnv) (string, error) {
-	labels, err := i.Labels.resolve(project, testCase)
+func (i ImageDesc) build(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv) (string, error) {
+	labels, err := i.Labels.resolve(ctx, project, testCase)
 	if err != nil {
 		return "", errors.Wrap(err, "failed to resolve labels")
 	}
 
-	buildArgs, err := i.Labels.resolve(project, testCase)
+	buildArgs, err := i.BuildArgs.resolve(ctx, project, testCase)
 	if err != nil {
 		return "", errors.Wrap(err, "failed to resolve build args")
 	}
 
-	imageName, err := project.client.BuildImage(docker.BuildImageParams{
-		Dockerfile: i.Dockerfile,
-		ContextDir: i.ContextDir,
-		Labels:     labels,
-		BuildArgs:  buildArgs,
+	tag, err := i.contentTag(labels, buildArgs)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to hash build context")
+	}
+
+	pull := i.Pull && !project.offline()
+	if !freshRequested() && !i.NoCache && !pull {
+		exists, err := project.client.ImageExists(ctx, tag)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to check image %s", tag)
+		}
+		if exists {
+			project.logger.Info("Reusing built image", "image", tag)
+			project.addBuiltImage(tag, false)
+			return tag, nil
+		}
+	}
+
+	var output io.Writer = ioutil.Discard
+	var outputLog *logWriter
+	if i.LogOutput {
+		outputLog = &logWriter{logger: project.logger, msg: "Build output", keysAndValues: []interface{}{"image", tag}}
+		output = outputLog
+	}
+	if i.Output != nil {
+		output = io.MultiWriter(i.Output, output)
+	}
+
+	var dockerfileContent []byte
+	if i.DockerfileContent != "" {
+		dockerfileContent = []byte(i.DockerfileContent)
+	}
+
+	emit(project, testCase, Event{Type: EventImageBuildStarted, Image: tag})
+	started := time.Now()
+	spanCtx, span := startSpan(ctx, project, testCase, "testenv.image.build")
+	imageName, err := project.client.BuildImage(spanCtx, docker.BuildImageParams{
+		Name:              tag,
+		Dockerfile:        i.Dockerfile,
+		DockerfileContent: dockerfileContent,
+		ContextDir:        i.ContextDir,
+		ContextArchive:    i.ContextArchive,
+		Labels:            labels,
+		BuildArgs:         buildArgs,
+		Target:            i.Target,
+		Platform:          i.Platform,
+		NoCache:           i.NoCache,
+		Pull:              pull,
+		Output:            output,
+		Persistent:        true,
 	})
+	if outputLog != nil {
+		outputLog.flush()
+	}
+	span.SetAttributes(attrImage.String(imageName))
+	endSpan(span, err)
+	emit(project, testCase, Event{Type: EventImageBuildFinished, Image: imageName, Duration: time.Since(started), Err: err})
 	if err != nil {
 		return "", errors.WithStack(err)
 	}
 
+	project.addBuiltImage(imageName, i.Retention == ImageRetentionRemove)
 	return imageName, nil
 }
+
+// PullPolicy defines when the image of a container is pulled. The default is
+// PullIfNotPresent. PullAlways pulls an image once per ProjectEnv, even if
+// it's present. Images built by the environment are never pulled, and no
+// images are pulled in offline mode, see ProjectEnvDesc.Offline.
+type PullPolicy byte
+
+const (
+	PullIfNotPresent PullPolicy = iota
+	PullAlways
+	PullNever
+)
+
+func (p PullPolicy) String() string {
+	switch p {
+	case PullIfNotPresent:
+		return "ifNotPresent"
+	case PullAlways:
+		return "always"
+	case PullNever:
+		return "never"
+	}
+	return "unknown"
+}
+
+const pullProgressInterval = time.Second
+
+// pullImage pulls image according to policy.
+func pullImage(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv, name, image string, policy PullPolicy) error {
+	if _, err := docker.ParseReference(image); err != nil {
+		return errors.Wrapf(err, "invalid image %s", image)
+	}
+	if project.offline() {
+		policy = PullNever
+	}
+	if policy == PullAlways && project.isFreshImage(image) {
+		return nil
+	}
+	if policy != PullAlways {
+		exists, err := project.client.ImageExists(ctx, image)
+		if err != nil {
+			return errors.Wrapf(err, "failed to check image %s", image)
+		}
+		if exists {
+			return nil
+		}
+		if project.offline() {
+			return errors.Errorf("image %s is not present and pulling is disabled in offline mode", image)
+		}
+		if policy == PullNever {
+			return errors.Errorf("image %s is not present and pull policy is %s", image, policy)
+		}
+	}
+
+	emit(project, testCase, Event{Type: EventImagePullStarted, Name: name, Image: image})
+	started := time.Now()
+	spanCtx, span := startSpan(ctx, project, testCase, "testenv.image.pull", attrName.String(name), attrImage.String(image))
+	err := project.client.PullImage(spanCtx, docker.PullImageParams{
+		Image:    image,
+		Progress: pullProgressEmitter(project, testCase, name, image),
+	})
+	endSpan(span, err)
+	emit(project, testCase, Event{Type: EventImagePullFinished, Name: name, Image: image, Duration: time.Since(started), Err: err})
+	if err != nil {
+		return errors.Wrapf(err, "failed to pull image %s", image)
+	}
+
+	project.addPulledImage(image)
+	return nil
+}
+
+// pullProgressEmitter returns progress callback which emits
+// EventImagePullProgress when status of a layer changes, and at most once
+// per pullProgressInterval while it stays the same.
+func pullProgressEmitter(project *ProjectEnv, testCase *TestCaseEnv, name, image string) func(docker.PullProgress) {
+	type layerState struct {
+		status  string
+		emitted time.Time
+	}
+	layers := map[string]layerState{}
+	return func(progress docker.PullProgress) {
+		now := time.Now()
+		if state, ok := layers[progress.Layer]; ok && state.status == progress.Status && now.Sub(state.emitted) < pullProgressInterval {
+			return
+		}
+		layers[progress.Layer] = layerState{status: progress.Status, emitted: now}
+		emit(project, testCase, Event{
+			Type:    EventImagePullProgress,
+			Name:    name,
+			ID:      progress.Layer,
+			Image:   image,
+			Status:  progress.Status,
+			Current: progress.Current,
+			Total:   progress.Total,
+			Time:    now,
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package testenv
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// interpolate parses value with placeholders into a resolver. Supported
+// placeholders are ${env:NAME}, ${project:KEY}, ${testCase:KEY} and
+// ${port:CONTAINER:PORT[/tcp|/udp]}, "$$" is a literal dollar sign. It also
+// returns names of containers referenced by the value.
+func interpolate(value string) (StringValueResolver, []string, error) {
+	var (
+		parts      []StringValueResolver
+		containers []string
+		literal    strings.Builder
+	)
+	flush := func() {
+		if literal.Len() != 0 {
+			parts = append(parts, StringValue(literal.String()))
+			literal.Reset()
+		}
+	}
+
+	for i := 0; i < len(value); i++ {
+		if value[i] != '$' || i+1 == len(value) {
+			literal.WriteByte(value[i])
+			continue
+		}
+
+		switch value[i+1] {
+		case '$':
+			literal.WriteByte('$')
+			i++
+			continue
+		case '{':
+		default:
+			literal.WriteByte(value[i])
+			continue
+		}
+
+		end := strings.IndexByte(value[i:], '}')
+		if end == -1 {
+			return nil, nil, errors.Errorf("unterminated placeholder in %q", value)
+		}
+		placeholder := value[i+2 : i+end]
+		i += end
+
+		resolver, container, err := placeholderValue(placeholder)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid placeholder in %q", value)
+		}
+		if container != "" {
+			containers = append(containers, container)
+		}
+		flush()
+		parts = append(parts, resolver)
+	}
+	flush()
+
+	switch len(parts) {
+	case 0:
+		return StringValue(""), containers, nil
+	case 1:
+		return parts[0], containers, nil
+	}
+	return concatValues(parts), containers, nil
+}
+
+func placeholderValue(placeholder string) (StringValueResolver, string, error) {
+	kind, arg := placeholder, ""
+	if idx := strings.IndexByte(placeholder, ':'); idx != -1 {
+		kind, arg = placeholder[:idx], placeholder[idx+1:]
+	}
+	if arg == "" {
+		return nil, "", errors.Errorf("placeholder ${%s} has no argument", placeholder)
+	}
+
+	switch kind {
+	case "env":
+		return EnvStringValue(arg), "", nil
+	case "project":
+		return ProjectVariableValue(arg), "", nil
+	case "testCase":
+		return TestCaseVariableValue(arg), "", nil
+	case "port":
+		idx := strings.IndexByte(arg, ':')
+		if idx == -1 {
+			return nil, "", errors.Errorf("placeholder ${%s} must be ${port:CONTAINER:PORT}", placeholder)
+		}
+		container := arg[:idx]
+		port, portType, err := parsePort(arg[idx+1:])
+		if err != nil {
+			return nil, "", err
+		}
+		return ContainerHostPortValue(container, port, portType), container, nil
+	}
+	return nil, "", errors.Errorf("unknown placeholder ${%s}", placeholder)
+}
+
+func parsePort(value string) (string, PortType, error) {
+	port, proto := value, "tcp"
+	if idx := strings.IndexByte(value, '/'); idx != -1 {
+		port, proto = value[:idx], value[idx+1:]
+	}
+
+	switch proto {
+	case "tcp":
+		return port, PortTypeTCP, nil
+	case "udp":
+		return port, PortTypeUDP, nil
+	}
+	return "", 0, errors.Errorf("unknown protocol of port %q", value)
+}
+
+func concatValues(values []StringValueResolver) StringValueResolver {
+	return func(ctx context.Context, project *ProjectEnv, caseEnv *TestCaseEnv) (string, error) {
+		var result strings.Builder
+		for _, value := range values {
+			part, err := value(ctx, project, caseEnv)
+			if err != nil {
+				return "", err
+			}
+			result.WriteString(part)
+		}
+		return result.String(), nil
+	}
+}
@@ -0,0 +1,112 @@
+package testenv
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// Logger receives diagnostic messages of ProjectEnv and TestCaseEnv.
+// keysAndValues are alternating keys and values. Adapters for logrus and zap
+// are in packages logrusadapter and zapadapter.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+// PrintfLogger returns Logger which formats messages as "msg key=value ..."
+// and writes them with printf, e.g. log.Printf or testing.T.Logf.
+func PrintfLogger(printf func(format string, args ...interface{})) Logger {
+	return printfLogger(printf)
+}
+
+// NopLogger returns Logger which discards all messages.
+func NopLogger() Logger {
+	return printfLogger(func(format string, args ...interface{}) {})
+}
+
+type printfLogger func(format string, args ...interface{})
+
+func (p printfLogger) Debug(msg string, keysAndValues ...interface{}) {
+	p.log("DEBUG", msg, keysAndValues)
+}
+
+func (p printfLogger) Info(msg string, keysAndValues ...interface{}) {
+	p.log("INFO", msg, keysAndValues)
+}
+
+func (p printfLogger) Warn(msg string, keysAndValues ...interface{}) {
+	p.log("WARN", msg, keysAndValues)
+}
+
+func (p printfLogger) Error(msg string, keysAndValues ...interface{}) {
+	p.log("ERROR", msg, keysAndValues)
+}
+
+func (p printfLogger) log(level, msg string, keysAndValues []interface{}) {
+	p("%s %s%s", level, msg, formatFields(keysAndValues))
+}
+
+func formatFields(keysAndValues []interface{}) string {
+	result := &strings.Builder{}
+	for i := 0; i < len(keysAndValues); i += 2 {
+		if i+1 == len(keysAndValues) {
+			fmt.Fprintf(result, " %v", keysAndValues[i])
+			break
+		}
+		fmt.Fprintf(result, " %v=%v", keysAndValues[i], keysAndValues[i+1])
+	}
+	return result.String()
+}
+
+func defaultLogger(desc ProjectEnvDesc) Logger {
+	if desc.Logger != nil {
+		return desc.Logger
+	}
+	return PrintfLogger(log.Printf)
+}
+
+// logWriter logs every written line as a separate message.
+type logWriter struct {
+	logger        Logger
+	msg           string
+	keysAndValues []interface{}
+
+	mx  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (l *logWriter) Write(p []byte) (int, error) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	l.buf.Write(p)
+	for {
+		line, err := l.buf.ReadString('\n')
+		if err != nil {
+			l.buf.WriteString(line)
+			return len(p), nil
+		}
+		l.log(strings.TrimRight(line, "\r\n"))
+	}
+}
+
+// flush logs the last line, if it doesn't end with a newline.
+func (l *logWriter) flush() {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if l.buf.Len() > 0 {
+		l.log(l.buf.String())
+		l.buf.Reset()
+	}
+}
+
+func (l *logWriter) log(line string) {
+	keysAndValues := append(append([]interface{}(nil), l.keysAndValues...), "line", line)
+	l.logger.Info(l.msg, keysAndValues...)
+}
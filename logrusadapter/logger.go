@@ -0,0 +1,48 @@
+// Package logrusadapter adapts logrus loggers to testenv.Logger.
+package logrusadapter
+
+import (
+	"fmt"
+
+	"github.com/saturn4er/go-testenv"
+	"github.com/sirupsen/logrus"
+)
+
+type logger struct {
+	entry *logrus.Entry
+}
+
+// New returns testenv.Logger writing to l. Key-value pairs are passed as
+// logrus fields.
+func New(l logrus.FieldLogger) testenv.Logger {
+	return logger{entry: l.WithFields(logrus.Fields{})}
+}
+
+func (l logger) Debug(msg string, keysAndValues ...interface{}) {
+	l.with(keysAndValues).Debug(msg)
+}
+
+func (l logger) Info(msg string, keysAndValues ...interface{}) {
+	l.with(keysAndValues).Info(msg)
+}
+
+func (l logger) Warn(msg string, keysAndValues ...interface{}) {
+	l.with(keysAndValues).Warn(msg)
+}
+
+func (l logger) Error(msg string, keysAndValues ...interface{}) {
+	l.with(keysAndValues).Error(msg)
+}
+
+func (l logger) with(keysAndValues []interface{}) *logrus.Entry {
+	fields := make(logrus.Fields, len(keysAndValues)/2)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key := fmt.Sprint(keysAndValues[i])
+		if i+1 == len(keysAndValues) {
+			fields["!BADKEY"] = key
+			break
+		}
+		fields[key] = keysAndValues[i+1]
+	}
+	return l.entry.WithFields(fields)
+}
@@ -0,0 +1,32 @@
+package logrusadapter_test
+
+import (
+	"testing"
+
+	"github.com/saturn4er/go-testenv/logrusadapter"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger(t *testing.T) {
+	l, hook := test.NewNullLogger()
+	l.SetLevel(logrus.DebugLevel)
+	logger := logrusadapter.New(l.WithField("suite", "db"))
+
+	logger.Debug("image resolved", "name", "postgres", "image", "postgres:12")
+	logger.Info("container started", "name", "postgres")
+	logger.Warn("container not removed")
+	logger.Error("cleanup failed", "error", "timeout", "dangling")
+
+	entries := hook.AllEntries()
+	require.Len(t, entries, 4)
+	require.Equal(t, logrus.DebugLevel, entries[0].Level)
+	require.Equal(t, "image resolved", entries[0].Message)
+	require.Equal(t, logrus.Fields{"suite": "db", "name": "postgres", "image": "postgres:12"}, entries[0].Data)
+	require.Equal(t, logrus.InfoLevel, entries[1].Level)
+	require.Equal(t, logrus.WarnLevel, entries[2].Level)
+	require.Equal(t, logrus.Fields{"suite": "db"}, entries[2].Data)
+	require.Equal(t, logrus.ErrorLevel, entries[3].Level)
+	require.Equal(t, logrus.Fields{"suite": "db", "error": "timeout", "!BADKEY": "dangling"}, entries[3].Data)
+}
@@ -0,0 +1,187 @@
+package testenv
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/saturn4er/go-testenv/docker"
+)
+
+const artifactsDirEnv = "TESTENV_ARTIFACTS_DIR"
+
+// LogsOptions selects container output. If neither Stdout nor Stderr is set,
+// both streams are returned. Tail limits output to the given number of last
+// lines, zero means all lines.
+type LogsOptions struct {
+	Stdout     bool
+	Stderr     bool
+	Since      time.Time
+	Tail       int
+	Timestamps bool
+}
+
+func (l LogsOptions) params(stdout, stderr io.Writer) docker.LogsParams {
+	params := docker.LogsParams{
+		Since:      l.Since,
+		Tail:       l.Tail,
+		Timestamps: l.Timestamps,
+	}
+	if l.Stdout || !l.Stderr {
+		params.Stdout = stdout
+	}
+	if l.Stderr || !l.Stdout {
+		params.Stderr = stderr
+	}
+	return params
+}
+
+// Logs returns container output selected by opts.
+func (c *Container) Logs(ctx context.Context, opts LogsOptions) (string, error) {
+	buf := &syncBuffer{}
+	if err := c.client.Logs(ctx, c.ID(), opts.params(buf, buf)); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return buf.String(), nil
+}
+
+// FollowLogs writes container output selected by opts to w until the
+// container stops or ctx is done.
+func (c *Container) FollowLogs(ctx context.Context, opts LogsOptions, w io.Writer) error {
+	params := opts.params(w, w)
+	params.Follow = true
+
+	err := c.client.Logs(ctx, c.ID(), params)
+	if err != nil && errors.Cause(err) != context.Canceled {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// FollowLogLines calls onLine for every line of container output until the
+// container stops or ctx is done.
+func (c *Container) FollowLogLines(ctx context.Context, opts LogsOptions, onLine func(line string)) error {
+	reader, writer := io.Pipe()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			onLine(scanner.Text())
+		}
+		_, _ = io.Copy(ioutil.Discard, reader)
+	}()
+
+	err := c.FollowLogs(ctx, opts, &syncWriter{w: writer})
+	_ = writer.Close()
+	<-done
+
+	return err
+}
+
+func containerLogs(ctx context.Context, client Backend, id string, tail int) (string, error) {
+	buf := &syncBuffer{}
+	if err := client.Logs(ctx, id, docker.LogsParams{Stdout: buf, Stderr: buf, Tail: tail}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// logCapture tees output of containers to files in artifacts directory.
+type logCapture struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newLogCapture() *logCapture {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &logCapture{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (l *logCapture) capture(path string, container *Container, logger Logger) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		logger.Warn("Failed to create artifacts directory", "path", path, "error", err)
+		return
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		logger.Warn("Failed to create log file", "path", path, "error", err)
+		return
+	}
+	logger.Debug("Writing container logs", "id", container.ID(), "path", path)
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		defer file.Close()
+
+		if err := container.FollowLogs(l.ctx, LogsOptions{}, &syncWriter{w: file}); err != nil {
+			logger.Warn("Failed to capture container logs", "id", container.ID(), "error", err)
+		}
+	}()
+}
+
+// stop waits until all containers stop writing logs.
+func (l *logCapture) stop() {
+	l.cancel()
+	l.wg.Wait()
+}
+
+func artifactsDir(desc ProjectEnvDesc, runID string) string {
+	dir := desc.ArtifactsDir
+	if dir == "" {
+		dir = os.Getenv(artifactsDirEnv)
+	}
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "testenv-artifacts")
+	}
+	return filepath.Join(dir, runID)
+}
+
+func logFileName(name string) string {
+	return strings.NewReplacer("/", "_", "\\", "_").Replace(name) + ".log"
+}
+
+type syncBuffer struct {
+	mx  sync.Mutex
+	buf strings.Builder
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.buf.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.buf.String()
+}
+
+// syncWriter serializes writes of stdout and stderr copied concurrently to
+// the same writer.
+type syncWriter struct {
+	mx sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.w.Write(p)
+}
@@ -0,0 +1,72 @@
+package testenv_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/saturn4er/go-testenv"
+	"github.com/saturn4er/go-testenv/fake"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContainerLogs(t *testing.T) {
+	backend := fake.NewBackend()
+	artifactsDir, err := ioutil.TempDir("", "testenv")
+	require.NoError(t, err)
+	defer os.RemoveAll(artifactsDir)
+
+	projectEnv := testenv.NewProjectEnvWithBackendT(t, testenv.ProjectEnvDesc{
+		Containers: map[string]testenv.ContainerDesc{
+			"kafka": {
+				Image:       testenv.ExternalImage("kafka"),
+				CaptureLogs: true,
+			},
+		},
+		ArtifactsDir: artifactsDir,
+	}, backend)
+
+	ctx := context.Background()
+	kafka := projectEnv.MustContainer("kafka")
+	require.NoError(t, backend.WriteLogs(kafka.ID(), "starting\n"))
+	require.NoError(t, backend.WriteErrorLogs(kafka.ID(), "warning\n"))
+	require.NoError(t, backend.WriteLogs(kafka.ID(), "started\n"))
+
+	logs, err := kafka.Logs(ctx, testenv.LogsOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "starting\nwarning\nstarted\n", logs)
+
+	logs, err = kafka.Logs(ctx, testenv.LogsOptions{Stderr: true})
+	require.NoError(t, err)
+	require.Equal(t, "warning\n", logs)
+
+	logs, err = kafka.Logs(ctx, testenv.LogsOptions{Stdout: true, Tail: 1})
+	require.NoError(t, err)
+	require.Equal(t, "started\n", logs)
+
+	lines := make(chan string, 10)
+	done := make(chan error)
+	go func() {
+		done <- kafka.FollowLogLines(ctx, testenv.LogsOptions{Stdout: true}, func(line string) {
+			lines <- line
+		})
+	}()
+	require.Equal(t, "starting", <-lines)
+	require.Equal(t, "started", <-lines)
+
+	require.NoError(t, backend.WriteLogs(kafka.ID(), "stopping\n"))
+	require.Equal(t, "stopping", <-lines)
+
+	require.NoError(t, backend.StopContainer(kafka.ID(), 0))
+	require.NoError(t, <-done)
+
+	require.NoError(t, projectEnv.Close())
+	files, err := filepath.Glob(filepath.Join(artifactsDir, "*", "project", "kafka.log"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	captured, err := ioutil.ReadFile(files[0])
+	require.NoError(t, err)
+	require.Equal(t, "starting\nwarning\nstarted\nstopping\n", string(captured))
+}
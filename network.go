@@ -1,19 +1,21 @@
 package testenv
 
 import (
-	dc "github.com/ory/dockertest/docker"
+	"context"
+	"time"
+
 	"github.com/pkg/errors"
 	"github.com/saturn4er/go-testenv/docker"
 )
 
-type NetworkResolver func(project *ProjectEnv, testCase *TestCaseEnv) (string, error)
+type NetworkResolver func(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv) (string, error)
 
 func ProjectNetwork(name string) NetworkResolver {
-	return func(project *ProjectEnv, testCase *TestCaseEnv) (string, error) {
+	return func(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv) (string, error) {
 		if project == nil {
 			return "", errors.New("no project passed")
 		}
-		network, ok := project.createdNetworks[name]
+		network, ok := project.network(name)
 		if !ok {
 			return "", errors.Errorf("no network %s in project", name)
 		}
@@ -22,12 +24,12 @@ func ProjectNetwork(name string) NetworkResolver {
 }
 
 func TestCaseNetwork(name string) NetworkResolver {
-	return func(project *ProjectEnv, testCase *TestCaseEnv) (string, error) {
+	return func(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv) (string, error) {
 		if testCase == nil {
 			return "", errors.New("can't use TestCaseNetwork resolver in project scope")
 		}
 
-		network, ok := testCase.createdNetworks[name]
+		network, ok := testCase.network(name)
 		if !ok {
 			return "", errors.Errorf("no network %s in test case", name)
 		}
@@ -39,15 +41,35 @@ type NetworkDesc struct {
 	Labels StringsMap
 }
 
-func (n *NetworkDesc) create(project *ProjectEnv, testCase *TestCaseEnv) (*dc.Network, error) {
-	labels, err := n.Labels.resolve(project, testCase)
+func (n *NetworkDesc) create(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv, name string) (network *docker.Network, err error) {
+	ctx, span := startSpan(ctx, project, testCase, "testenv.network.create", attrName.String(name))
+	defer func() {
+		if network != nil {
+			span.SetAttributes(attrNetworkID.String(network.ID))
+		}
+		endSpan(span, err)
+	}()
+
+	labels, err := n.Labels.resolve(ctx, project, testCase)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
-	network, err := project.client.CreateNetwork(docker.CreateNetworkParams{
+	params := docker.CreateNetworkParams{
 		Labels: labels,
-	})
+	}
+
+	if testCase == nil && project.reuse() {
+		network, err = project.reuseNetwork(ctx, name, params)
+	} else {
+		started := time.Now()
+		network, err = project.client.CreateNetwork(ctx, params)
+		event := Event{Type: EventNetworkCreated, Name: name, Duration: time.Since(started), Err: err}
+		if network != nil {
+			event.ID = network.ID
+		}
+		emit(project, testCase, event)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -55,6 +77,41 @@ func (n *NetworkDesc) create(project *ProjectEnv, testCase *TestCaseEnv) (*dc.Ne
 	return network, nil
 }
 
+// createNetworks creates networks concurrently, at most limit at a time.
+func createNetworks(
+	ctx context.Context,
+	project *ProjectEnv,
+	testCase *TestCaseEnv,
+	networks map[string]NetworkDesc,
+	limit limiter,
+	register func(network *Network),
+) error {
+	group := newTaskGroup(ctx)
+	for networkName, networkDesc := range networks {
+		networkName, networkDesc := networkName, networkDesc
+		group.Go(func(ctx context.Context) error {
+			if err := limit.acquire(ctx); err != nil {
+				return err
+			}
+			defer limit.release()
+
+			network, err := networkDesc.create(ctx, project, testCase, networkName)
+			if err != nil {
+				return errors.Wrapf(err, "failed to create network %s", networkName)
+			}
+
+			register(&Network{
+				ID:         network.ID,
+				Name:       networkName,
+				DockerName: network.Name,
+			})
+			return nil
+		})
+	}
+
+	return group.Wait()
+}
+
 type Network struct {
 	ID         string
 	Name       string
@@ -0,0 +1,88 @@
+package testenv
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+// limiter bounds the number of concurrently running operations. A nil
+// limiter doesn't limit anything.
+type limiter chan struct{}
+
+func newLimiter(limit int) limiter {
+	if limit <= 0 {
+		return nil
+	}
+	return make(limiter, limit)
+}
+
+func (l limiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+func (l limiter) release() {
+	if l != nil {
+		<-l
+	}
+}
+
+// taskGroup runs tasks concurrently and cancels the rest of them once one
+// fails. Errors caused by that cancellation are not reported.
+type taskGroup struct {
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mx   sync.Mutex
+	errs error
+}
+
+func newTaskGroup(parent context.Context) *taskGroup {
+	ctx, cancel := context.WithCancel(parent)
+	return &taskGroup{
+		parent: parent,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (g *taskGroup) Go(task func(ctx context.Context) error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+
+		if err := task(g.ctx); err != nil {
+			g.cancel()
+			if errors.Cause(err) == context.Canceled {
+				return
+			}
+
+			g.mx.Lock()
+			g.errs = multierr.Append(g.errs, err)
+			g.mx.Unlock()
+		}
+	}()
+}
+
+func (g *taskGroup) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+
+	if g.errs == nil && g.parent.Err() != nil {
+		return errors.WithStack(g.parent.Err())
+	}
+	return g.errs
+}
@@ -0,0 +1,60 @@
+package testenv
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/multierr"
+)
+
+func TestTaskGroupCancelsRemainingTasks(t *testing.T) {
+	group := newTaskGroup(context.Background())
+	group.Go(func(ctx context.Context) error {
+		return errors.New("first")
+	})
+	group.Go(func(ctx context.Context) error {
+		return errors.New("second")
+	})
+	group.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		return errors.WithStack(ctx.Err())
+	})
+
+	err := group.Wait()
+	require.Len(t, multierr.Errors(err), 2)
+	require.Contains(t, err.Error(), "first")
+	require.Contains(t, err.Error(), "second")
+}
+
+func TestLimiter(t *testing.T) {
+	limit := newLimiter(2)
+	group := newTaskGroup(context.Background())
+
+	var running, maxRunning int32
+	for i := 0; i < 10; i++ {
+		group.Go(func(ctx context.Context) error {
+			if err := limit.acquire(ctx); err != nil {
+				return err
+			}
+			defer limit.release()
+
+			current := atomic.AddInt32(&running, 1)
+			for {
+				observed := atomic.LoadInt32(&maxRunning)
+				if current <= observed || atomic.CompareAndSwapInt32(&maxRunning, observed, current) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil
+		})
+	}
+
+	require.NoError(t, group.Wait())
+	require.EqualValues(t, 2, maxRunning)
+}
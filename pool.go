@@ -0,0 +1,183 @@
+package testenv
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+type TestCaseEnvPoolOptions struct {
+	// Size is the number of test case environments kept by the pool.
+	// Defaults to 1.
+	Size int
+	// Reset is called on Release. If it succeeds, the environment is returned
+	// to the pool, otherwise it is closed and replaced by a new one. If Reset
+	// is nil, released environments are always replaced.
+	Reset func(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv) error
+}
+
+func (o TestCaseEnvPoolOptions) size() int {
+	if o.Size <= 0 {
+		return 1
+	}
+	return o.Size
+}
+
+type poolResult struct {
+	env *TestCaseEnv
+	err error
+}
+
+// TestCaseEnvPool keeps a fixed number of test case environments and starts
+// them in the background, so tests don't wait for containers to become
+// healthy.
+type TestCaseEnvPool struct {
+	project *ProjectEnv
+	opts    TestCaseEnvPoolOptions
+	ctx     context.Context
+	cancel  context.CancelFunc
+	results chan poolResult
+	wg      sync.WaitGroup
+
+	mx       sync.Mutex
+	closed   bool
+	acquired map[*TestCaseEnv]struct{}
+}
+
+// NewTestCaseEnvPool creates a pool and starts filling it in the background.
+func (p *ProjectEnv) NewTestCaseEnvPool(opts TestCaseEnvPoolOptions) *TestCaseEnvPool {
+	ctx, cancel := context.WithCancel(context.Background())
+	pool := &TestCaseEnvPool{
+		project:  p,
+		opts:     opts,
+		ctx:      ctx,
+		cancel:   cancel,
+		results:  make(chan poolResult, opts.size()),
+		acquired: map[*TestCaseEnv]struct{}{},
+	}
+	for i := 0; i < opts.size(); i++ {
+		pool.fill()
+	}
+	return pool
+}
+
+// Acquire returns a running test case environment, waiting until one is
+// available. If the environment failed to start, its error is returned and
+// a replacement is started.
+func (p *TestCaseEnvPool) Acquire(ctx context.Context) (*TestCaseEnv, error) {
+	select {
+	case result := <-p.results:
+		if result.err != nil {
+			p.fill()
+			return nil, result.err
+		}
+
+		p.mx.Lock()
+		p.acquired[result.env] = struct{}{}
+		p.mx.Unlock()
+		return result.env, nil
+	case <-p.ctx.Done():
+		return nil, errors.New("pool is closed")
+	case <-ctx.Done():
+		return nil, errors.WithStack(ctx.Err())
+	}
+}
+
+// Release returns testCase acquired from the pool. It is either reset and
+// reused or closed and replaced by a new environment. Releasing an
+// environment not acquired from the pool, or releasing it twice, is an
+// error.
+func (p *TestCaseEnvPool) Release(ctx context.Context, testCase *TestCaseEnv) error {
+	p.mx.Lock()
+	_, ok := p.acquired[testCase]
+	delete(p.acquired, testCase)
+	p.mx.Unlock()
+	if !ok {
+		return errors.New("test case is not acquired from the pool")
+	}
+
+	if p.opts.Reset != nil {
+		err := p.opts.Reset(ctx, p.project, testCase)
+		if err == nil && p.put(testCase) {
+			return nil
+		}
+		if err != nil {
+			p.project.logger.Warn("Failed to reset test case, replacing it", "testCase", testCase.id, "error", err)
+		}
+	}
+
+	err := testCase.CloseContext(ctx)
+	p.fill()
+	return err
+}
+
+func (p *TestCaseEnvPool) Close() error {
+	return p.CloseContext(context.Background())
+}
+
+// CloseContext stops filling the pool and closes idle environments.
+// Environments acquired and not released must be closed by their owners.
+func (p *TestCaseEnvPool) CloseContext(ctx context.Context) error {
+	p.mx.Lock()
+	p.closed = true
+	p.mx.Unlock()
+
+	p.cancel()
+	p.wg.Wait()
+
+	var err error
+	for {
+		select {
+		case result := <-p.results:
+			if result.env != nil {
+				err = multierr.Append(err, result.env.CloseContext(ctx))
+			}
+		default:
+			return errors.WithStack(err)
+		}
+	}
+}
+
+// fill starts a new test case environment in the background.
+func (p *TestCaseEnvPool) fill() {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if p.closed {
+		return
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		testCase := p.project.NewTestCaseEnv()
+		if err := testCase.RunContext(p.ctx); err != nil {
+			// resources created before a failure or cancellation by
+			// CloseContext must not leak
+			err = multierr.Append(err, testCase.CloseContext(context.Background()))
+			p.results <- poolResult{err: errors.Wrap(err, "failed to run pooled test case")}
+			return
+		}
+		p.results <- poolResult{env: testCase}
+	}()
+}
+
+// put returns testCase to the pool unless it is closed. It never blocks:
+// only acquired environments are put back, so the pool has room for them.
+func (p *TestCaseEnvPool) put(testCase *TestCaseEnv) bool {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if p.closed {
+		return false
+	}
+	select {
+	case p.results <- poolResult{env: testCase}:
+		return true
+	default:
+		return false
+	}
+}
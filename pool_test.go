@@ -0,0 +1,184 @@
+package testenv_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/saturn4er/go-testenv"
+	"github.com/saturn4er/go-testenv/docker"
+	"github.com/saturn4er/go-testenv/fake"
+	"github.com/stretchr/testify/require"
+)
+
+func poolProjectDesc() testenv.ProjectEnvDesc {
+	return testenv.ProjectEnvDesc{
+		TestCaseEnv: testenv.TestCaseEnvDesc{
+			Networks: map[string]testenv.NetworkDesc{
+				"private": {},
+			},
+			Containers: map[string]*testenv.ContainerDesc{
+				"postgres": {
+					Image: testenv.ExternalImage("postgres"),
+					Networks: []testenv.ContainerNetwork{
+						{Network: testenv.TestCaseNetwork("private")},
+					},
+				},
+			},
+		},
+		Logger: testenv.NopLogger(),
+	}
+}
+
+func postgresID(t *testing.T, testCaseEnv *testenv.TestCaseEnv) string {
+	container, ok := testCaseEnv.Container("postgres")
+	require.True(t, ok)
+	return container.ID()
+}
+
+func TestTestCaseEnvPoolReplacesReleased(t *testing.T) {
+	backend := fake.NewBackend()
+	projectEnv := testenv.NewProjectEnvWithBackend(poolProjectDesc(), backend)
+	require.NoError(t, projectEnv.Run())
+	defer func() {
+		require.NoError(t, projectEnv.Close())
+	}()
+
+	pool := projectEnv.NewTestCaseEnvPool(testenv.TestCaseEnvPoolOptions{Size: 2})
+
+	ctx := context.Background()
+	first, err := pool.Acquire(ctx)
+	require.NoError(t, err)
+	second, err := pool.Acquire(ctx)
+	require.NoError(t, err)
+	require.NotEqual(t, postgresID(t, first), postgresID(t, second))
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = pool.Acquire(timeoutCtx)
+	require.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+
+	firstID := postgresID(t, first)
+	require.NoError(t, pool.Release(ctx, first))
+	_, err = backend.InspectContainer(ctx, firstID)
+	require.Error(t, err)
+
+	third, err := pool.Acquire(ctx)
+	require.NoError(t, err)
+	require.NotEqual(t, firstID, postgresID(t, third))
+
+	require.NoError(t, pool.Release(ctx, second))
+	require.NoError(t, pool.Release(ctx, third))
+	require.NoError(t, pool.Close())
+	require.Empty(t, backend.Containers())
+	require.Empty(t, backend.Networks())
+
+	_, err = pool.Acquire(ctx)
+	require.EqualError(t, err, "pool is closed")
+}
+
+func TestTestCaseEnvPoolReusesResetEnvs(t *testing.T) {
+	backend := fake.NewBackend()
+	projectEnv := testenv.NewProjectEnvWithBackend(poolProjectDesc(), backend)
+	require.NoError(t, projectEnv.Run())
+	defer func() {
+		require.NoError(t, projectEnv.Close())
+	}()
+
+	resets := 0
+	pool := projectEnv.NewTestCaseEnvPool(testenv.TestCaseEnvPoolOptions{
+		Reset: func(ctx context.Context, project *testenv.ProjectEnv, testCase *testenv.TestCaseEnv) error {
+			resets++
+			if resets > 1 {
+				return errors.New("dirty")
+			}
+			testCase.Set("used", nil)
+			return nil
+		},
+	})
+	defer func() {
+		require.NoError(t, pool.Close())
+		require.Empty(t, backend.Containers())
+	}()
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		t.Run(fmt.Sprintf("case-%d", i), func(t *testing.T) {
+			testCaseEnv := pool.AcquireT(t)
+			require.Nil(t, testCaseEnv.Get("used"))
+			testCaseEnv.Set("used", true)
+			ids = append(ids, postgresID(t, testCaseEnv))
+		})
+	}
+
+	require.Equal(t, 3, resets)
+	require.Equal(t, ids[0], ids[1])
+	require.NotEqual(t, ids[1], ids[2])
+}
+
+func TestTestCaseEnvPoolRejectsUnknownRelease(t *testing.T) {
+	backend := fake.NewBackend()
+	projectEnv := testenv.NewProjectEnvWithBackend(poolProjectDesc(), backend)
+	require.NoError(t, projectEnv.Run())
+	defer func() {
+		require.NoError(t, projectEnv.Close())
+	}()
+
+	pool := projectEnv.NewTestCaseEnvPool(testenv.TestCaseEnvPoolOptions{
+		Size: 1,
+		Reset: func(ctx context.Context, project *testenv.ProjectEnv, testCase *testenv.TestCaseEnv) error {
+			return nil
+		},
+	})
+
+	ctx := context.Background()
+	testCase, err := pool.Acquire(ctx)
+	require.NoError(t, err)
+	require.NoError(t, pool.Release(ctx, testCase))
+	require.EqualError(t, pool.Release(ctx, testCase), "test case is not acquired from the pool")
+
+	foreign := projectEnv.NewTestCaseEnv()
+	require.NoError(t, foreign.Run())
+	require.EqualError(t, pool.Release(ctx, foreign), "test case is not acquired from the pool")
+	require.NoError(t, foreign.Close())
+
+	require.NoError(t, pool.Close())
+	require.Empty(t, backend.Containers())
+}
+
+func TestTestCaseEnvPoolCloseWhileStarting(t *testing.T) {
+	backend := fake.NewBackend()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	backend.RunContainerHook = func(params docker.RunContainerParams) error {
+		close(started)
+		<-release
+		return nil
+	}
+
+	projectEnv := testenv.NewProjectEnvWithBackend(poolProjectDesc(), backend)
+	require.NoError(t, projectEnv.Run())
+	defer func() {
+		require.NoError(t, projectEnv.Close())
+	}()
+
+	pool := projectEnv.NewTestCaseEnvPool(testenv.TestCaseEnvPoolOptions{Size: 1})
+	<-started
+	require.Len(t, backend.Networks(), 1)
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- pool.Close()
+	}()
+	require.Eventually(t, func() bool {
+		_, err := pool.Acquire(context.Background())
+		return err != nil && err.Error() == "pool is closed"
+	}, time.Second, time.Millisecond)
+	close(release)
+
+	require.NoError(t, <-closed)
+	require.Empty(t, backend.Containers())
+	require.Empty(t, backend.Networks())
+}
@@ -0,0 +1,135 @@
+package testenv
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type preflightContainer struct {
+	scope Scope
+	name  string
+	desc  ContainerDesc
+	image string
+	err   error
+}
+
+func (c *preflightContainer) String() string {
+	result := fmt.Sprintf("%s container %s", c.scope, c.name)
+	if c.image != "" {
+		result += " (" + c.image + ")"
+	}
+	return result
+}
+
+// preflightPulls makes sure every image is pulled once per pull policy.
+type preflightPulls struct {
+	mx    sync.Mutex
+	pulls map[string]*preflightPull
+}
+
+type preflightPull struct {
+	done chan struct{}
+	err  error
+}
+
+func (p *preflightPulls) pull(ctx context.Context, project *ProjectEnv, name, image string, policy PullPolicy) error {
+	key := image + "\x00" + policy.String()
+
+	p.mx.Lock()
+	pull, ok := p.pulls[key]
+	if !ok {
+		pull = &preflightPull{done: make(chan struct{})}
+		p.pulls[key] = pull
+	}
+	p.mx.Unlock()
+
+	if ok {
+		<-pull.done
+		return pull.err
+	}
+	pull.err = pullImage(ctx, project, nil, name, image, policy)
+	close(pull.done)
+	return pull.err
+}
+
+// Preflight resolves images of all project and test case containers before
+// anything is started. External images are pulled and images are built in
+// parallel, and if any of them is unavailable, the returned error lists all
+// failed containers. Image resolvers are called without a test case, so
+// images of test case containers must not depend on test case state or on
+// running containers.
+func (p *ProjectEnv) Preflight(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, p, nil, "testenv.ProjectEnv.Preflight")
+	defer func() { endSpan(span, err) }()
+
+	_, err = p.preflight(ctx)
+	return err
+}
+
+// preflight pulls and builds images of all containers and returns them.
+func (p *ProjectEnv) preflight(ctx context.Context) ([]string, error) {
+	var containers []*preflightContainer
+	for name, desc := range p.desc.Containers {
+		containers = append(containers, &preflightContainer{scope: ScopeProject, name: name, desc: desc})
+	}
+	for name, desc := range p.desc.TestCaseEnv.containers() {
+		containers = append(containers, &preflightContainer{scope: ScopeTestCase, name: name, desc: desc})
+	}
+	sort.Slice(containers, func(i, j int) bool {
+		if containers[i].scope != containers[j].scope {
+			return containers[i].scope == ScopeProject
+		}
+		return containers[i].name < containers[j].name
+	})
+
+	started := time.Now()
+	limit := newLimiter(p.desc.MaxParallelism)
+	pulls := &preflightPulls{pulls: map[string]*preflightPull{}}
+	wg := sync.WaitGroup{}
+	for _, container := range containers {
+		container := container
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := limit.acquire(ctx); err != nil {
+				container.err = err
+				return
+			}
+			defer limit.release()
+
+			container.image, container.err = container.desc.Image(ctx, p, nil)
+			if container.err != nil {
+				container.err = errors.Wrap(container.err, "failed to resolve image")
+				return
+			}
+			container.err = pulls.pull(ctx, p, container.name, container.image, container.desc.PullPolicy)
+		}()
+	}
+	wg.Wait()
+
+	var failed, images []string
+	seen := map[string]bool{}
+	for _, container := range containers {
+		if container.err != nil {
+			failed = append(failed, fmt.Sprintf("  %s: %v", container, container.err))
+		} else if !seen[container.image] {
+			seen[container.image] = true
+			images = append(images, container.image)
+		}
+	}
+	if len(failed) > 0 {
+		return nil, errors.Errorf("preflight failed for %d of %d containers:\n%s",
+			len(failed), len(containers), strings.Join(failed, "\n"))
+	}
+
+	p.logger.Info("Preflight finished", "containers", len(containers), "duration", time.Since(started))
+	sort.Strings(images)
+	return images, nil
+}
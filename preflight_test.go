@@ -0,0 +1,99 @@
+package testenv_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/saturn4er/go-testenv"
+	"github.com/saturn4er/go-testenv/docker"
+	"github.com/saturn4er/go-testenv/fake"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreflight(t *testing.T) {
+	backend := fake.NewBackend()
+	projectEnv := testenv.NewProjectEnvWithBackend(testenv.ProjectEnvDesc{
+		Networks: map[string]testenv.NetworkDesc{
+			"public": {},
+		},
+		Containers: map[string]testenv.ContainerDesc{
+			"postgres": {Image: testenv.ExternalImage("postgres:12")},
+			"replica":  {Image: testenv.ExternalImage("postgres:12")},
+			"app":      {Image: testenv.BuildImage(testenv.ImageDesc{ContextDir: "testdata/build"})},
+		},
+		TestCaseEnv: testenv.TestCaseEnvDesc{
+			Containers: map[string]*testenv.ContainerDesc{
+				"redis": {Image: testenv.ExternalImage("redis:5")},
+			},
+		},
+		Preflight: true,
+		Logger:    testenv.NopLogger(),
+	}, backend)
+	require.NoError(t, projectEnv.Run())
+	defer projectEnv.Close()
+
+	require.Equal(t, 2, backend.Pulls())
+	require.Equal(t, 1, backend.Builds())
+	require.Contains(t, backend.Images(), "redis:5")
+
+	testCase := projectEnv.NewTestCaseEnv()
+	require.NoError(t, testCase.Run())
+	require.NoError(t, testCase.Close())
+	require.Equal(t, 2, backend.Pulls())
+}
+
+func TestPreflightFailure(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.PullImageHook = func(params docker.PullImageParams) error {
+		if params.Image == "confluentinc/cp-kafka:5.5.O" || params.Image == "redis:typo" {
+			return errors.New("manifest unknown")
+		}
+		return nil
+	}
+
+	projectEnv := testenv.NewProjectEnvWithBackend(testenv.ProjectEnvDesc{
+		Networks: map[string]testenv.NetworkDesc{
+			"public": {},
+		},
+		Containers: map[string]testenv.ContainerDesc{
+			"kafka":    {Image: testenv.ExternalImage("confluentinc/cp-kafka:5.5.O")},
+			"postgres": {Image: testenv.ExternalImage("postgres:12")},
+		},
+		TestCaseEnv: testenv.TestCaseEnvDesc{
+			Containers: map[string]*testenv.ContainerDesc{
+				"redis": {Image: testenv.ExternalImage("redis:typo")},
+			},
+		},
+		Preflight: true,
+		Logger:    testenv.NopLogger(),
+	}, backend)
+
+	err := projectEnv.Run()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "preflight failed for 2 of 3 containers")
+	require.Contains(t, err.Error(), "project container kafka (confluentinc/cp-kafka:5.5.O): failed to pull image")
+	require.Contains(t, err.Error(), "test case container redis (redis:typo): failed to pull image")
+	require.NotContains(t, err.Error(), "postgres")
+	require.Empty(t, backend.Networks())
+	require.Empty(t, backend.Containers())
+	require.NoError(t, projectEnv.Close())
+}
+
+func TestPreflightNeverPolicy(t *testing.T) {
+	backend := fake.NewBackend()
+	projectEnv := testenv.NewProjectEnvWithBackend(testenv.ProjectEnvDesc{
+		Containers: map[string]testenv.ContainerDesc{
+			"app": {Image: testenv.ExternalImage("app:local"), PullPolicy: testenv.PullNever},
+		},
+		Logger: testenv.NopLogger(),
+	}, backend)
+
+	err := projectEnv.Preflight(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "project container app (app:local): image app:local is not present")
+
+	backend.AddImage("app:local")
+	require.NoError(t, projectEnv.Preflight(context.Background()))
+	require.Equal(t, 0, backend.Pulls())
+}
@@ -1,37 +1,141 @@
 package testenv
 
 import (
-	"log"
+	"context"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
 	"github.com/saturn4er/go-testenv/docker"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/multierr"
 )
 
+const detachedCloseTimeout = time.Minute
+
 type ProjectEnvDesc struct {
 	Networks    map[string]NetworkDesc
+	Volumes     map[string]VolumeDesc
 	Containers  map[string]ContainerDesc
 	TestCaseEnv TestCaseEnvDesc
+	// MaxParallelism limits the number of networks and containers created
+	// concurrently by ProjectEnv.Run and TestCaseEnv.Run. Zero means no limit.
+	MaxParallelism int
+	// Reuse keeps project networks, volumes and containers running after
+	// Close and reattaches to them in later runs. Every resource is matched
+	// by its own resolved description, so a changed container is replaced
+	// while the rest are reused. A changed network or volume replaces the
+	// project containers as well. Set $TESTENV_FRESH to remove resources left
+	// by previous runs of the project, identified by names of its networks,
+	// volumes and containers, and create them anew.
+	Reuse bool
+	// Preflight makes Run pull and build images of all project and test case
+	// containers in parallel before creating anything, see
+	// ProjectEnv.Preflight.
+	Preflight bool
+	// Offline forbids pulling images, as if every container had PullNever
+	// pull policy, and builds don't pull base images. Images must be present
+	// or loaded with LoadImageBundle, as well as helper images of the
+	// backend, e.g. of the reaper, which image bundles include. Also enabled
+	// by $TESTENV_OFFLINE.
+	Offline bool
+	// ArtifactsDir is a directory where logs of containers with CaptureLogs
+	// are written, in a subdirectory per ProjectEnv. Defaults to
+	// $TESTENV_ARTIFACTS_DIR or testenv-artifacts in the temporary directory.
+	ArtifactsDir string
+	// Logger receives diagnostic messages. Defaults to log.Printf, or to
+	// testing.TB.Logf for environments created by NewProjectEnvT.
+	Logger Logger
+	// TracerProvider creates spans of environment setup and teardown.
+	// Defaults to the global OpenTelemetry tracer provider.
+	TracerProvider trace.TracerProvider
+	// Observers are notified about lifecycle events of the project and its
+	// test cases.
+	Observers []Observer
 }
 
+// ProjectEnv is safe for concurrent use, test case environments may be
+// created, run and closed from parallel tests.
 type ProjectEnv struct {
-	client *docker.Client
+	client Backend
 	desc   ProjectEnvDesc
+	logger Logger
+	runID  string
+	logs   *logCapture
+	report *reportRecorder
 
+	// closeMx serializes Close calls, mx guards resources
+	closeMx           sync.Mutex
+	mx                sync.RWMutex
 	createdNetworks   map[string]*Network
-	builtImages       map[string]string
+	createdVolumes    map[string]*Volume
+	builtImages       map[string]bool
+	imageBuilds       map[interface{}]*imageBuild
+	pulledImages      map[string]struct{}
 	createdContainers map[string]*Container
+	startedContainers []*Container
+
+	// reuseMx serializes removal of reusable containers
+	reuseMx sync.Mutex
 
 	variablesMx sync.RWMutex
 	variables   map[string]interface{}
 }
 
 func (p *ProjectEnv) Run() error {
-	if err := p.createNetworks(); err != nil {
+	return p.RunContext(context.Background())
+}
+
+// RunContext creates networks and starts containers of the project. If ctx
+// is cancelled, everything created so far is removed before returning.
+func (p *ProjectEnv) RunContext(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, p, nil, "testenv.ProjectEnv.Run")
+	defer func() { endSpan(span, err) }()
+
+	if err := p.validate(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			err = multierr.Append(err, closeDetached(p.CloseContext))
+		}
+	}()
+
+	p.report.start()
+	defer p.report.finish()
+
+	if p.offline() {
+		if err := p.checkHelperImages(ctx); err != nil {
+			return err
+		}
+	}
+
+	if p.desc.Preflight {
+		if err := p.Preflight(ctx); err != nil {
+			return err
+		}
+	}
+
+	if p.reuse() && freshRequested() {
+		if err := p.removeReusable(ctx); err != nil {
+			return err
+		}
+	}
+
+	limit := newLimiter(p.desc.MaxParallelism)
+
+	if err := p.createNetworks(ctx, limit); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := p.createVolumes(ctx, limit); err != nil {
 		return errors.WithStack(err)
 	}
 
-	if err := p.runContainers(); err != nil {
+	if err := p.runContainers(ctx, limit); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -39,45 +143,100 @@ func (p *ProjectEnv) Run() error {
 }
 
 func (p *ProjectEnv) Close() error {
-	return errors.WithStack(p.client.Cleanup())
+	return p.CloseContext(context.Background())
+}
+
+func (p *ProjectEnv) CloseContext(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, p, nil, "testenv.ProjectEnv.Close")
+	defer func() { endSpan(span, err) }()
+
+	p.closeMx.Lock()
+	defer p.closeMx.Unlock()
+
+	started := time.Now()
+	emit(p, nil, Event{Type: EventCleanupStarted})
+
+	// observers may look containers up, so p.mx is not held while emitting
+	p.mx.Lock()
+	var containers []*Container
+	if !p.reuse() {
+		containers = p.startedContainers
+		p.startedContainers = nil
+	}
+	var untagImages []string
+	for image, untag := range p.builtImages {
+		if untag {
+			untagImages = append(untagImages, image)
+			delete(p.builtImages, image)
+		}
+	}
+	p.imageBuilds = map[interface{}]*imageBuild{}
+	p.mx.Unlock()
+
+	failed, err := removeContainers(ctx, p, nil, containers)
+	p.mx.Lock()
+	p.startedContainers = append(failed, p.startedContainers...)
+	p.mx.Unlock()
+	for _, image := range untagImages {
+		err = multierr.Append(err, errors.Wrapf(p.client.UntagImage(ctx, image), "failed to untag image %s", image))
+	}
+	if cleanupErr := p.client.Cleanup(ctx); cleanupErr != nil {
+		err = multierr.Append(err, cleanupErr)
+	}
+	p.logs.stop()
+
+	emit(p, nil, Event{Type: EventCleanupFinished, Duration: time.Since(started), Err: err})
+	return errors.WithStack(err)
 }
 
 func (p *ProjectEnv) NewTestCaseEnv() *TestCaseEnv {
 	return &TestCaseEnv{
 		projectEnv:        p,
+		logger:            p.logger,
+		id:                newRunID(),
+		logs:              newLogCapture(),
+		report:            &reportRecorder{},
 		createdNetworks:   map[string]*Network{},
+		createdVolumes:    map[string]*Volume{},
 		createdContainers: map[string]*Container{},
 		variables:         map[string]interface{}{},
 	}
 }
 
+// Report returns timings of the last Run.
+func (p *ProjectEnv) Report() *Report {
+	return p.report.build(ScopeProject, "")
+}
+
 func (p *ProjectEnv) Container(name string) (*Container, bool) {
+	p.mx.RLock()
 	container, ok := p.createdContainers[name]
+	p.mx.RUnlock()
 	return container, ok
 }
 func (p *ProjectEnv) MustContainer(name string) *Container {
-	container, ok := p.createdContainers[name]
+	container, ok := p.Container(name)
 	if !ok {
 		panic("no container with name " + name)
 	}
 	return container
 }
-func (p *ProjectEnv) FindFreeHostPort() (string, error) {
+func (p *ProjectEnv) FindFreeHostPort(ctx context.Context) (string, error) {
 	container, err := ContainerDesc{
 		Image:        ExternalImage("alpine:latest"),
 		ExposedPorts: []StringValueResolver{StringValue("9999")},
-	}.run(p, nil)
+	}.run(ctx, p, nil, "")
 	if err != nil {
 		return "", errors.Wrap(err, "failed to run temporary container")
 	}
 
 	defer func() {
-		if err := p.client.RemoveContainer(container.ID); err != nil {
-			log.Printf("Failed to remove temorary container(ID: %s)", container.ID)
+		if err := p.client.RemoveContainer(ctx, container.ID()); err != nil {
+			p.logger.Warn("Failed to remove temporary container", "id", container.ID(), "error", err)
 		}
 	}()
 
-	port, ok := (&Container{container: container}).HostPort("9999", PortTypeTCP)
+	port, ok := container.HostPort("9999", PortTypeTCP)
 	if !ok {
 		return "", errors.New("internal error")
 	}
@@ -98,36 +257,166 @@ func (p *ProjectEnv) Get(key string) interface{} {
 	return p.variables[key]
 }
 
-func (p *ProjectEnv) createNetworks() error {
-	for networkName, networkDesc := range p.desc.Networks {
-		log.Printf("Creating project network %s", networkName)
-		network, err := networkDesc.create(p, nil)
-		if err != nil {
-			return err
-		}
-		log.Printf("Created network %s (ID: %s)", networkName, network.ID)
+func (p *ProjectEnv) createNetworks(ctx context.Context, limit limiter) error {
+	return createNetworks(ctx, p, nil, p.desc.Networks, limit, func(network *Network) {
+		p.mx.Lock()
+		p.createdNetworks[network.Name] = network
+		p.mx.Unlock()
+	})
+}
+func (p *ProjectEnv) createVolumes(ctx context.Context, limit limiter) error {
+	return createVolumes(ctx, p, nil, p.desc.Volumes, limit, func(volume *Volume) {
+		p.mx.Lock()
+		p.createdVolumes[volume.Name] = volume
+		p.mx.Unlock()
+	})
+}
+func (p *ProjectEnv) runContainers(ctx context.Context, limit limiter) error {
+	return startContainers(ctx, p, nil, p.desc.Containers, nil, limit, func(name string, container *Container) {
+		p.mx.Lock()
+		p.createdContainers[name] = container
+		p.startedContainers = append(p.startedContainers, container)
+		p.mx.Unlock()
 
-		p.createdNetworks[networkName] = &Network{
-			ID:         network.ID,
-			Name:       networkName,
-			DockerName: network.Name,
+		if p.desc.Containers[name].CaptureLogs {
+			path := filepath.Join(p.artifactsDir(), "project", logFileName(name))
+			p.logs.capture(path, container, p.logger)
 		}
+	})
+}
+
+func (p *ProjectEnv) validate() error {
+	if _, err := sortContainers(p.desc.Containers, nil); err != nil {
+		return errors.Wrap(err, "invalid project containers")
+	}
+
+	if _, err := sortContainers(p.desc.TestCaseEnv.containers(), p.hasContainerDesc); err != nil {
+		return errors.Wrap(err, "invalid test case containers")
 	}
+
 	return nil
 }
-func (p *ProjectEnv) runContainers() error {
-	for containerName, containerDesc := range p.desc.Containers {
-		log.Printf("Creating project container %s", containerName)
-		container, err := containerDesc.run(p, nil)
-		if err != nil {
-			return errors.Wrapf(err, "failed to run container %s", containerName)
-		}
 
-		log.Printf("Created container %s (ID: %s)", containerName, container.ID)
-		p.createdContainers[containerName] = &Container{container: container}
+func (p *ProjectEnv) hasContainerDesc(name string) bool {
+	_, ok := p.desc.Containers[name]
+	return ok
+}
+
+func (p *ProjectEnv) artifactsDir() string {
+	return artifactsDir(p.desc, p.runID)
+}
+
+func (p *ProjectEnv) containers() map[string]*Container {
+	p.mx.RLock()
+	defer p.mx.RUnlock()
+
+	containers := make(map[string]*Container, len(p.createdContainers))
+	for name, container := range p.createdContainers {
+		containers[name] = container
 	}
+	return containers
+}
 
-	return nil
+func (p *ProjectEnv) network(name string) (*Network, bool) {
+	p.mx.RLock()
+	network, ok := p.createdNetworks[name]
+	p.mx.RUnlock()
+	return network, ok
+}
+
+func (p *ProjectEnv) volume(name string) (*Volume, bool) {
+	p.mx.RLock()
+	volume, ok := p.createdVolumes[name]
+	p.mx.RUnlock()
+	return volume, ok
+}
+
+// addBuiltImage records image built or reused by the project. Images with
+// untag are untagged on Close.
+func (p *ProjectEnv) addBuiltImage(image string, untag bool) {
+	p.mx.Lock()
+	p.builtImages[image] = p.builtImages[image] || untag
+	p.mx.Unlock()
+}
+
+// resolveImage returns the image built by build for key, building it if
+// it's not built yet. Failed builds are retried on the next call.
+func (p *ProjectEnv) resolveImage(key interface{}, build func() (string, error)) (string, error) {
+	p.mx.Lock()
+	resolved, ok := p.imageBuilds[key]
+	if !ok {
+		resolved = &imageBuild{}
+		p.imageBuilds[key] = resolved
+	}
+	p.mx.Unlock()
+
+	resolved.mx.Lock()
+	defer resolved.mx.Unlock()
+
+	if resolved.image != "" {
+		return resolved.image, nil
+	}
+	image, err := build()
+	if err != nil {
+		return "", err
+	}
+	resolved.image = image
+	return image, nil
+}
+
+func (p *ProjectEnv) addPulledImage(image string) {
+	p.mx.Lock()
+	p.pulledImages[image] = struct{}{}
+	p.mx.Unlock()
+}
+
+// isFreshImage reports whether image was built or pulled by the project.
+func (p *ProjectEnv) isFreshImage(image string) bool {
+	p.mx.RLock()
+	defer p.mx.RUnlock()
+
+	_, built := p.builtImages[image]
+	_, pulled := p.pulledImages[image]
+	return built || pulled
+}
+
+// removeContainers removes containers in reverse order and returns the ones
+// that failed to be removed.
+func removeContainers(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv, containers []*Container) ([]*Container, error) {
+	var (
+		err    error
+		failed []*Container
+	)
+	for i := len(containers) - 1; i >= 0; i-- {
+		container := containers[i]
+		started := time.Now()
+		removeErr := project.client.RemoveContainer(ctx, container.ID())
+		emit(project, testCase, Event{
+			Type:     EventContainerRemoved,
+			Name:     container.name,
+			ID:       container.ID(),
+			Duration: time.Since(started),
+			Err:      removeErr,
+		})
+		if removeErr != nil {
+			err = multierr.Append(err, removeErr)
+			failed = append([]*Container{container}, failed...)
+		}
+	}
+	return failed, err
+}
+
+// closeDetached calls closeFn with a context that is not bound to the
+// cancelled one, so resources can still be removed.
+func closeDetached(closeFn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), detachedCloseTimeout)
+	defer cancel()
+
+	return closeFn(ctx)
+}
+
+func newRunID() string {
+	return time.Now().Format("20060102-150405") + "-" + uuid.NewV4().String()[:8]
 }
 
 func NewProjectEnv(desc ProjectEnvDesc) (*ProjectEnv, error) {
@@ -136,13 +425,23 @@ func NewProjectEnv(desc ProjectEnvDesc) (*ProjectEnv, error) {
 		return nil, errors.WithStack(err)
 	}
 
+	return NewProjectEnvWithBackend(desc, dockerClient), nil
+}
+
+func NewProjectEnvWithBackend(desc ProjectEnvDesc, backend Backend) *ProjectEnv {
 	return &ProjectEnv{
-		client:            dockerClient,
+		client:            backend,
 		desc:              desc,
+		logger:            defaultLogger(desc),
+		runID:             newRunID(),
+		logs:              newLogCapture(),
+		report:            &reportRecorder{},
 		variables:         map[string]interface{}{},
 		createdNetworks:   map[string]*Network{},
-		builtImages:       map[string]string{},
+		createdVolumes:    map[string]*Volume{},
+		builtImages:       map[string]bool{},
+		imageBuilds:       map[interface{}]*imageBuild{},
+		pulledImages:      map[string]struct{}{},
 		createdContainers: map[string]*Container{},
-	}, nil
-
+	}
 }
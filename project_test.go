@@ -0,0 +1,174 @@
+package testenv_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/saturn4er/go-testenv"
+	"github.com/saturn4er/go-testenv/docker"
+	"github.com/saturn4er/go-testenv/fake"
+	"github.com/stretchr/testify/require"
+)
+
+var _ testenv.Backend = (*fake.Backend)(nil)
+
+func TestProjectEnvRun(t *testing.T) {
+	backend := fake.NewBackend()
+
+	var started []string
+	backend.RunContainerHook = func(params docker.RunContainerParams) error {
+		started = append(started, params.Image)
+		return nil
+	}
+
+	projectEnv := testenv.NewProjectEnvWithBackend(testenv.ProjectEnvDesc{
+		Networks: map[string]testenv.NetworkDesc{
+			"public": {
+				Labels: testenv.StringsMap{"env": testenv.StringValue("test")},
+			},
+		},
+		Containers: map[string]testenv.ContainerDesc{
+			"kafka": {
+				Image:        testenv.ExternalImage("kafka"),
+				ExposedPorts: []testenv.StringValueResolver{testenv.StringValue("9092")},
+				DependsOn:    []string{"zookeeper"},
+				Networks: []testenv.ContainerNetwork{
+					{Network: testenv.ProjectNetwork("public"), Alias: "kafka"},
+				},
+			},
+			"zookeeper": {
+				Image: testenv.ExternalImage("zookeeper"),
+				Labels: map[string]testenv.StringValueResolver{
+					"env": testenv.StringValue("test"),
+				},
+				Networks: []testenv.ContainerNetwork{
+					{Network: testenv.ProjectNetwork("public"), Alias: "zookeeper"},
+				},
+			},
+		},
+		MaxParallelism: 1,
+	}, backend)
+
+	require.NoError(t, projectEnv.Run())
+	require.Equal(t, []string{"zookeeper", "kafka"}, started)
+
+	require.Len(t, backend.Networks(), 1)
+	require.Equal(t, map[string]string{"env": "test"}, backend.Networks()[0].Labels)
+
+	zookeeper := projectEnv.MustContainer("zookeeper")
+	zookeeperInfo, err := backend.InspectContainer(context.Background(), zookeeper.ID())
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"env": "test"}, zookeeperInfo.Labels)
+
+	kafka := projectEnv.MustContainer("kafka")
+	_, ok := kafka.HostPort("9092", testenv.PortTypeTCP)
+	require.True(t, ok)
+	kafkaParams, ok := backend.ContainerParams(kafka.ID())
+	require.True(t, ok)
+	require.Equal(t, map[string]docker.RunContainerNetworkConfig{
+		backend.Networks()[0].ID: {Aliases: []string{"kafka"}},
+	}, kafkaParams.Networks)
+
+	require.NoError(t, projectEnv.Close())
+	require.Empty(t, backend.Containers())
+	require.Empty(t, backend.Networks())
+}
+
+func TestProjectEnvRunFailsOnUnhealthyContainer(t *testing.T) {
+	backend := fake.NewBackend()
+
+	healthCheck := testenv.HealthCheck(func(ctx context.Context) (bool, error) {
+		return false, nil
+	})
+	projectEnv := testenv.NewProjectEnvWithBackend(testenv.ProjectEnvDesc{
+		Containers: map[string]testenv.ContainerDesc{
+			"postgres": {
+				Image:       testenv.ExternalImage("postgres"),
+				HealthCheck: &healthCheck,
+				HealthCheckOptions: testenv.HealthCheckOptions{
+					Interval: time.Millisecond,
+					Timeout:  20 * time.Millisecond,
+				},
+				Hooks: testenv.ContainerHooks{
+					AfterRun: func(ctx context.Context, project *testenv.ProjectEnv, testCase *testenv.TestCaseEnv) error {
+						t.Fatal("AfterRun hook must not be called for unhealthy container")
+						return nil
+					},
+				},
+			},
+		},
+	}, backend)
+	defer func() {
+		require.NoError(t, projectEnv.Close())
+	}()
+
+	err := projectEnv.Run()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "container is not healthy after 20ms")
+	require.Contains(t, err.Error(), "state: running")
+}
+
+func TestProjectEnvRunContextRemovesResourcesOnCancel(t *testing.T) {
+	backend := fake.NewBackend()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	healthCheck := testenv.HealthCheck(func(ctx context.Context) (bool, error) {
+		cancel()
+		return false, nil
+	})
+	projectEnv := testenv.NewProjectEnvWithBackend(testenv.ProjectEnvDesc{
+		Networks: map[string]testenv.NetworkDesc{
+			"public": {},
+		},
+		Containers: map[string]testenv.ContainerDesc{
+			"zookeeper": {
+				Image: testenv.ExternalImage("zookeeper"),
+			},
+			"kafka": {
+				Image:       testenv.ExternalImage("kafka"),
+				HealthCheck: &healthCheck,
+				DependsOn:   []string{"zookeeper"},
+				Networks: []testenv.ContainerNetwork{
+					{Network: testenv.ProjectNetwork("public")},
+				},
+			},
+		},
+	}, backend)
+
+	err := projectEnv.RunContext(ctx)
+	require.Error(t, err)
+	require.Equal(t, context.Canceled, errors.Cause(err))
+	require.Empty(t, backend.Containers())
+	require.Empty(t, backend.Networks())
+}
+
+func TestNewProjectEnvWithBackendT(t *testing.T) {
+	backend := fake.NewBackend()
+	desc := testenv.ProjectEnvDesc{
+		Containers: map[string]testenv.ContainerDesc{
+			"zookeeper": {
+				Image: testenv.ExternalImage("zookeeper"),
+			},
+		},
+		TestCaseEnv: testenv.TestCaseEnvDesc{
+			Containers: map[string]*testenv.ContainerDesc{
+				"postgres": {
+					Image: testenv.ExternalImage("postgres"),
+				},
+			},
+		},
+	}
+
+	t.Run("env", func(t *testing.T) {
+		projectEnv := testenv.NewProjectEnvWithBackendT(t, desc, backend)
+		projectEnv.NewTestCaseEnvT(t)
+
+		require.Len(t, backend.Containers(), 2)
+	})
+
+	require.Empty(t, backend.Containers())
+}
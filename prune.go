@@ -0,0 +1,29 @@
+package testenv
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/saturn4er/go-testenv/docker"
+)
+
+// Prune removes containers, networks, volumes and built images left by test
+// sessions started more than olderThan ago, e.g. by killed test binaries.
+func Prune(olderThan time.Duration) error {
+	return PruneContext(context.Background(), olderThan)
+}
+
+func PruneContext(ctx context.Context, olderThan time.Duration) error {
+	client, err := docker.NewClient()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return PruneWithBackend(ctx, client, olderThan)
+}
+
+// PruneWithBackend is PruneContext removing resources of the backend.
+func PruneWithBackend(ctx context.Context, backend Backend, olderThan time.Duration) error {
+	return errors.WithStack(backend.Prune(ctx, olderThan))
+}
@@ -0,0 +1,59 @@
+package testenv_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/saturn4er/go-testenv"
+	"github.com/saturn4er/go-testenv/fake"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPruneWithBackend(t *testing.T) {
+	backend := fake.NewBackend()
+	killed := backend.NewSession()
+
+	staleEnv := testenv.NewProjectEnvWithBackend(testenv.ProjectEnvDesc{
+		Networks: map[string]testenv.NetworkDesc{
+			"public": {},
+		},
+		Containers: map[string]testenv.ContainerDesc{
+			"postgres": {
+				Image:    testenv.ExternalImage("postgres"),
+				Networks: []testenv.ContainerNetwork{{Network: testenv.ProjectNetwork("public")}},
+			},
+		},
+	}, killed)
+	require.NoError(t, staleEnv.Run())
+	reusedEnv := testenv.NewProjectEnvWithBackend(testenv.ProjectEnvDesc{
+		Containers: map[string]testenv.ContainerDesc{
+			"zookeeper": {Image: testenv.ExternalImage("zookeeper")},
+		},
+		Reuse: true,
+	}, killed)
+	require.NoError(t, reusedEnv.Run())
+
+	projectEnv := testenv.NewProjectEnvWithBackend(testenv.ProjectEnvDesc{
+		Containers: map[string]testenv.ContainerDesc{
+			"redis": {Image: testenv.ExternalImage("redis")},
+		},
+	}, backend)
+	require.NoError(t, projectEnv.Run())
+	defer projectEnv.Close()
+
+	require.NoError(t, testenv.PruneWithBackend(context.Background(), backend, time.Hour))
+	require.Len(t, backend.Containers(), 3)
+	require.Len(t, backend.Networks(), 1)
+
+	require.NoError(t, testenv.PruneWithBackend(context.Background(), backend, 0))
+	var ids []string
+	for _, container := range backend.Containers() {
+		ids = append(ids, container.ID)
+	}
+	require.ElementsMatch(t, []string{
+		reusedEnv.MustContainer("zookeeper").ID(),
+		projectEnv.MustContainer("redis").ID(),
+	}, ids)
+	require.Empty(t, backend.Networks())
+}
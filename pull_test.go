@@ -0,0 +1,81 @@
+package testenv_test
+
+import (
+	"testing"
+
+	"github.com/saturn4er/go-testenv"
+	"github.com/saturn4er/go-testenv/docker"
+	"github.com/saturn4er/go-testenv/fake"
+	"github.com/stretchr/testify/require"
+)
+
+func runWithPullPolicy(backend *fake.Backend, image testenv.ImageResolver, policy testenv.PullPolicy, observers ...testenv.Observer) error {
+	projectEnv := testenv.NewProjectEnvWithBackend(testenv.ProjectEnvDesc{
+		Containers: map[string]testenv.ContainerDesc{
+			"app": {Image: image, PullPolicy: policy},
+		},
+		Logger:    testenv.NopLogger(),
+		Observers: observers,
+	}, backend)
+	err := projectEnv.Run()
+	if closeErr := projectEnv.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func TestPullPolicy(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.AddImage("localhost:5000/app:1")
+
+	image := testenv.ExternalImage("localhost:5000/app:1")
+	require.NoError(t, runWithPullPolicy(backend, image, testenv.PullIfNotPresent))
+	require.NoError(t, runWithPullPolicy(backend, image, testenv.PullNever))
+	require.Equal(t, 0, backend.Pulls())
+
+	require.NoError(t, runWithPullPolicy(backend, image, testenv.PullAlways))
+	require.Equal(t, 1, backend.Pulls())
+
+	err := runWithPullPolicy(backend, testenv.ExternalImage("alpine"), testenv.PullNever)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "image alpine is not present and pull policy is never")
+
+	require.NoError(t, runWithPullPolicy(backend, testenv.ExternalImage("alpine"), testenv.PullIfNotPresent))
+	require.Equal(t, 2, backend.Pulls())
+
+	built := testenv.BuildImage(testenv.ImageDesc{ContextDir: "testdata/build"})
+	require.NoError(t, runWithPullPolicy(backend, built, testenv.PullAlways))
+	require.Equal(t, 2, backend.Pulls())
+}
+
+func TestPullInvalidImage(t *testing.T) {
+	err := runWithPullPolicy(fake.NewBackend(), testenv.ExternalImage("Alpine:3.10"), testenv.PullIfNotPresent)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid image Alpine:3.10")
+}
+
+func TestPullProgressEvents(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.PullImageHook = func(params docker.PullImageParams) error {
+		for _, progress := range []docker.PullProgress{
+			{Layer: "a1", Status: "Pulling fs layer"},
+			{Layer: "a1", Status: "Downloading", Current: 10, Total: 100},
+			{Layer: "a1", Status: "Downloading", Current: 20, Total: 100},
+			{Layer: "b2", Status: "Pulling fs layer"},
+			{Layer: "a1", Status: "Pull complete"},
+		} {
+			params.Progress(progress)
+		}
+		return nil
+	}
+
+	recorder := &eventRecorder{}
+	require.NoError(t, runWithPullPolicy(backend, testenv.ExternalImage("postgres:12"), testenv.PullIfNotPresent, recorder.observe))
+
+	var statuses []string
+	for _, event := range recorder.find(testenv.EventImagePullProgress, "app") {
+		require.Equal(t, "postgres:12", event.Image)
+		statuses = append(statuses, event.ID+" "+event.Status)
+	}
+	require.Equal(t, []string{"a1 Pulling fs layer", "a1 Downloading", "b2 Pulling fs layer", "a1 Pull complete"}, statuses)
+}
@@ -0,0 +1,188 @@
+package testenv_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/saturn4er/go-testenv"
+	"github.com/saturn4er/go-testenv/fake"
+	"github.com/stretchr/testify/require"
+)
+
+func parallelProjectDesc() testenv.ProjectEnvDesc {
+	return testenv.ProjectEnvDesc{
+		Networks: map[string]testenv.NetworkDesc{
+			"public": {},
+		},
+		Containers: map[string]testenv.ContainerDesc{
+			"zookeeper": {
+				Image: testenv.ExternalImage("zookeeper"),
+			},
+			"kafka": {
+				Image:     testenv.BuildImage(testenv.ImageDesc{Dockerfile: "Dockerfile", ContextDir: "testdata/build"}),
+				DependsOn: []string{"zookeeper"},
+				Networks: []testenv.ContainerNetwork{
+					{Network: testenv.ProjectNetwork("public"), Alias: "kafka"},
+				},
+			},
+		},
+		TestCaseEnv: testenv.TestCaseEnvDesc{
+			Networks: map[string]testenv.NetworkDesc{
+				"private": {},
+			},
+			Containers: map[string]*testenv.ContainerDesc{
+				"postgres": {
+					Image: testenv.ExternalImage("postgres"),
+					Networks: []testenv.ContainerNetwork{
+						{Network: testenv.TestCaseNetwork("private")},
+						{Network: testenv.ProjectNetwork("public")},
+					},
+				},
+				"app": {
+					Image:     testenv.ExternalImage("app"),
+					DependsOn: []string{"postgres", "kafka"},
+				},
+			},
+			Hooks: testenv.TestCaseHooks{
+				AfterRun: func(ctx context.Context, project *testenv.ProjectEnv, testCase *testenv.TestCaseEnv) error {
+					testCase.Set("ready", true)
+					project.Set("last", testCase.Get("ready"))
+					return nil
+				},
+			},
+		},
+		Logger:    testenv.NopLogger(),
+		Observers: []testenv.Observer{func(testenv.Event) {}},
+	}
+}
+
+func TestParallelTestCaseEnvs(t *testing.T) {
+	backend := fake.NewBackend()
+
+	t.Run("group", func(t *testing.T) {
+		projectEnv := testenv.NewProjectEnvWithBackendT(t, parallelProjectDesc(), backend)
+
+		for i := 0; i < 16; i++ {
+			t.Run(fmt.Sprintf("case-%d", i), func(t *testing.T) {
+				t.Parallel()
+
+				testCaseEnv := projectEnv.NewTestCaseEnvT(t)
+				_, ok := testCaseEnv.Container("app")
+				require.True(t, ok)
+				require.Equal(t, true, testCaseEnv.Get("ready"))
+
+				require.NotEmpty(t, projectEnv.MustContainer("kafka").ID())
+				require.Equal(t, true, projectEnv.Get("last"))
+				require.NotNil(t, projectEnv.Report())
+				require.Len(t, testCaseEnv.Report().Containers, 2)
+			})
+		}
+	})
+
+	require.Empty(t, backend.Containers())
+	require.Empty(t, backend.Networks())
+}
+
+func TestConcurrentTestCaseEnvRunAndClose(t *testing.T) {
+	backend := fake.NewBackend()
+	projectEnv := testenv.NewProjectEnvWithBackend(parallelProjectDesc(), backend)
+	require.NoError(t, projectEnv.Run())
+
+	const testCases = 16
+	errs := make(chan error, 2*testCases)
+
+	var wg sync.WaitGroup
+	for i := 0; i < testCases; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+
+			testCaseEnv := projectEnv.NewTestCaseEnv()
+			errs <- testCaseEnv.Run()
+			errs <- testCaseEnv.Close()
+		}()
+		go func() {
+			defer wg.Done()
+
+			_, _ = projectEnv.Container("zookeeper")
+			_ = projectEnv.Report().String()
+			projectEnv.Set("reader", true)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.Len(t, backend.Containers(), 2)
+
+	require.NoError(t, projectEnv.Close())
+	require.Empty(t, backend.Containers())
+	require.Empty(t, backend.Networks())
+}
+
+func TestCloseWithObserversLookingUpContainers(t *testing.T) {
+	backend := fake.NewBackend()
+
+	var (
+		projectEnv  *testenv.ProjectEnv
+		testCaseEnv *testenv.TestCaseEnv
+		lookups     int32
+		lookupsMx   sync.Mutex
+	)
+	desc := parallelProjectDesc()
+	desc.Observers = []testenv.Observer{func(event testenv.Event) {
+		if event.Type != testenv.EventContainerRemoved && event.Type != testenv.EventCleanupFinished {
+			return
+		}
+		lookupsMx.Lock()
+		defer lookupsMx.Unlock()
+
+		if event.Scope == testenv.ScopeTestCase {
+			_, _ = testCaseEnv.Container("app")
+		}
+		projectEnv.MustContainer("zookeeper")
+		lookups++
+	}}
+	projectEnv = testenv.NewProjectEnvWithBackend(desc, backend)
+	require.NoError(t, projectEnv.Run())
+	testCaseEnv = projectEnv.NewTestCaseEnv()
+	require.NoError(t, testCaseEnv.Run())
+
+	closeConcurrently := func(closer interface{ Close() error }) {
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				require.NoError(t, closer.Close())
+			}()
+			go func() {
+				defer wg.Done()
+				_, _ = testCaseEnv.Container("postgres")
+				_, _ = projectEnv.Container("kafka")
+			}()
+		}
+		wg.Wait()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		closeConcurrently(testCaseEnv)
+		closeConcurrently(projectEnv)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Close deadlocked")
+	}
+	require.Empty(t, backend.Containers())
+	require.Empty(t, backend.Networks())
+	require.EqualValues(t, 12, lookups)
+}
@@ -0,0 +1,275 @@
+package testenv
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Report contains timings of ProjectEnv.Run or TestCaseEnv.Run. Durations
+// are encoded to JSON in nanoseconds.
+type Report struct {
+	Scope      Scope             `json:"scope"`
+	TestCase   string            `json:"testCase,omitempty"`
+	StartedAt  time.Time         `json:"startedAt"`
+	Duration   time.Duration     `json:"duration"`
+	Networks   []ResourceTiming  `json:"networks,omitempty"`
+	Volumes    []ResourceTiming  `json:"volumes,omitempty"`
+	Containers []ContainerTiming `json:"containers,omitempty"`
+	Hooks      []HookTiming      `json:"hooks,omitempty"`
+}
+
+type ResourceTiming struct {
+	Name   string        `json:"name"`
+	ID     string        `json:"id"`
+	Create time.Duration `json:"create"`
+}
+
+// ContainerTiming splits startup of a container into phases. Offset is the
+// time from the beginning of Run to the beginning of container startup,
+// Total is the time from the beginning to the end of its startup including
+// gaps between phases. ResolveImage includes Build.
+type ContainerTiming struct {
+	Name         string        `json:"name"`
+	ID           string        `json:"id"`
+	Image        string        `json:"image"`
+	Offset       time.Duration `json:"offset"`
+	BeforeRun    time.Duration `json:"beforeRun,omitempty"`
+	ResolveImage time.Duration `json:"resolveImage"`
+	Build        time.Duration `json:"build,omitempty"`
+	Pull         time.Duration `json:"pull,omitempty"`
+	Start        time.Duration `json:"start"`
+	Healthy      time.Duration `json:"healthy"`
+	AfterRun     time.Duration `json:"afterRun,omitempty"`
+	Total        time.Duration `json:"total"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// HookTiming is the duration of a test case hook.
+type HookTiming struct {
+	Hook     string        `json:"hook"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Slowest returns at most n containers with the longest startup.
+func (r *Report) Slowest(n int) []ContainerTiming {
+	containers := append([]ContainerTiming(nil), r.Containers...)
+	sort.SliceStable(containers, func(i, j int) bool {
+		return containers[i].Total > containers[j].Total
+	})
+	if n < len(containers) {
+		containers = containers[:n]
+	}
+	return containers
+}
+
+// WriteJSON writes indented JSON representation of the report to w.
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return errors.WithStack(encoder.Encode(r))
+}
+
+// WriteTable writes the report to w as a human-readable table.
+func (r *Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	title := string(r.Scope)
+	if r.TestCase != "" {
+		title += " " + r.TestCase
+	}
+	fmt.Fprintf(tw, "%s started in %s\n", title, formatDuration(r.Duration))
+
+	if len(r.Networks) > 0 || len(r.Volumes) > 0 {
+		fmt.Fprintln(tw, "\nRESOURCE\tNAME\tID\tCREATE")
+		for _, network := range r.Networks {
+			fmt.Fprintf(tw, "network\t%s\t%s\t%s\n", network.Name, network.ID, formatDuration(network.Create))
+		}
+		for _, volume := range r.Volumes {
+			fmt.Fprintf(tw, "volume\t%s\t%s\t%s\n", volume.Name, volume.ID, formatDuration(volume.Create))
+		}
+	}
+
+	if len(r.Containers) > 0 {
+		fmt.Fprintln(tw, "\nCONTAINER\tIMAGE\tOFFSET\tBEFORE RUN\tRESOLVE\tBUILD\tPULL\tSTART\tHEALTHY\tAFTER RUN\tTOTAL")
+		for _, c := range r.Containers {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				c.Name, c.Image, formatDuration(c.Offset), formatDuration(c.BeforeRun),
+				formatDuration(c.ResolveImage), formatDuration(c.Build), formatDuration(c.Pull),
+				formatDuration(c.Start), formatDuration(c.Healthy), formatDuration(c.AfterRun),
+				formatDuration(c.Total))
+		}
+	}
+
+	if len(r.Hooks) > 0 {
+		fmt.Fprintln(tw, "\nHOOK\tDURATION")
+		for _, hook := range r.Hooks {
+			fmt.Fprintf(tw, "%s\t%s\n", hook.Hook, formatDuration(hook.Duration))
+		}
+	}
+
+	return errors.WithStack(tw.Flush())
+}
+
+func (r *Report) String() string {
+	result := &strings.Builder{}
+	_ = r.WriteTable(result)
+	return result.String()
+}
+
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	if d < time.Millisecond {
+		return d.String()
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+// reportRecorder collects events of the current Run.
+type reportRecorder struct {
+	mx       sync.Mutex
+	started  time.Time
+	finished time.Time
+	events   []Event
+}
+
+func (r *reportRecorder) start() {
+	r.mx.Lock()
+	r.started = time.Now()
+	r.finished = time.Time{}
+	r.events = nil
+	r.mx.Unlock()
+}
+
+func (r *reportRecorder) finish() {
+	r.mx.Lock()
+	r.finished = time.Now()
+	r.mx.Unlock()
+}
+
+func (r *reportRecorder) add(event Event) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if !r.started.IsZero() && r.finished.IsZero() {
+		r.events = append(r.events, event)
+	}
+}
+
+func (r *reportRecorder) build(scope Scope, testCase string) *Report {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	report := &Report{
+		Scope:     scope,
+		TestCase:  testCase,
+		StartedAt: r.started,
+	}
+	if !r.finished.IsZero() {
+		report.Duration = r.finished.Sub(r.started)
+	} else if !r.started.IsZero() {
+		report.Duration = time.Since(r.started)
+	}
+
+	builds := map[string]time.Duration{}
+	for _, event := range r.events {
+		if event.Type == EventImageBuildFinished && event.Image != "" {
+			builds[event.Image] = event.Duration
+		}
+	}
+
+	containers := map[string]*ContainerTiming{}
+	bounds := map[string][2]time.Time{}
+	container := func(event Event) *ContainerTiming {
+		timing, ok := containers[event.Name]
+		if !ok {
+			timing = &ContainerTiming{Name: event.Name}
+			containers[event.Name] = timing
+		}
+
+		begin, end := event.Time.Add(-event.Duration), event.Time
+		b, ok := bounds[event.Name]
+		if !ok || begin.Before(b[0]) {
+			b[0] = begin
+		}
+		if end.After(b[1]) {
+			b[1] = end
+		}
+		bounds[event.Name] = b
+
+		if event.Err != nil && timing.Error == "" {
+			timing.Error = event.Err.Error()
+		}
+		return timing
+	}
+
+	for _, event := range r.events {
+		switch event.Type {
+		case EventNetworkCreated:
+			report.Networks = append(report.Networks, ResourceTiming{Name: event.Name, ID: event.ID, Create: event.Duration})
+		case EventVolumeCreated:
+			report.Volumes = append(report.Volumes, ResourceTiming{Name: event.Name, ID: event.ID, Create: event.Duration})
+		case EventHookFinished:
+			if event.Name == "" {
+				report.Hooks = append(report.Hooks, HookTiming{Hook: event.Hook, Duration: event.Duration})
+				continue
+			}
+			timing := container(event)
+			if event.Hook == "BeforeRun" {
+				timing.BeforeRun = event.Duration
+			} else {
+				timing.AfterRun = event.Duration
+			}
+		case EventImageResolved:
+			if event.Name != "" {
+				timing := container(event)
+				timing.Image = event.Image
+				timing.ResolveImage = event.Duration
+				timing.Build = builds[event.Image]
+			}
+		case EventImagePullFinished:
+			if event.Name != "" {
+				container(event).Pull = event.Duration
+			}
+		case EventContainerStarted:
+			if event.Name != "" {
+				timing := container(event)
+				timing.ID = event.ID
+				timing.Start = event.Duration
+			}
+		case EventContainerHealthy:
+			if event.Name != "" {
+				container(event).Healthy = event.Duration
+			}
+		}
+	}
+
+	for name, timing := range containers {
+		b := bounds[name]
+		timing.Offset = b[0].Sub(r.started)
+		if timing.Offset < 0 {
+			timing.Offset = 0
+		}
+		timing.Total = b[1].Sub(b[0])
+		report.Containers = append(report.Containers, *timing)
+	}
+	sort.Slice(report.Containers, func(i, j int) bool {
+		if report.Containers[i].Offset != report.Containers[j].Offset {
+			return report.Containers[i].Offset < report.Containers[j].Offset
+		}
+		return report.Containers[i].Name < report.Containers[j].Name
+	})
+	sort.Slice(report.Networks, func(i, j int) bool { return report.Networks[i].Name < report.Networks[j].Name })
+	sort.Slice(report.Volumes, func(i, j int) bool { return report.Volumes[i].Name < report.Volumes[j].Name })
+
+	return report
+}
@@ -0,0 +1,88 @@
+package testenv_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/saturn4er/go-testenv"
+	"github.com/saturn4er/go-testenv/fake"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectEnvReport(t *testing.T) {
+	backend := fake.NewBackend()
+
+	sleep := func(ctx context.Context, project *testenv.ProjectEnv, testCase *testenv.TestCaseEnv) error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}
+	projectEnv := testenv.NewProjectEnvWithBackend(testenv.ProjectEnvDesc{
+		Networks: map[string]testenv.NetworkDesc{
+			"public": {},
+		},
+		Containers: map[string]testenv.ContainerDesc{
+			"zookeeper": {
+				Image: testenv.ExternalImage("zookeeper"),
+			},
+			"kafka": {
+				Image:     testenv.BuildImage(testenv.ImageDesc{Dockerfile: "Dockerfile", ContextDir: "testdata/build"}),
+				DependsOn: []string{"zookeeper"},
+				Hooks: testenv.ContainerHooks{
+					AfterRun: sleep,
+				},
+			},
+		},
+		TestCaseEnv: testenv.TestCaseEnvDesc{
+			Hooks: testenv.TestCaseHooks{
+				BeforeRun: sleep,
+			},
+		},
+		Logger: testenv.NopLogger(),
+	}, backend)
+	defer func() {
+		require.NoError(t, projectEnv.Close())
+	}()
+	require.NoError(t, projectEnv.Run())
+
+	report := projectEnv.Report()
+	require.Equal(t, testenv.ScopeProject, report.Scope)
+	require.Len(t, report.Networks, 1)
+	require.Equal(t, "public", report.Networks[0].Name)
+
+	require.Len(t, report.Containers, 2)
+	zookeeper, kafka := report.Containers[0], report.Containers[1]
+	require.Equal(t, "zookeeper", zookeeper.Name)
+	require.Equal(t, projectEnv.MustContainer("zookeeper").ID(), zookeeper.ID)
+	require.NotZero(t, zookeeper.Pull)
+	require.Equal(t, "kafka", kafka.Name)
+	require.NotZero(t, kafka.Build)
+	require.Zero(t, kafka.Pull)
+	require.True(t, kafka.AfterRun >= 20*time.Millisecond)
+	require.True(t, kafka.Total >= kafka.AfterRun)
+	require.True(t, kafka.Offset >= zookeeper.Offset)
+	require.Equal(t, "kafka", report.Slowest(1)[0].Name)
+	require.True(t, report.Duration >= kafka.Total)
+
+	require.Contains(t, report.String(), "CONTAINER")
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, report.WriteJSON(buf))
+	var decoded testenv.Report
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	require.Equal(t, report.Containers, decoded.Containers)
+
+	testCaseEnv := projectEnv.NewTestCaseEnv()
+	require.NoError(t, testCaseEnv.Run())
+	defer func() {
+		require.NoError(t, testCaseEnv.Close())
+	}()
+
+	testCaseReport := testCaseEnv.Report()
+	require.Equal(t, testenv.ScopeTestCase, testCaseReport.Scope)
+	require.Len(t, testCaseReport.Hooks, 1)
+	require.Equal(t, "BeforeRun", testCaseReport.Hooks[0].Hook)
+	require.True(t, testCaseReport.Hooks[0].Duration >= 20*time.Millisecond)
+}
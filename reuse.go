@@ -0,0 +1,255 @@
+package testenv
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/saturn4er/go-testenv/docker"
+)
+
+const (
+	freshEnv          = "TESTENV_FRESH"
+	reuseLabel        = "testenv.reuse"
+	reuseNameLabel    = "testenv.reuse.name"
+	reuseProjectLabel = "testenv.reuse.project"
+)
+
+func (p *ProjectEnv) reuse() bool {
+	return p.desc.Reuse
+}
+
+// freshRequested reports whether $TESTENV_FRESH asks to replace resources
+// and images left by previous runs.
+func freshRequested() bool {
+	fresh, _ := strconv.ParseBool(os.Getenv(freshEnv))
+	return fresh
+}
+
+// reuseProjectID identifies reusable resources of the project by names of its
+// networks, volumes and containers.
+func (p *ProjectEnv) reuseProjectID() string {
+	var names []string
+	for name := range p.desc.Networks {
+		names = append(names, "network\x00"+name)
+	}
+	for name := range p.desc.Volumes {
+		names = append(names, "volume\x00"+name)
+	}
+	for name := range p.desc.Containers {
+		names = append(names, "container\x00"+name)
+	}
+	sort.Strings(names)
+
+	hash := sha256.Sum256([]byte(strings.Join(names, "\x00")))
+	return hex.EncodeToString(hash[:])
+}
+
+// reuseLabels returns labels of the reusable resource name created from
+// params with the hash.
+func (p *ProjectEnv) reuseLabels(labels map[string]string, name, hash string) map[string]string {
+	labels = withLabel(labels, reuseLabel, hash)
+	labels = withLabel(labels, reuseNameLabel, name)
+	return withLabel(labels, reuseProjectLabel, p.reuseProjectID())
+}
+
+// reuseNameLabels select reusable resources named name of the project.
+func (p *ProjectEnv) reuseNameLabels(name string) map[string]string {
+	return map[string]string{reuseProjectLabel: p.reuseProjectID(), reuseNameLabel: name}
+}
+
+// removeReusable removes containers, networks and volumes left by previous
+// runs of the project.
+func (p *ProjectEnv) removeReusable(ctx context.Context) error {
+	if err := p.removeReusableContainers(ctx); err != nil {
+		return err
+	}
+
+	labels := map[string]string{reuseProjectLabel: p.reuseProjectID()}
+	networks, err := p.client.FindNetworks(ctx, labels)
+	if err != nil {
+		return errors.Wrap(err, "failed to find reusable networks")
+	}
+	for _, network := range networks {
+		if err := p.removeReusableNetwork(ctx, network); err != nil {
+			return err
+		}
+	}
+
+	volumes, err := p.client.FindVolumes(ctx, labels)
+	if err != nil {
+		return errors.Wrap(err, "failed to find reusable volumes")
+	}
+	for _, volume := range volumes {
+		if err := p.removeReusableVolume(ctx, volume); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeReusableContainers removes reusable containers of the project, e.g.
+// before a network or volume they may use is replaced.
+func (p *ProjectEnv) removeReusableContainers(ctx context.Context) error {
+	p.reuseMx.Lock()
+	defer p.reuseMx.Unlock()
+
+	containers, err := p.client.FindContainers(ctx, map[string]string{reuseProjectLabel: p.reuseProjectID()})
+	if err != nil {
+		return errors.Wrap(err, "failed to find reusable containers")
+	}
+	for _, container := range containers {
+		if err := p.removeReusableContainer(ctx, container); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *ProjectEnv) removeReusableContainer(ctx context.Context, container *docker.Container) error {
+	p.logger.Info("Removing reusable project container", "name", container.Labels[reuseNameLabel], "id", container.ID)
+	return errors.Wrapf(p.client.RemoveContainer(ctx, container.ID), "failed to remove container %s", container.ID)
+}
+
+func (p *ProjectEnv) removeReusableNetwork(ctx context.Context, network *docker.Network) error {
+	p.logger.Info("Removing reusable project network", "name", network.Labels[reuseNameLabel], "id", network.ID)
+	return errors.Wrapf(p.client.RemoveNetwork(ctx, network.ID), "failed to remove network %s", network.ID)
+}
+
+func (p *ProjectEnv) removeReusableVolume(ctx context.Context, volume *docker.Volume) error {
+	p.logger.Info("Removing reusable project volume", "name", volume.Labels[reuseNameLabel], "id", volume.Name)
+	return errors.Wrapf(p.client.RemoveVolume(ctx, volume.Name), "failed to remove volume %s", volume.Name)
+}
+
+// reuseNetwork returns the network of a previous run created from the same
+// params. Networks created from other params are removed together with
+// containers of the project, which may be connected to them.
+func (p *ProjectEnv) reuseNetwork(ctx context.Context, name string, params docker.CreateNetworkParams) (*docker.Network, error) {
+	hash, err := reuseHash("network", name, params)
+	if err != nil {
+		return nil, err
+	}
+
+	networks, err := p.client.FindNetworks(ctx, p.reuseNameLabels(name))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find reusable network")
+	}
+	var reused *docker.Network
+	for _, network := range networks {
+		if network.Labels[reuseLabel] == hash && reused == nil {
+			reused = network
+			continue
+		}
+		if err := p.removeReusableContainers(ctx); err != nil {
+			return nil, err
+		}
+		if err := p.removeReusableNetwork(ctx, network); err != nil {
+			return nil, err
+		}
+	}
+	if reused != nil {
+		p.logger.Info("Reusing project network", "name", name, "id", reused.ID)
+		return reused, nil
+	}
+
+	params.Labels = p.reuseLabels(params.Labels, name, hash)
+	params.Persistent = true
+	return p.client.CreateNetwork(ctx, params)
+}
+
+// reuseVolume returns the volume of a previous run created from the same
+// params. Volumes created from other params are removed together with
+// containers of the project, which may mount them.
+func (p *ProjectEnv) reuseVolume(ctx context.Context, name string, params docker.CreateVolumeParams) (*docker.Volume, error) {
+	hash, err := reuseHash("volume", name, params)
+	if err != nil {
+		return nil, err
+	}
+
+	volumes, err := p.client.FindVolumes(ctx, p.reuseNameLabels(name))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find reusable volume")
+	}
+	var reused *docker.Volume
+	for _, volume := range volumes {
+		if volume.Labels[reuseLabel] == hash && reused == nil {
+			reused = volume
+			continue
+		}
+		if err := p.removeReusableContainers(ctx); err != nil {
+			return nil, err
+		}
+		if err := p.removeReusableVolume(ctx, volume); err != nil {
+			return nil, err
+		}
+	}
+	if reused != nil {
+		p.logger.Info("Reusing project volume", "name", name, "id", reused.Name)
+		return reused, nil
+	}
+
+	params.Labels = p.reuseLabels(params.Labels, name, hash)
+	params.Persistent = true
+	return p.client.CreateVolume(ctx, params)
+}
+
+// reuseContainer returns a running container of a previous run created from
+// the same params. Stopped containers and ones created from other params are
+// removed and replaced with a new container.
+func (p *ProjectEnv) reuseContainer(ctx context.Context, name string, params docker.RunContainerParams) (*docker.Container, error) {
+	hash, err := reuseHash("container", name, params)
+	if err != nil {
+		return nil, err
+	}
+
+	containers, err := p.client.FindContainers(ctx, p.reuseNameLabels(name))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find reusable container")
+	}
+	var reused *docker.Container
+	for _, container := range containers {
+		if container.Labels[reuseLabel] == hash && container.State.Running && reused == nil {
+			reused = container
+			continue
+		}
+		if err := p.removeReusableContainer(ctx, container); err != nil {
+			return nil, err
+		}
+	}
+	if reused != nil {
+		p.logger.Info("Reusing project container", "name", name, "id", reused.ID)
+		return reused, nil
+	}
+
+	params.Labels = p.reuseLabels(params.Labels, name, hash)
+	params.Persistent = true
+	return p.client.RunContainer(ctx, params)
+}
+
+// reuseHash identifies a resource by its name and resolved description.
+func reuseHash(kind string, name string, params interface{}) (string, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to hash %s %s", kind, name)
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(kind + "\x00" + name + "\x00"))
+	hash.Write(data)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func withLabel(labels map[string]string, key string, value string) map[string]string {
+	result := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		result[k] = v
+	}
+	result[key] = value
+	return result
+}
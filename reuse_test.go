@@ -0,0 +1,145 @@
+package testenv_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/saturn4er/go-testenv"
+	"github.com/saturn4er/go-testenv/fake"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectEnvReuse(t *testing.T) {
+	backend := fake.NewBackend()
+	desc := testenv.ProjectEnvDesc{
+		Networks: map[string]testenv.NetworkDesc{
+			"public": {},
+		},
+		Containers: map[string]testenv.ContainerDesc{
+			"zookeeper": {
+				Image: testenv.ExternalImage("zookeeper"),
+				Networks: []testenv.ContainerNetwork{
+					{Network: testenv.ProjectNetwork("public"), Alias: "zookeeper"},
+				},
+			},
+		},
+		TestCaseEnv: testenv.TestCaseEnvDesc{
+			Containers: map[string]*testenv.ContainerDesc{
+				"postgres": {
+					Image: testenv.ExternalImage("postgres"),
+				},
+			},
+		},
+		Reuse: true,
+	}
+
+	run := func() (string, string) {
+		projectEnv := testenv.NewProjectEnvWithBackend(desc, backend)
+		require.NoError(t, projectEnv.Run())
+		testCaseEnv := projectEnv.NewTestCaseEnv()
+		require.NoError(t, testCaseEnv.Run())
+		postgres, ok := testCaseEnv.Container("postgres")
+		require.True(t, ok)
+
+		require.NoError(t, testCaseEnv.Close())
+		require.NoError(t, projectEnv.Close())
+		return projectEnv.MustContainer("zookeeper").ID(), postgres.ID()
+	}
+
+	zookeeperID, postgresID := run()
+	require.Len(t, backend.Containers(), 1)
+	require.Len(t, backend.Networks(), 1)
+	require.Equal(t, zookeeperID, backend.Containers()[0].ID)
+
+	reusedZookeeperID, newPostgresID := run()
+	require.Equal(t, zookeeperID, reusedZookeeperID)
+	require.NotEqual(t, postgresID, newPostgresID)
+	require.Len(t, backend.Containers(), 1)
+	require.Len(t, backend.Networks(), 1)
+
+	require.NoError(t, backend.StopContainer(zookeeperID, 1))
+	restartedZookeeperID, _ := run()
+	require.NotEqual(t, zookeeperID, restartedZookeeperID)
+	require.Len(t, backend.Containers(), 1)
+
+	network := backend.Networks()[0].ID
+	require.NoError(t, os.Setenv("TESTENV_FRESH", "1"))
+	freshZookeeperID, _ := run()
+	require.NoError(t, os.Unsetenv("TESTENV_FRESH"))
+	require.NotEqual(t, restartedZookeeperID, freshZookeeperID)
+	require.Len(t, backend.Containers(), 1)
+	require.Equal(t, freshZookeeperID, backend.Containers()[0].ID)
+	require.Len(t, backend.Networks(), 1)
+	require.NotEqual(t, network, backend.Networks()[0].ID)
+
+	reusedZookeeperID, _ = run()
+	require.Equal(t, freshZookeeperID, reusedZookeeperID)
+}
+
+func TestProjectEnvReuseReplacesChangedResources(t *testing.T) {
+	backend := fake.NewBackend()
+	desc := testenv.ProjectEnvDesc{
+		Networks: map[string]testenv.NetworkDesc{
+			"public": {},
+		},
+		Volumes: map[string]testenv.VolumeDesc{
+			"data": {},
+		},
+		Containers: map[string]testenv.ContainerDesc{
+			"zookeeper": {
+				Image: testenv.ExternalImage("zookeeper"),
+				Networks: []testenv.ContainerNetwork{
+					{Network: testenv.ProjectNetwork("public"), Alias: "zookeeper"},
+				},
+				Mounts: []testenv.Mount{
+					testenv.VolumeMount(testenv.ProjectVolume("data"), "/data"),
+				},
+			},
+			"kafka": {
+				Image: testenv.ExternalImage("kafka"),
+			},
+		},
+		Reuse: true,
+	}
+
+	run := func() *testenv.ProjectEnv {
+		projectEnv := testenv.NewProjectEnvWithBackend(desc, backend)
+		require.NoError(t, projectEnv.Run())
+		require.NoError(t, projectEnv.Close())
+		return projectEnv
+	}
+
+	first := run()
+	zookeeperID := first.MustContainer("zookeeper").ID()
+	kafkaID := first.MustContainer("kafka").ID()
+	require.Len(t, backend.Containers(), 2)
+
+	kafka := desc.Containers["kafka"]
+	kafka.Envs = map[string]testenv.StringValueResolver{"KAFKA_BROKER_ID": testenv.StringValue("1")}
+	desc.Containers["kafka"] = kafka
+	second := run()
+	require.Equal(t, zookeeperID, second.MustContainer("zookeeper").ID())
+	require.NotEqual(t, kafkaID, second.MustContainer("kafka").ID())
+	require.Len(t, backend.Containers(), 2)
+
+	network := backend.Networks()[0].ID
+	desc.Networks["public"] = testenv.NetworkDesc{
+		Labels: testenv.StringsMap{"tier": testenv.StringValue("public")},
+	}
+	third := run()
+	require.Len(t, backend.Networks(), 1)
+	require.NotEqual(t, network, backend.Networks()[0].ID)
+	require.NotEqual(t, zookeeperID, third.MustContainer("zookeeper").ID())
+	require.Len(t, backend.Containers(), 2)
+
+	volume := backend.Volumes()[0].Name
+	desc.Volumes["data"] = testenv.VolumeDesc{
+		Labels: testenv.StringsMap{"tier": testenv.StringValue("data")},
+	}
+	fourth := run()
+	require.Len(t, backend.Volumes(), 1)
+	require.NotEqual(t, volume, backend.Volumes()[0].Name)
+	require.NotEqual(t, third.MustContainer("zookeeper").ID(), fourth.MustContainer("zookeeper").ID())
+	require.Len(t, backend.Containers(), 2)
+	require.Len(t, backend.Networks(), 1)
+}
@@ -1,15 +1,17 @@
 package testenv
 
 import (
+	"context"
+
 	"os"
 
 	"github.com/pkg/errors"
 )
 
-type StringValueResolver func(project *ProjectEnv, caseEnv *TestCaseEnv) (string, error)
+type StringValueResolver func(ctx context.Context, project *ProjectEnv, caseEnv *TestCaseEnv) (string, error)
 
 func ProjectVariableValue(key string) StringValueResolver {
-	return func(project *ProjectEnv, caseEnv *TestCaseEnv) (s string, e error) {
+	return func(ctx context.Context, project *ProjectEnv, caseEnv *TestCaseEnv) (s string, e error) {
 		value := project.Get(key)
 		if value == nil {
 			return "", errors.Errorf("no variable %s in project", key)
@@ -22,14 +24,58 @@ func ProjectVariableValue(key string) StringValueResolver {
 		return result, nil
 	}
 }
+func TestCaseVariableValue(key string) StringValueResolver {
+	return func(ctx context.Context, project *ProjectEnv, caseEnv *TestCaseEnv) (s string, e error) {
+		if caseEnv == nil {
+			return "", errors.New("can't use TestCaseVariableValue resolver in project scope")
+		}
+		value := caseEnv.Get(key)
+		if value == nil {
+			return "", errors.Errorf("no variable %s in test case", key)
+		}
+		result, ok := value.(string)
+		if !ok {
+			return "", errors.Errorf("variable %s in test case is not a string", key)
+		}
+
+		return result, nil
+	}
+}
+
+// ContainerHostPortValue resolves the host port published for port of the
+// container. Test case containers take precedence over project ones.
+func ContainerHostPortValue(container string, port string, portType PortType) StringValueResolver {
+	return func(ctx context.Context, project *ProjectEnv, caseEnv *TestCaseEnv) (s string, e error) {
+		var (
+			c  *Container
+			ok bool
+		)
+		if caseEnv != nil {
+			c, ok = caseEnv.Container(container)
+		}
+		if !ok {
+			c, ok = project.Container(container)
+		}
+		if !ok {
+			return "", errors.Errorf("no container %s", container)
+		}
+
+		hostPort, ok := c.HostPort(port, portType)
+		if !ok {
+			return "", errors.Errorf("container %s has no published port %s/%s", container, port, portType)
+		}
+		return hostPort, nil
+	}
+}
+
 func StringValue(value string) StringValueResolver {
-	return func(project *ProjectEnv, caseEnv *TestCaseEnv) (s string, e error) {
+	return func(ctx context.Context, project *ProjectEnv, caseEnv *TestCaseEnv) (s string, e error) {
 		return value, nil
 	}
 }
 
 func EnvStringValue(variable string) StringValueResolver {
-	return func(project *ProjectEnv, caseEnv *TestCaseEnv) (s string, e error) {
+	return func(ctx context.Context, project *ProjectEnv, caseEnv *TestCaseEnv) (s string, e error) {
 		result, ok := os.LookupEnv(variable)
 		if !ok {
 			return "", errors.New("no env variable " + variable)
@@ -40,10 +86,10 @@ func EnvStringValue(variable string) StringValueResolver {
 
 type StringsMap map[string]StringValueResolver
 
-func (l StringsMap) resolve(project *ProjectEnv, testCase *TestCaseEnv) (map[string]string, error) {
+func (l StringsMap) resolve(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv) (map[string]string, error) {
 	labels := make(map[string]string)
 	for key, valueResolver := range l {
-		value, err := valueResolver(project, testCase)
+		value, err := valueResolver(ctx, project, testCase)
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to resolve %s value", key)
 		}
@@ -1,8 +1,10 @@
 package testenv
 
 import (
-	"log"
+	"context"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"go.uber.org/multierr"
@@ -25,59 +27,145 @@ const (
 	PortTypeUDP
 )
 
+// TestCaseEnv is safe for concurrent use, but Run and Close must not overlap.
 type TestCaseEnv struct {
-	projectEnv        *ProjectEnv
+	projectEnv *ProjectEnv
+	logger     Logger
+	id         string
+	logs       *logCapture
+	report     *reportRecorder
+
+	// closeMx serializes Close calls, mx guards resources
+	closeMx           sync.Mutex
+	mx                sync.RWMutex
 	createdNetworks   map[string]*Network
+	createdVolumes    map[string]*Volume
 	createdContainers map[string]*Container
+	startedContainers []*Container
 
 	variablesMx sync.RWMutex
 	variables   map[string]interface{}
 }
 
 func (t *TestCaseEnv) Run() error {
-	hooks := t.projectEnv.desc.TestCaseEnv.Hooks
-	if hooks.BeforeRun != nil {
-		if err := hooks.BeforeRun(t.projectEnv, t); err != nil {
-			return errors.WithStack(err)
+	return t.RunContext(context.Background())
+}
+
+// RunContext creates networks and starts containers of the test case. If
+// ctx is cancelled, everything created so far is removed before returning.
+func (t *TestCaseEnv) RunContext(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, t.projectEnv, t, "testenv.TestCaseEnv.Run")
+	defer func() { endSpan(span, err) }()
+
+	if _, err := sortContainers(t.projectEnv.desc.TestCaseEnv.containers(), t.projectEnv.hasContainerDesc); err != nil {
+		return errors.Wrap(err, "invalid test case containers")
+	}
+
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			err = multierr.Append(err, closeDetached(t.CloseContext))
 		}
+	}()
+
+	t.report.start()
+	defer t.report.finish()
+
+	hooks := t.projectEnv.desc.TestCaseEnv.Hooks
+	if err := runHook(ctx, t.projectEnv, t, "", "BeforeRun", hooks.BeforeRun); err != nil {
+		return errors.WithStack(err)
 	}
 
-	if err := t.createNetworks(); err != nil {
+	limit := newLimiter(t.projectEnv.desc.MaxParallelism)
+
+	if err := t.createNetworks(ctx, limit); err != nil {
 		return errors.WithStack(err)
 	}
 
-	if err := t.runContainers(); err != nil {
+	if err := t.createVolumes(ctx, limit); err != nil {
 		return errors.WithStack(err)
 	}
 
-	if hooks.AfterRun != nil {
-		if err := hooks.AfterRun(t.projectEnv, t); err != nil {
-			return errors.WithStack(err)
-		}
+	if err := t.runContainers(ctx, limit); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := runHook(ctx, t.projectEnv, t, "", "AfterRun", hooks.AfterRun); err != nil {
+		return errors.WithStack(err)
 	}
 	return nil
 }
 
+// Report returns timings of the last Run.
+func (t *TestCaseEnv) Report() *Report {
+	return t.report.build(ScopeTestCase, t.id)
+}
+
 func (t *TestCaseEnv) Close() error {
-	var err error
+	return t.CloseContext(context.Background())
+}
+
+func (t *TestCaseEnv) CloseContext(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, t.projectEnv, t, "testenv.TestCaseEnv.Close")
+	defer func() { endSpan(span, err) }()
+
+	t.closeMx.Lock()
+	defer t.closeMx.Unlock()
 
-	for _, container := range t.createdContainers {
-		if removeErr := t.projectEnv.client.RemoveContainer(container.container.ID); removeErr != nil {
+	cleanupStarted := time.Now()
+	emit(t.projectEnv, t, Event{Type: EventCleanupStarted})
+
+	// observers may look containers up, so t.mx is not held while emitting
+	t.mx.Lock()
+	containers := t.startedContainers
+	t.startedContainers = nil
+	networks := make(map[string]*Network, len(t.createdNetworks))
+	for name, network := range t.createdNetworks {
+		networks[name] = network
+	}
+	volumes := make(map[string]*Volume, len(t.createdVolumes))
+	for name, volume := range t.createdVolumes {
+		volumes[name] = volume
+	}
+	t.mx.Unlock()
+
+	failed, err := removeContainers(ctx, t.projectEnv, t, containers)
+	t.mx.Lock()
+	t.startedContainers = append(failed, t.startedContainers...)
+	t.mx.Unlock()
+	t.logs.stop()
+	for name, network := range networks {
+		started := time.Now()
+		removeErr := t.projectEnv.client.RemoveNetwork(ctx, network.ID)
+		emit(t.projectEnv, t, Event{Type: EventNetworkRemoved, Name: name, ID: network.ID, Duration: time.Since(started), Err: removeErr})
+		if removeErr != nil {
 			err = multierr.Append(err, removeErr)
+			continue
 		}
+		t.mx.Lock()
+		delete(t.createdNetworks, name)
+		t.mx.Unlock()
 	}
-
-	for _, network := range t.createdNetworks {
-		if removeErr := t.projectEnv.client.RemoveNetwork(network.ID); removeErr != nil {
+	for name, volume := range volumes {
+		started := time.Now()
+		removeErr := t.projectEnv.client.RemoveVolume(ctx, volume.DockerName)
+		emit(t.projectEnv, t, Event{Type: EventVolumeRemoved, Name: name, ID: volume.DockerName, Duration: time.Since(started), Err: removeErr})
+		if removeErr != nil {
 			err = multierr.Append(err, removeErr)
+			continue
 		}
+		t.mx.Lock()
+		delete(t.createdVolumes, name)
+		t.mx.Unlock()
 	}
 
-	return nil
+	emit(t.projectEnv, t, Event{Type: EventCleanupFinished, Duration: time.Since(cleanupStarted), Err: err})
+	return errors.WithStack(err)
 }
 
 func (t *TestCaseEnv) Container(name string) (*Container, bool) {
+	t.mx.RLock()
 	container, ok := t.createdContainers[name]
+	t.mx.RUnlock()
 	return container, ok
 }
 
@@ -93,44 +181,78 @@ func (t *TestCaseEnv) Get(key string) interface{} {
 
 	return t.variables[key]
 }
-func (t *TestCaseEnv) createNetworks() error {
-	for networkName, networkDesc := range t.projectEnv.desc.TestCaseEnv.Networks {
-		log.Printf("Creating project network %s", networkName)
-		network, err := networkDesc.create(t.projectEnv, t)
-		if err != nil {
-			return err
-		}
-		log.Printf("Created network %s (ID: %s)", networkName, network.ID)
+func (t *TestCaseEnv) createNetworks(ctx context.Context, limit limiter) error {
+	return createNetworks(ctx, t.projectEnv, t, t.projectEnv.desc.TestCaseEnv.Networks, limit, func(network *Network) {
+		t.mx.Lock()
+		t.createdNetworks[network.Name] = network
+		t.mx.Unlock()
+	})
+}
+func (t *TestCaseEnv) createVolumes(ctx context.Context, limit limiter) error {
+	return createVolumes(ctx, t.projectEnv, t, t.projectEnv.desc.TestCaseEnv.Volumes, limit, func(volume *Volume) {
+		t.mx.Lock()
+		t.createdVolumes[volume.Name] = volume
+		t.mx.Unlock()
+	})
+}
 
-		t.createdNetworks[networkName] = &Network{
-			ID:         network.ID,
-			Name:       networkName,
-			DockerName: network.Name,
+func (t *TestCaseEnv) runContainers(ctx context.Context, limit limiter) error {
+	containers := t.projectEnv.desc.TestCaseEnv.containers()
+	return startContainers(ctx, t.projectEnv, t, containers, t.projectEnv.hasContainerDesc, limit, func(name string, container *Container) {
+		t.mx.Lock()
+		t.createdContainers[name] = container
+		t.startedContainers = append(t.startedContainers, container)
+		t.mx.Unlock()
+
+		if containers[name].CaptureLogs {
+			path := filepath.Join(t.projectEnv.artifactsDir(), "test-case-"+t.id, logFileName(name))
+			t.logs.capture(path, container, t.logger)
 		}
-	}
-	return nil
+	})
 }
-func (t *TestCaseEnv) runContainers() error {
-	for containerName, containerDesc := range t.projectEnv.desc.TestCaseEnv.Containers {
-		log.Printf("Creating project container %s", containerName)
-		container, err := containerDesc.run(t.projectEnv, t)
-		if err != nil {
-			return errors.Wrapf(err, "failed to run container %s", containerName)
-		}
 
-		log.Printf("Created container %s (ID: %s)", containerName, container.ID)
-		t.createdContainers[containerName] = &Container{container: container}
+func (t *TestCaseEnv) containers() map[string]*Container {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+
+	containers := make(map[string]*Container, len(t.createdContainers))
+	for name, container := range t.createdContainers {
+		containers[name] = container
 	}
+	return containers
+}
 
-	return nil
+func (t *TestCaseEnv) network(name string) (*Network, bool) {
+	t.mx.RLock()
+	network, ok := t.createdNetworks[name]
+	t.mx.RUnlock()
+	return network, ok
+}
+
+func (t *TestCaseEnv) volume(name string) (*Volume, bool) {
+	t.mx.RLock()
+	volume, ok := t.createdVolumes[name]
+	t.mx.RUnlock()
+	return volume, ok
 }
 
 type TestCaseHooks struct {
-	BeforeRun func(project *ProjectEnv, testCase *TestCaseEnv) error
-	AfterRun  func(project *ProjectEnv, testCase *TestCaseEnv) error
+	BeforeRun func(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv) error
+	AfterRun  func(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv) error
 }
 type TestCaseEnvDesc struct {
 	Networks   map[string]NetworkDesc
+	Volumes    map[string]VolumeDesc
 	Containers map[string]*ContainerDesc
 	Hooks      TestCaseHooks
 }
+
+func (t TestCaseEnvDesc) containers() map[string]ContainerDesc {
+	containers := make(map[string]ContainerDesc, len(t.Containers))
+	for name, container := range t.Containers {
+		if container != nil {
+			containers[name] = *container
+		}
+	}
+	return containers
+}
@@ -0,0 +1,116 @@
+package testenv
+
+import (
+	"context"
+	"sort"
+	"testing"
+)
+
+const failureDiagnosticsLogLines = 200
+
+// NewProjectEnvT creates and runs a project environment for tb. Library logs
+// are written with tb.Logf, the environment is closed in tb.Cleanup and, if
+// the test failed, logs and state of every container are dumped into the
+// test output.
+func NewProjectEnvT(tb testing.TB, desc ProjectEnvDesc) *ProjectEnv {
+	tb.Helper()
+
+	projectEnv, err := NewProjectEnv(desc)
+	if err != nil {
+		tb.Fatalf("failed to create project env: %+v", err)
+	}
+
+	projectEnv.runT(tb)
+	return projectEnv
+}
+
+// NewProjectEnvWithBackendT is like NewProjectEnvT, but runs the environment
+// on the given backend.
+func NewProjectEnvWithBackendT(tb testing.TB, desc ProjectEnvDesc, backend Backend) *ProjectEnv {
+	tb.Helper()
+
+	projectEnv := NewProjectEnvWithBackend(desc, backend)
+	projectEnv.runT(tb)
+	return projectEnv
+}
+
+// NewTestCaseEnvT creates and runs a test case environment for tb. See
+// NewProjectEnvT for details.
+func (p *ProjectEnv) NewTestCaseEnvT(tb testing.TB) *TestCaseEnv {
+	tb.Helper()
+
+	testCaseEnv := p.NewTestCaseEnv()
+	if p.desc.Logger == nil {
+		testCaseEnv.logger = PrintfLogger(tb.Logf)
+	}
+
+	tb.Cleanup(func() {
+		if tb.Failed() {
+			dumpContainers(tb, p.client, "test case", testCaseEnv.containers())
+		}
+		if err := testCaseEnv.Close(); err != nil {
+			tb.Errorf("failed to close test case env: %+v", err)
+		}
+	})
+
+	if err := testCaseEnv.Run(); err != nil {
+		tb.Fatalf("failed to run test case env: %+v\n%s", err, testCaseEnv.Report())
+	}
+	return testCaseEnv
+}
+
+func (p *ProjectEnv) runT(tb testing.TB) {
+	tb.Helper()
+
+	if p.desc.Logger == nil {
+		p.logger = PrintfLogger(tb.Logf)
+	}
+
+	tb.Cleanup(func() {
+		if tb.Failed() {
+			dumpContainers(tb, p.client, "project", p.containers())
+		}
+		if err := p.Close(); err != nil {
+			tb.Errorf("failed to close project env: %+v", err)
+		}
+	})
+
+	if err := p.Run(); err != nil {
+		tb.Fatalf("failed to run project env: %+v\n%s", err, p.Report())
+	}
+}
+
+func dumpContainers(tb testing.TB, client Backend, scope string, containers map[string]*Container) {
+	names := make([]string, 0, len(containers))
+	for name := range containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		container := containers[name]
+		tb.Logf("%s container %s (ID: %s)\n%s", scope, name, container.ID(),
+			containerDiagnostics(context.Background(), client, container.ID(), failureDiagnosticsLogLines))
+	}
+}
+
+// AcquireT acquires a test case environment from the pool and releases it
+// when tb finishes.
+func (p *TestCaseEnvPool) AcquireT(tb testing.TB) *TestCaseEnv {
+	tb.Helper()
+
+	testCaseEnv, err := p.Acquire(context.Background())
+	if err != nil {
+		tb.Fatalf("failed to acquire test case env: %+v", err)
+	}
+
+	tb.Cleanup(func() {
+		if tb.Failed() {
+			dumpContainers(tb, p.project.client, "test case", testCaseEnv.containers())
+		}
+		if err := p.Release(context.Background(), testCaseEnv); err != nil {
+			tb.Errorf("failed to release test case env: %+v", err)
+		}
+	})
+	return testCaseEnv
+}
@@ -0,0 +1,59 @@
+package testenv
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/saturn4er/go-testenv"
+
+const (
+	attrScope       = attribute.Key("testenv.scope")
+	attrTestCase    = attribute.Key("testenv.test_case.id")
+	attrName        = attribute.Key("testenv.name")
+	attrContainerID = attribute.Key("testenv.container.id")
+	attrNetworkID   = attribute.Key("testenv.network.id")
+	attrVolume      = attribute.Key("testenv.volume.name")
+	attrImage       = attribute.Key("testenv.image")
+	attrHook        = attribute.Key("testenv.hook")
+)
+
+func (p *ProjectEnv) tracer() trace.Tracer {
+	provider := p.desc.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+// startSpan starts a span of project or test case scope.
+func startSpan(
+	ctx context.Context,
+	project *ProjectEnv,
+	testCase *TestCaseEnv,
+	spanName string,
+	attrs ...attribute.KeyValue,
+) (context.Context, trace.Span) {
+	if testCase != nil {
+		attrs = append(attrs, attrScope.String(string(ScopeTestCase)), attrTestCase.String(testCase.id))
+	} else {
+		attrs = append(attrs, attrScope.String(string(ScopeProject)))
+	}
+	return project.tracer().Start(ctx, spanName, trace.WithAttributes(attrs...))
+}
+
+func startContainerSpan(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv, name string) (context.Context, trace.Span) {
+	return startSpan(ctx, project, testCase, "testenv.container.run", attrName.String(name))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,61 @@
+package testenv_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/saturn4er/go-testenv"
+	"github.com/saturn4er/go-testenv/fake"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestProjectEnvTracing(t *testing.T) {
+	backend := fake.NewBackend()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	projectEnv := testenv.NewProjectEnvWithBackend(testenv.ProjectEnvDesc{
+		Networks: map[string]testenv.NetworkDesc{
+			"public": {},
+		},
+		Containers: map[string]testenv.ContainerDesc{
+			"postgres": {
+				Image: testenv.ExternalImage("postgres"),
+				Hooks: testenv.ContainerHooks{
+					AfterRun: func(ctx context.Context, project *testenv.ProjectEnv, testCase *testenv.TestCaseEnv) error {
+						return nil
+					},
+				},
+			},
+		},
+		Logger:         testenv.NopLogger(),
+		TracerProvider: provider,
+	}, backend)
+	require.NoError(t, projectEnv.Run())
+	require.NoError(t, projectEnv.Close())
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+
+	run := spans["testenv.ProjectEnv.Run"]
+	require.True(t, run.SpanContext.IsValid())
+	require.Equal(t, run.SpanContext.SpanID(), spans["testenv.network.create"].Parent.SpanID())
+
+	containerRun := spans["testenv.container.run"]
+	require.Equal(t, run.SpanContext.SpanID(), containerRun.Parent.SpanID())
+	require.Contains(t, containerRun.Attributes, attribute.String("testenv.name", "postgres"))
+	require.Contains(t, containerRun.Attributes,
+		attribute.String("testenv.container.id", projectEnv.MustContainer("postgres").ID()))
+
+	for _, name := range []string{"testenv.image.resolve", "testenv.image.pull", "testenv.container.create", "testenv.container.wait", "testenv.hook"} {
+		require.Contains(t, spans, name)
+		require.Equal(t, containerRun.SpanContext.SpanID(), spans[name].Parent.SpanID(), name)
+	}
+
+	require.Contains(t, spans, "testenv.ProjectEnv.Close")
+}
@@ -0,0 +1,194 @@
+package testenv
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/saturn4er/go-testenv/docker"
+)
+
+type VolumeResolver func(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv) (string, error)
+
+func ProjectVolume(name string) VolumeResolver {
+	return func(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv) (string, error) {
+		if project == nil {
+			return "", errors.New("no project passed")
+		}
+		volume, ok := project.volume(name)
+		if !ok {
+			return "", errors.Errorf("no volume %s in project", name)
+		}
+		return volume.DockerName, nil
+	}
+}
+
+func TestCaseVolume(name string) VolumeResolver {
+	return func(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv) (string, error) {
+		if testCase == nil {
+			return "", errors.New("can't use TestCaseVolume resolver in project scope")
+		}
+
+		volume, ok := testCase.volume(name)
+		if !ok {
+			return "", errors.Errorf("no volume %s in test case", name)
+		}
+		return volume.DockerName, nil
+	}
+}
+
+type VolumeDesc struct {
+	Driver  string
+	Options map[string]string
+	Labels  StringsMap
+}
+
+func (v *VolumeDesc) create(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv, name string) (volume *docker.Volume, err error) {
+	ctx, span := startSpan(ctx, project, testCase, "testenv.volume.create", attrName.String(name))
+	defer func() {
+		if volume != nil {
+			span.SetAttributes(attrVolume.String(volume.Name))
+		}
+		endSpan(span, err)
+	}()
+
+	labels, err := v.Labels.resolve(ctx, project, testCase)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	params := docker.CreateVolumeParams{
+		Driver:  v.Driver,
+		Options: v.Options,
+		Labels:  labels,
+	}
+
+	if testCase == nil && project.reuse() {
+		volume, err = project.reuseVolume(ctx, name, params)
+	} else {
+		started := time.Now()
+		volume, err = project.client.CreateVolume(ctx, params)
+		event := Event{Type: EventVolumeCreated, Name: name, Duration: time.Since(started), Err: err}
+		if volume != nil {
+			event.ID = volume.Name
+		}
+		emit(project, testCase, event)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return volume, nil
+}
+
+// createVolumes creates volumes concurrently, at most limit at a time.
+func createVolumes(
+	ctx context.Context,
+	project *ProjectEnv,
+	testCase *TestCaseEnv,
+	volumes map[string]VolumeDesc,
+	limit limiter,
+	register func(volume *Volume),
+) error {
+	group := newTaskGroup(ctx)
+	for volumeName, volumeDesc := range volumes {
+		volumeName, volumeDesc := volumeName, volumeDesc
+		group.Go(func(ctx context.Context) error {
+			if err := limit.acquire(ctx); err != nil {
+				return err
+			}
+			defer limit.release()
+
+			volume, err := volumeDesc.create(ctx, project, testCase, volumeName)
+			if err != nil {
+				return errors.Wrapf(err, "failed to create volume %s", volumeName)
+			}
+
+			register(&Volume{
+				Name:       volumeName,
+				DockerName: volume.Name,
+			})
+			return nil
+		})
+	}
+
+	return group.Wait()
+}
+
+type Volume struct {
+	Name       string
+	DockerName string
+}
+
+// Mount describes a filesystem mounted into a container. Use BindMount,
+// VolumeMount or TmpfsMount to construct it.
+type Mount struct {
+	Type      docker.MountType
+	Source    StringValueResolver
+	Volume    VolumeResolver
+	Target    string
+	ReadOnly  bool
+	TmpfsSize int64
+	TmpfsMode os.FileMode
+}
+
+// BindMount mounts the host path resolved by source to target. Relative
+// host paths are resolved against the working directory.
+func BindMount(source StringValueResolver, target string) Mount {
+	return Mount{Type: docker.MountTypeBind, Source: source, Target: target}
+}
+
+// VolumeMount mounts a volume created by ProjectEnv or TestCaseEnv to target.
+func VolumeMount(volume VolumeResolver, target string) Mount {
+	return Mount{Type: docker.MountTypeVolume, Volume: volume, Target: target}
+}
+
+// TmpfsMount mounts a tmpfs of the given size in bytes to target. Zero size
+// means unlimited.
+func TmpfsMount(target string, size int64) Mount {
+	return Mount{Type: docker.MountTypeTmpfs, Target: target, TmpfsSize: size}
+}
+
+func (m Mount) resolve(ctx context.Context, project *ProjectEnv, testCase *TestCaseEnv) (docker.Mount, error) {
+	if m.Target == "" {
+		return docker.Mount{}, errors.New("mount target is empty")
+	}
+
+	mount := docker.Mount{
+		Type:     m.Type,
+		Target:   m.Target,
+		ReadOnly: m.ReadOnly,
+	}
+	switch m.Type {
+	case docker.MountTypeBind:
+		if m.Source == nil {
+			return docker.Mount{}, errors.New("bind mount source is not set")
+		}
+		source, err := m.Source(ctx, project, testCase)
+		if err != nil {
+			return docker.Mount{}, errors.Wrap(err, "failed to resolve bind mount source")
+		}
+		mount.Source, err = filepath.Abs(source)
+		if err != nil {
+			return docker.Mount{}, errors.WithStack(err)
+		}
+	case docker.MountTypeVolume:
+		if m.Volume == nil {
+			return docker.Mount{}, errors.New("volume of mount is not set")
+		}
+		volume, err := m.Volume(ctx, project, testCase)
+		if err != nil {
+			return docker.Mount{}, errors.Wrap(err, "failed to resolve volume")
+		}
+		mount.Source = volume
+	case docker.MountTypeTmpfs:
+		mount.TmpfsSize = m.TmpfsSize
+		mount.TmpfsMode = m.TmpfsMode
+	default:
+		return docker.Mount{}, errors.Errorf("unknown mount type %q", m.Type)
+	}
+
+	return mount, nil
+}
@@ -0,0 +1,83 @@
+package testenv_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/saturn4er/go-testenv"
+	"github.com/saturn4er/go-testenv/docker"
+	"github.com/saturn4er/go-testenv/fake"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContainerMounts(t *testing.T) {
+	backend := fake.NewBackend()
+
+	projectEnv := testenv.NewProjectEnvWithBackend(testenv.ProjectEnvDesc{
+		Volumes: map[string]testenv.VolumeDesc{
+			"data": {
+				Labels: testenv.StringsMap{"env": testenv.StringValue("test")},
+			},
+		},
+		Containers: map[string]testenv.ContainerDesc{
+			"postgres": {
+				Image: testenv.ExternalImage("postgres"),
+				Mounts: []testenv.Mount{
+					{
+						Type:     docker.MountTypeBind,
+						Source:   testenv.StringValue("testdata/init"),
+						Target:   "/docker-entrypoint-initdb.d",
+						ReadOnly: true,
+					},
+					testenv.VolumeMount(testenv.ProjectVolume("data"), "/var/lib/postgresql/data"),
+				},
+			},
+		},
+		TestCaseEnv: testenv.TestCaseEnvDesc{
+			Volumes: map[string]testenv.VolumeDesc{
+				"cache": {},
+			},
+			Containers: map[string]*testenv.ContainerDesc{
+				"redis": {
+					Image: testenv.ExternalImage("redis"),
+					Mounts: []testenv.Mount{
+						testenv.VolumeMount(testenv.TestCaseVolume("cache"), "/data"),
+						testenv.TmpfsMount("/tmp", 64<<20),
+					},
+				},
+			},
+		},
+	}, backend)
+	require.NoError(t, projectEnv.Run())
+
+	testCaseEnv := projectEnv.NewTestCaseEnv()
+	require.NoError(t, testCaseEnv.Run())
+
+	volumes := backend.Volumes()
+	require.Len(t, volumes, 2)
+	require.Equal(t, map[string]string{"env": "test"}, volumes[0].Labels)
+
+	initDir, err := filepath.Abs("testdata/init")
+	require.NoError(t, err)
+	postgresParams, ok := backend.ContainerParams(projectEnv.MustContainer("postgres").ID())
+	require.True(t, ok)
+	require.Equal(t, []docker.Mount{
+		{Type: docker.MountTypeBind, Source: initDir, Target: "/docker-entrypoint-initdb.d", ReadOnly: true},
+		{Type: docker.MountTypeVolume, Source: volumes[0].Name, Target: "/var/lib/postgresql/data"},
+	}, postgresParams.Mounts)
+
+	redis, ok := testCaseEnv.Container("redis")
+	require.True(t, ok)
+	redisParams, ok := backend.ContainerParams(redis.ID())
+	require.True(t, ok)
+	require.Equal(t, []docker.Mount{
+		{Type: docker.MountTypeVolume, Source: volumes[1].Name, Target: "/data"},
+		{Type: docker.MountTypeTmpfs, Target: "/tmp", TmpfsSize: 64 << 20},
+	}, redisParams.Mounts)
+
+	require.NoError(t, testCaseEnv.Close())
+	require.Len(t, backend.Volumes(), 1)
+
+	require.NoError(t, projectEnv.Close())
+	require.Empty(t, backend.Volumes())
+}
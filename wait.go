@@ -0,0 +1,290 @@
+package testenv
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultWaitPollInterval = 200 * time.Millisecond
+
+// WaitStrategy blocks until a started container is ready to be used.
+// The context passed to WaitUntilReady is cancelled once
+// ContainerDesc.HealthCheckOptions.Timeout elapses.
+type WaitStrategy interface {
+	WaitUntilReady(ctx context.Context, container *Container) error
+}
+
+type WaitStrategyFunc func(ctx context.Context, container *Container) error
+
+func (f WaitStrategyFunc) WaitUntilReady(ctx context.Context, container *Container) error {
+	return f(ctx, container)
+}
+
+func (c ContainerDesc) waitReady(ctx context.Context, project *ProjectEnv, container *Container) error {
+	if c.WaitStrategy == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.HealthCheckOptions.timeout())
+	defer cancel()
+
+	if err := c.WaitStrategy.WaitUntilReady(ctx, container); err != nil {
+		if errors.Cause(err) == context.Canceled {
+			return err
+		}
+		return errors.Errorf("%v\n%s", err, containerDiagnostics(context.Background(), project.client, container.ID(), diagnosticsLogLines))
+	}
+	return nil
+}
+
+// WaitForHealthCheck adapts a raw HealthCheck to a WaitStrategy.
+func WaitForHealthCheck(healthCheck HealthCheck) WaitStrategy {
+	return WaitStrategyFunc(func(ctx context.Context, container *Container) error {
+		return poll(ctx, defaultWaitPollInterval, func() (bool, error) {
+			healthy, err := healthCheck(ctx)
+			return healthy && err == nil, err
+		})
+	})
+}
+
+type LogWaitStrategy struct {
+	Pattern      *regexp.Regexp
+	Occurrences  int
+	PollInterval time.Duration
+}
+
+// WaitForLog waits until container output matches pattern at least once.
+// Set Occurrences on the result to wait for more matches. It panics if
+// pattern is not a valid regular expression.
+func WaitForLog(pattern string) *LogWaitStrategy {
+	return &LogWaitStrategy{
+		Pattern:     regexp.MustCompile(pattern),
+		Occurrences: 1,
+	}
+}
+
+func (l *LogWaitStrategy) WaitUntilReady(ctx context.Context, container *Container) error {
+	occurrences := l.Occurrences
+	if occurrences < 1 {
+		occurrences = 1
+	}
+
+	err := poll(ctx, l.PollInterval, func() (bool, error) {
+		logs, err := containerLogs(ctx, container.client, container.ID(), 0)
+		if err != nil {
+			return false, err
+		}
+		return len(l.Pattern.FindAllStringIndex(logs, -1)) >= occurrences, nil
+	})
+	return errors.Wrapf(err, "log pattern %q was not found %d times", l.Pattern, occurrences)
+}
+
+type PortWaitStrategy struct {
+	Port         string
+	PollInterval time.Duration
+}
+
+// WaitForPort waits until the host port mapped to the container TCP port
+// accepts connections.
+func WaitForPort(port string) *PortWaitStrategy {
+	return &PortWaitStrategy{
+		Port: port,
+	}
+}
+
+func (p *PortWaitStrategy) WaitUntilReady(ctx context.Context, container *Container) error {
+	hostPort, ok := container.HostPort(p.Port, PortTypeTCP)
+	if !ok {
+		return errors.Errorf("port %s/tcp is not published", p.Port)
+	}
+	address := net.JoinHostPort(container.Host(), hostPort)
+
+	dialer := &net.Dialer{}
+	err := poll(ctx, p.PollInterval, func() (bool, error) {
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return false, err
+		}
+		return true, conn.Close()
+	})
+	return errors.Wrapf(err, "port %s/tcp (%s) is not accepting connections", p.Port, address)
+}
+
+type HTTPWaitStrategy struct {
+	Port         string
+	Path         string
+	Method       string
+	StatusCode   int
+	BodyPattern  *regexp.Regexp
+	PollInterval time.Duration
+	Client       *http.Client
+}
+
+// WaitForHTTP waits until a request to the given container port and path
+// returns 200 OK. StatusCode and BodyPattern on the result can be changed
+// to check for other responses.
+func WaitForHTTP(port, path string) *HTTPWaitStrategy {
+	return &HTTPWaitStrategy{
+		Port:       port,
+		Path:       path,
+		Method:     http.MethodGet,
+		StatusCode: http.StatusOK,
+	}
+}
+
+func (h *HTTPWaitStrategy) WaitUntilReady(ctx context.Context, container *Container) error {
+	hostPort, ok := container.HostPort(h.Port, PortTypeTCP)
+	if !ok {
+		return errors.Errorf("port %s/tcp is not published", h.Port)
+	}
+	url := fmt.Sprintf("http://%s/%s", net.JoinHostPort(container.Host(), hostPort), strings.TrimPrefix(h.Path, "/"))
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	err := poll(ctx, h.PollInterval, func() (bool, error) {
+		req, err := http.NewRequest(h.Method, url, nil)
+		if err != nil {
+			return false, err
+		}
+
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return false, err
+		}
+		defer resp.Body.Close()
+
+		if h.StatusCode != 0 && resp.StatusCode != h.StatusCode {
+			return false, errors.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+		if h.BodyPattern == nil {
+			return true, nil
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return false, err
+		}
+		if !h.BodyPattern.Match(body) {
+			return false, errors.Errorf("response body does not match %q", h.BodyPattern)
+		}
+		return true, nil
+	})
+	return errors.Wrapf(err, "%s %s did not return expected response", h.Method, url)
+}
+
+type ExecWaitStrategy struct {
+	Cmd          []string
+	PollInterval time.Duration
+	// Timeout, if set, bounds every execution of Cmd.
+	Timeout time.Duration
+}
+
+// WaitForExec waits until cmd executed inside the container exits with code 0.
+func WaitForExec(cmd ...string) *ExecWaitStrategy {
+	return &ExecWaitStrategy{
+		Cmd: cmd,
+	}
+}
+
+func (e *ExecWaitStrategy) WaitUntilReady(ctx context.Context, container *Container) error {
+	err := poll(ctx, e.PollInterval, func() (bool, error) {
+		execCtx := ctx
+		if e.Timeout > 0 {
+			var cancel context.CancelFunc
+			execCtx, cancel = context.WithTimeout(ctx, e.Timeout)
+			defer cancel()
+		}
+
+		result, err := container.Exec(execCtx, e.Cmd, ExecOptions{})
+		if err != nil {
+			return false, err
+		}
+		if result.ExitCode != 0 {
+			return false, errors.Errorf("exit code %d: %s", result.ExitCode, result.Stderr)
+		}
+		return true, nil
+	})
+	return errors.Wrapf(err, "command %q did not succeed", e.Cmd)
+}
+
+// WaitForAll waits until every strategy reports the container as ready.
+func WaitForAll(strategies ...WaitStrategy) WaitStrategy {
+	return WaitStrategyFunc(func(ctx context.Context, container *Container) error {
+		for _, strategy := range strategies {
+			if err := strategy.WaitUntilReady(ctx, container); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// WaitForAny waits until at least one of strategies reports the container
+// as ready.
+func WaitForAny(strategies ...WaitStrategy) WaitStrategy {
+	return WaitStrategyFunc(func(ctx context.Context, container *Container) error {
+		if len(strategies) == 0 {
+			return nil
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		errs := make(chan error, len(strategies))
+		for _, strategy := range strategies {
+			go func(strategy WaitStrategy) {
+				errs <- strategy.WaitUntilReady(ctx, container)
+			}(strategy)
+		}
+
+		var messages []string
+		for range strategies {
+			err := <-errs
+			if err == nil {
+				return nil
+			}
+			messages = append(messages, err.Error())
+		}
+		return errors.Errorf("none of wait strategies succeeded: %s", strings.Join(messages, "; "))
+	})
+}
+
+func poll(ctx context.Context, interval time.Duration, check func() (bool, error)) error {
+	if interval <= 0 {
+		interval = defaultWaitPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		ok, err := check()
+		if ok && err == nil {
+			return nil
+		}
+		if err != nil && ctx.Err() == nil {
+			lastErr = err
+		}
+
+		select {
+		case <-ctx.Done():
+			if lastErr != nil {
+				return errors.Wrapf(ctx.Err(), "last error: %v", lastErr)
+			}
+			return errors.WithStack(ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
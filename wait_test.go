@@ -0,0 +1,210 @@
+package testenv_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/saturn4er/go-testenv"
+	"github.com/saturn4er/go-testenv/docker"
+	"github.com/saturn4er/go-testenv/fake"
+	"github.com/stretchr/testify/require"
+)
+
+const waitTimeout = 50 * time.Millisecond
+
+func runWaitStrategy(t *testing.T, backend *fake.Backend, strategy testenv.WaitStrategy, hostPort string) error {
+	desc := testenv.ContainerDesc{
+		Image:              testenv.ExternalImage("app"),
+		WaitStrategy:       strategy,
+		HealthCheckOptions: testenv.HealthCheckOptions{Timeout: waitTimeout},
+	}
+	if hostPort != "" {
+		desc.PortBindings = []testenv.PortBinding{{
+			Host:          testenv.StringValue("127.0.0.1"),
+			ContainerPort: testenv.StringValue("8080"),
+			Port:          testenv.StringValue(hostPort),
+		}}
+	}
+
+	projectEnv := testenv.NewProjectEnvWithBackend(testenv.ProjectEnvDesc{
+		Containers: map[string]testenv.ContainerDesc{"app": desc},
+	}, backend)
+	defer func() {
+		require.NoError(t, projectEnv.Close())
+	}()
+
+	return projectEnv.Run()
+}
+
+// writeLogs is a wait strategy writing output to the container logs.
+func writeLogs(backend *fake.Backend, output string) testenv.WaitStrategy {
+	return testenv.WaitStrategyFunc(func(ctx context.Context, container *testenv.Container) error {
+		return backend.WriteLogs(container.ID(), output)
+	})
+}
+
+func listenerPort(t *testing.T, address string) string {
+	_, port, err := net.SplitHostPort(address)
+	require.NoError(t, err)
+	return port
+}
+
+func TestWaitForLog(t *testing.T) {
+	backend := fake.NewBackend()
+	strategy := testenv.WaitForLog("ready to accept")
+	strategy.Occurrences = 2
+	strategy.PollInterval = time.Millisecond
+
+	require.NoError(t, runWaitStrategy(t, backend, testenv.WaitForAll(
+		writeLogs(backend, "ready to accept connections\nrestarting\nready to accept connections\n"),
+		strategy,
+	), ""))
+
+	err := runWaitStrategy(t, backend, testenv.WaitForAll(
+		writeLogs(backend, "ready to accept connections\n"),
+		strategy,
+	), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `log pattern "ready to accept" was not found 2 times: context deadline exceeded`)
+}
+
+func TestWaitForPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listenerPort(t, listener.Addr().String())
+
+	strategy := testenv.WaitForPort("8080")
+	strategy.PollInterval = time.Millisecond
+	require.NoError(t, runWaitStrategy(t, fake.NewBackend(), strategy, port))
+
+	require.NoError(t, listener.Close())
+	err = runWaitStrategy(t, fake.NewBackend(), strategy, port)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), fmt.Sprintf("port 8080/tcp (127.0.0.1:%s) is not accepting connections: last error:", port))
+
+	err = runWaitStrategy(t, fake.NewBackend(), testenv.WaitForPort("9090"), port)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "port 9090/tcp is not published")
+}
+
+func TestWaitForHTTP(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" || atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"status":"up"}`)
+	}))
+	defer server.Close()
+	port := listenerPort(t, server.Listener.Addr().String())
+
+	strategy := testenv.WaitForHTTP("8080", "/health")
+	strategy.BodyPattern = regexp.MustCompile(`"status":"up"`)
+	strategy.PollInterval = time.Millisecond
+	require.NoError(t, runWaitStrategy(t, fake.NewBackend(), strategy, port))
+	require.EqualValues(t, 3, atomic.LoadInt32(&requests))
+
+	strategy = testenv.WaitForHTTP("8080", "/health")
+	strategy.BodyPattern = regexp.MustCompile(`"status":"down"`)
+	strategy.PollInterval = time.Millisecond
+	err := runWaitStrategy(t, fake.NewBackend(), strategy, port)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "did not return expected response")
+	require.Contains(t, err.Error(), `response body does not match "\"status\":\"down\""`)
+
+	strategy = testenv.WaitForHTTP("8080", "/metrics")
+	strategy.PollInterval = time.Millisecond
+	err = runWaitStrategy(t, fake.NewBackend(), strategy, port)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), fmt.Sprintf("GET http://127.0.0.1:%s/metrics did not return expected response", port))
+	require.Contains(t, err.Error(), "unexpected status code 503")
+}
+
+func TestWaitForExec(t *testing.T) {
+	backend := fake.NewBackend()
+	var calls int32
+	backend.ExecHandler = func(container *docker.Container, params docker.ExecParams) (*docker.ExecResult, error) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return &docker.ExecResult{ExitCode: 2, Stderr: "no response"}, nil
+		}
+		return &docker.ExecResult{}, nil
+	}
+
+	strategy := testenv.WaitForExec("pg_isready")
+	strategy.PollInterval = time.Millisecond
+	require.NoError(t, runWaitStrategy(t, backend, strategy, ""))
+	require.EqualValues(t, 3, atomic.LoadInt32(&calls))
+
+	backend.ExecHandler = func(container *docker.Container, params docker.ExecParams) (*docker.ExecResult, error) {
+		return &docker.ExecResult{ExitCode: 2, Stderr: "no response"}, nil
+	}
+	err := runWaitStrategy(t, backend, strategy, "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `command ["pg_isready"] did not succeed: last error: exit code 2: no response: context deadline exceeded`)
+}
+
+func TestWaitForAll(t *testing.T) {
+	var calls []string
+	strategy := func(name string, err error) testenv.WaitStrategy {
+		return testenv.WaitStrategyFunc(func(ctx context.Context, container *testenv.Container) error {
+			calls = append(calls, name)
+			return err
+		})
+	}
+
+	require.NoError(t, runWaitStrategy(t, fake.NewBackend(), testenv.WaitForAll(
+		strategy("first", nil),
+		strategy("second", nil),
+	), ""))
+	require.Equal(t, []string{"first", "second"}, calls)
+
+	calls = nil
+	err := runWaitStrategy(t, fake.NewBackend(), testenv.WaitForAll(
+		strategy("first", fmt.Errorf("first failed")),
+		strategy("second", nil),
+	), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "first failed")
+	require.Equal(t, []string{"first"}, calls)
+}
+
+func TestWaitForAny(t *testing.T) {
+	cancelled := make(chan struct{})
+	never := testenv.WaitStrategyFunc(func(ctx context.Context, container *testenv.Container) error {
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	})
+	ready := testenv.WaitStrategyFunc(func(ctx context.Context, container *testenv.Container) error {
+		return nil
+	})
+
+	require.NoError(t, runWaitStrategy(t, fake.NewBackend(), testenv.WaitForAny(never, ready), ""))
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("WaitForAny must cancel remaining strategies")
+	}
+
+	failed := testenv.WaitStrategyFunc(func(ctx context.Context, container *testenv.Container) error {
+		return fmt.Errorf("connection refused")
+	})
+	timedOut := testenv.WaitStrategyFunc(func(ctx context.Context, container *testenv.Container) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	err := runWaitStrategy(t, fake.NewBackend(), testenv.WaitForAny(failed, timedOut), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "none of wait strategies succeeded:")
+	require.Contains(t, err.Error(), "context deadline exceeded")
+
+	require.NoError(t, runWaitStrategy(t, fake.NewBackend(), testenv.WaitForAny(), ""))
+}
@@ -0,0 +1,33 @@
+// Package zapadapter adapts zap loggers to testenv.Logger.
+package zapadapter
+
+import (
+	"github.com/saturn4er/go-testenv"
+	"go.uber.org/zap"
+)
+
+type logger struct {
+	sugar *zap.SugaredLogger
+}
+
+// New returns testenv.Logger writing to l. Key-value pairs are passed as
+// zap fields.
+func New(l *zap.Logger) testenv.Logger {
+	return logger{sugar: l.Sugar()}
+}
+
+func (l logger) Debug(msg string, keysAndValues ...interface{}) {
+	l.sugar.Debugw(msg, keysAndValues...)
+}
+
+func (l logger) Info(msg string, keysAndValues ...interface{}) {
+	l.sugar.Infow(msg, keysAndValues...)
+}
+
+func (l logger) Warn(msg string, keysAndValues ...interface{}) {
+	l.sugar.Warnw(msg, keysAndValues...)
+}
+
+func (l logger) Error(msg string, keysAndValues ...interface{}) {
+	l.sugar.Errorw(msg, keysAndValues...)
+}
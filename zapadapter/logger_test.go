@@ -0,0 +1,32 @@
+package zapadapter_test
+
+import (
+	"testing"
+
+	"github.com/saturn4er/go-testenv/zapadapter"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := zapadapter.New(zap.New(core).With(zap.String("suite", "db")))
+
+	logger.Debug("image resolved", "name", "postgres", "image", "postgres:12")
+	logger.Info("container started", "name", "postgres")
+	logger.Warn("container not removed")
+	logger.Error("cleanup failed", "error", "timeout")
+
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 4)
+	require.Equal(t, zapcore.DebugLevel, entries[0].Level)
+	require.Equal(t, "image resolved", entries[0].Message)
+	require.Equal(t, map[string]interface{}{"suite": "db", "name": "postgres", "image": "postgres:12"}, entries[0].ContextMap())
+	require.Equal(t, zapcore.InfoLevel, entries[1].Level)
+	require.Equal(t, zapcore.WarnLevel, entries[2].Level)
+	require.Equal(t, map[string]interface{}{"suite": "db"}, entries[2].ContextMap())
+	require.Equal(t, zapcore.ErrorLevel, entries[3].Level)
+	require.Equal(t, map[string]interface{}{"suite": "db", "error": "timeout"}, entries[3].ContextMap())
+}